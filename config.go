@@ -0,0 +1,100 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Config is the demo's StackPath account and project configuration. Each value
+// is read from an environment variable and can be overridden on the command
+// line.
+type Config struct {
+	// APIClientID and APIClientSecret are the StackPath API credentials. They
+	// aren't required when authenticating with a credential Profile from
+	// `CredentialsFile`.
+	APIClientID     string
+	APIClientSecret string
+	Profile         string
+
+	StackSlug        string
+	DomainName       string
+	ProjectSubDomain string
+
+	// CreateMissingPrerequisites creates the project's stack and DNS zone if
+	// they don't exist instead of exiting. AccountID is the StackPath account
+	// to create the stack on.
+	CreateMissingPrerequisites bool
+	AccountID                  string
+}
+
+// defaultProjectSubDomain is the DNS sub-domain the project is served from if
+// one isn't configured.
+const defaultProjectSubDomain = "demo"
+
+// LoadConfig reads the configuration from environment variables, registers a
+// command line flag overriding each of them on fs, and parses args. An error
+// listing every missing required value is returned if the configuration is
+// incomplete.
+func LoadConfig(fs *flag.FlagSet, args []string) (*Config, error) {
+	config := &Config{}
+	fs.StringVar(&config.APIClientID, "client-id", os.Getenv("STACKPATH_CLIENT_ID"), "The StackPath API client ID (env STACKPATH_CLIENT_ID)")
+	fs.StringVar(&config.APIClientSecret, "client-secret", os.Getenv("STACKPATH_CLIENT_SECRET"), "The StackPath API client secret (env STACKPATH_CLIENT_SECRET)")
+	fs.StringVar(&config.Profile, "profile", os.Getenv("STACKPATH_PROFILE"), "The credential profile in "+CredentialsFile+" to authenticate with instead of a client ID and secret (env STACKPATH_PROFILE)")
+	fs.StringVar(&config.StackSlug, "stack", os.Getenv("STACKPATH_STACK_SLUG"), "The slug of the stack to deploy to (env STACKPATH_STACK_SLUG)")
+	fs.StringVar(&config.DomainName, "domain", os.Getenv("STACKPATH_DOMAIN"), "The domain name of the stack's DNS zone (env STACKPATH_DOMAIN)")
+	fs.StringVar(&config.ProjectSubDomain, "subdomain", envOrDefault("STACKPATH_SUBDOMAIN", defaultProjectSubDomain), "The DNS sub-domain to serve the project from (env STACKPATH_SUBDOMAIN)")
+	fs.BoolVar(&config.CreateMissingPrerequisites, "create-missing", envBool("STACKPATH_CREATE_MISSING"), "Create the stack and DNS zone if they don't exist (env STACKPATH_CREATE_MISSING)")
+	fs.StringVar(&config.AccountID, "account-id", os.Getenv("STACKPATH_ACCOUNT_ID"), "The StackPath account to create a missing stack on (env STACKPATH_ACCOUNT_ID)")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	if config.Profile == "" && config.APIClientID == "" {
+		missing = append(missing, "STACKPATH_CLIENT_ID (-client-id)")
+	}
+	if config.Profile == "" && config.APIClientSecret == "" {
+		missing = append(missing, "STACKPATH_CLIENT_SECRET (-client-secret)")
+	}
+	if config.StackSlug == "" {
+		missing = append(missing, "STACKPATH_STACK_SLUG (-stack)")
+	}
+	if config.DomainName == "" {
+		missing = append(missing, "STACKPATH_DOMAIN (-domain)")
+	}
+	if config.ProjectSubDomain == "" {
+		missing = append(missing, "STACKPATH_SUBDOMAIN (-subdomain)")
+	}
+	if config.CreateMissingPrerequisites && config.AccountID == "" {
+		missing = append(missing, "STACKPATH_ACCOUNT_ID (-account-id)")
+	}
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing required configuration: %s", strings.Join(missing, ", "))
+	}
+
+	return config, nil
+}
+
+// envOrDefault returns the value of an environment variable, or a default if
+// it's unset or empty.
+func envOrDefault(key, defaultValue string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	return value
+}
+
+// envBool determines if a boolean environment variable is set to a true value
+// like "1" or "true".
+func envBool(key string) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	return err == nil && value
+}
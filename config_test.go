@@ -0,0 +1,155 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"strings"
+	"testing"
+)
+
+// configEnv lists the environment variables LoadConfig() reads.
+var configEnv = []string{
+	"STACKPATH_CLIENT_ID",
+	"STACKPATH_CLIENT_SECRET",
+	"STACKPATH_PROFILE",
+	"STACKPATH_STACK_SLUG",
+	"STACKPATH_DOMAIN",
+	"STACKPATH_SUBDOMAIN",
+	"STACKPATH_CREATE_MISSING",
+	"STACKPATH_ACCOUNT_ID",
+}
+
+// setConfigEnv replaces the configuration environment variables with env for
+// the rest of the test.
+func setConfigEnv(t *testing.T, env map[string]string) {
+	t.Helper()
+
+	for _, key := range configEnv {
+		key := key
+		original, found := os.LookupEnv(key)
+		t.Cleanup(func() {
+			if found {
+				_ = os.Setenv(key, original)
+			} else {
+				_ = os.Unsetenv(key)
+			}
+		})
+
+		value, set := env[key]
+		if set {
+			_ = os.Setenv(key, value)
+		} else {
+			_ = os.Unsetenv(key)
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	env := map[string]string{
+		"STACKPATH_CLIENT_ID":     "env-client-id",
+		"STACKPATH_CLIENT_SECRET": "env-client-secret",
+		"STACKPATH_STACK_SLUG":    "env-stack",
+		"STACKPATH_DOMAIN":        "env.example.com",
+	}
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		args []string
+		want Config
+	}{
+		{
+			name: "environment variables",
+			env:  env,
+			want: Config{
+				APIClientID:      "env-client-id",
+				APIClientSecret:  "env-client-secret",
+				StackSlug:        "env-stack",
+				DomainName:       "env.example.com",
+				ProjectSubDomain: defaultProjectSubDomain,
+			},
+		},
+		{
+			name: "flags override environment variables",
+			env:  env,
+			args: []string{"-stack", "flag-stack", "-subdomain", "www"},
+			want: Config{
+				APIClientID:      "env-client-id",
+				APIClientSecret:  "env-client-secret",
+				StackSlug:        "flag-stack",
+				DomainName:       "env.example.com",
+				ProjectSubDomain: "www",
+			},
+		},
+		{
+			name: "flags only",
+			args: []string{
+				"-client-id", "flag-client-id",
+				"-client-secret", "flag-client-secret",
+				"-stack", "flag-stack",
+				"-domain", "flag.example.com",
+				"-create-missing",
+				"-account-id", "flag-account",
+			},
+			want: Config{
+				APIClientID:                "flag-client-id",
+				APIClientSecret:            "flag-client-secret",
+				StackSlug:                  "flag-stack",
+				DomainName:                 "flag.example.com",
+				ProjectSubDomain:           defaultProjectSubDomain,
+				CreateMissingPrerequisites: true,
+				AccountID:                  "flag-account",
+			},
+		},
+		{
+			name: "a profile instead of credentials",
+			env: map[string]string{
+				"STACKPATH_PROFILE":    "acme",
+				"STACKPATH_STACK_SLUG": "env-stack",
+				"STACKPATH_DOMAIN":     "env.example.com",
+			},
+			want: Config{
+				Profile:          "acme",
+				StackSlug:        "env-stack",
+				DomainName:       "env.example.com",
+				ProjectSubDomain: defaultProjectSubDomain,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setConfigEnv(t, test.env)
+
+			config, err := LoadConfig(flag.NewFlagSet("test", flag.ContinueOnError), test.args)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if *config != test.want {
+				t.Errorf("expected %+v, got %+v", test.want, *config)
+			}
+		})
+	}
+}
+
+func TestLoadConfigListsMissingValues(t *testing.T) {
+	setConfigEnv(t, map[string]string{"STACKPATH_CREATE_MISSING": "true"})
+
+	_, err := LoadConfig(flag.NewFlagSet("test", flag.ContinueOnError), []string{"-subdomain", ""})
+	if err == nil {
+		t.Fatal("expected an error for the missing configuration")
+	}
+
+	for _, want := range []string{
+		"STACKPATH_CLIENT_ID (-client-id)",
+		"STACKPATH_CLIENT_SECRET (-client-secret)",
+		"STACKPATH_STACK_SLUG (-stack)",
+		"STACKPATH_DOMAIN (-domain)",
+		"STACKPATH_SUBDOMAIN (-subdomain)",
+		"STACKPATH_ACCOUNT_ID (-account-id)",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q to list %s", err, want)
+		}
+	}
+}
@@ -2,4 +2,4 @@ module stackpath-demonstration-app
 
 go 1.16
 
-require github.com/briandowns/spinner v1.16.0 // indirect
+require github.com/briandowns/spinner v1.16.0
@@ -2,35 +2,189 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"math"
 	"os"
+	"os/signal"
+	"sort"
 	"stackpath-demonstration-app/pkg/stackpath"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/briandowns/spinner"
 )
 
-// Program configuration
+// Program configuration. The StackPath account and project settings are
+// loaded into a Config by LoadConfig().
 const (
-	APIClientID      = "set me"
-	APIClientSecret  = "set me"
-	StackSlug        = "set me"
-	DomainName       = "set me"
-	ProjectSubDomain = "set me"
+	// CredentialsFile holds named credential profiles selected with the
+	// -profile flag. The configured API client ID and secret are used when no
+	// profile is selected.
+	CredentialsFile = "credentials.json"
+
+	// MaxLogLinesPerSecond limits how many log lines each instance may echo
+	// per second while monitoring. Set it to 0 to echo every line.
+	MaxLogLinesPerSecond = 20
+
+	// StartupLogLines is how many of each instance's most recent log lines to
+	// echo when monitoring starts. Set it to 0 to echo every line.
+	StartupLogLines = 20
+
+	// WAFRequestsAction limits the WAF requests echoed while monitoring to
+	// those the WAF took an action on, e.g. stackpath.WAFActionBlock to only
+	// show blocked traffic. Leave it empty to echo every request.
+	WAFRequestsAction = ""
+
+	// OriginConnectTimeout and OriginReadTimeout control how long the CDN
+	// waits on the Edge Compute origin before responding with a 504. Set them
+	// to 0 for the platform defaults.
+	OriginConnectTimeout = 0 * time.Second
+	OriginReadTimeout    = 0 * time.Second
+
+	// SiteAnalyticsInterval is how often to echo a summary of the site's CDN
+	// traffic while monitoring.
+	SiteAnalyticsInterval = 5 * time.Minute
+
+	// DNSRecordTTL is the TTL of the project's DNS record, in seconds.
+	DNSRecordTTL = 60
+
+	// SSLCertificateTimeout is how long to wait for a requested SSL
+	// certificate to be issued before giving up.
+	SSLCertificateTimeout = 10 * time.Minute
+
+	// TokenExpiryWarning is how long before the StackPath bearer token expires
+	// to warn about it while monitoring.
+	TokenExpiryWarning = 5 * time.Minute
 )
 
-// These entities are built as the app is deployed to StackPath.
-var (
-	client         *stackpath.Client
-	stack          *stackpath.Stack
-	domain         *stackpath.Domain
-	workload       *stackpath.Workload
-	site           *stackpath.Site
-	deliveryDomain string
-)
+// nonInteractive skips every [Enter] prompt so the demo can run unattended.
+var nonInteractive bool
 
 func main() {
+	scaleMetric := flag.String(
+		"scale-metric",
+		stackpath.ScaleMetricCPU,
+		"The metric instances auto-scale on: cpu, memory, or requests",
+	)
+	scaleThreshold := flag.Int(
+		"scale-threshold",
+		50,
+		"The average scale metric value that triggers scaling up: a percentage for cpu and memory, or requests per second per instance",
+	)
+	cities := flag.String(
+		"cities",
+		"",
+		"A comma separated list of city codes to deploy to, e.g. LAX,SYD,NRT, instead of the default DFW, FRA, and AMS",
+	)
+	suggestNearby := flag.Bool(
+		"suggest-nearby",
+		false,
+		"Suggest deploying to the StackPath locations closest to you instead of the default DFW, FRA, and AMS",
+	)
+	metricsSnapshot := flag.String(
+		"metrics-snapshot",
+		"",
+		"A file to write the deployment's metrics to in Prometheus text format once it's deployed",
+	)
+	status := flag.Bool(
+		"status",
+		false,
+		"Show the status of an existing deployment without changing anything, then exit",
+	)
+	flag.BoolVar(
+		&nonInteractive,
+		"non-interactive",
+		false,
+		"Run straight through without waiting for [Enter], then monitor for -monitor-duration and exit",
+	)
+	flag.BoolVar(&nonInteractive, "y", false, "Shorthand for -non-interactive")
+	monitorDuration := flag.Duration(
+		"monitor-duration",
+		5*time.Minute,
+		"How long to monitor the application before exiting in non-interactive mode",
+	)
+	plan := flag.Bool(
+		"plan",
+		false,
+		"Show how an existing deployment differs from what the demo would deploy without changing anything, then exit",
+	)
+	teardown := flag.Bool(
+		"teardown",
+		false,
+		"Delete everything an existing deployment of the project provisioned, then exit",
+	)
+	restartInstance := flag.String(
+		"restart-instance",
+		"",
+		"The name of a stuck workload instance in an existing deployment to restart, then exit",
+	)
+	restartPolicy := flag.String(
+		"restart-policy",
+		stackpath.RestartPolicyDefault,
+		"Whether the workload's containers restart when they exit: Always, OnFailure, or Never. The platform default is used if it's empty",
+	)
+	cpuLimit := flag.String(
+		"cpu-limit",
+		"",
+		"The most CPU each instance may use, e.g. 2 or 500m. Instances aren't limited if it's empty",
+	)
+	memoryLimit := flag.String(
+		"memory-limit",
+		"",
+		"The most memory each instance may use, e.g. 4Gi. Instances aren't limited if it's empty",
+	)
+	readinessProbePath := flag.String(
+		"readiness-probe-path",
+		"",
+		"An HTTP path on the app, e.g. /status/200, that instances must answer successfully to stay in rotation. Instances aren't probed if it's empty",
+	)
+	demoVersion := flag.String(
+		"demo-version",
+		"",
+		"A version to label the deployment with in the container's DEMO_VERSION environment variable, checked by a smoke test once deployed",
+	)
+	dumpResponsesDir := flag.String(
+		"dump-responses",
+		"",
+		"A directory to write every StackPath API response body to for debugging",
+	)
+	logAPIRequests := flag.Bool(
+		"log-api-requests",
+		false,
+		"Echo every StackPath API request's method, URL, status, and duration to STDERR for debugging",
+	)
+	output := flag.String(
+		"output",
+		OutputText,
+		"The output format: text, or json to emit the provisioned resources and monitoring events as JSON on STDOUT. json implies -non-interactive",
+	)
+
+	config, err := LoadConfig(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		donef("Error loading the configuration: %s", err)
+	}
+
+	switch *output {
+	case OutputText:
+	case OutputJSON:
+		nonInteractive = true
+		enableJSONOutput()
+	default:
+		donef("Invalid output format %q: must be %s or %s", *output, OutputText, OutputJSON)
+	}
+
+	err = stackpath.ValidateScaleSettings(*scaleMetric, *scaleThreshold)
+	if err != nil {
+		donef("Invalid scale settings: %s", err)
+	}
+
 	// There are various pauses in the process with prompts to press [Enter] to
 	// continue. Read that from STDIN when necessary.
 	reader := bufio.NewReader(os.Stdin)
@@ -55,10 +209,8 @@ registered domain name with an empty zone provisioned on our DNS infrastructure.
 This program was written from scratch and uses the StackPath REST API for all 
 interaction with StackPath.
 
-This is a live demo. Fingers crossed, everyone!
-
-Press [Enter] to continue.`)
-	_, _ = reader.ReadString('\n')
+This is a live demo. Fingers crossed, everyone!`)
+	promptEnter(reader, "Press [Enter] to continue.")
 
 	// Editor's note: Normally I'd write more idiomatic code here with proper
 	// variable scoping, parameter and error handling, and no display side
@@ -67,292 +219,1162 @@ Press [Enter] to continue.`)
 	// having to get too far into coding bits, making a demo of the process a
 	// little easier to read.
 
+	// The root context is cancelled when the program is interrupted, which also
+	// cancels in-flight StackPath API calls. Deploying stops after the current
+	// step and monitoring stops right away. Ending the program with [q] cancels
+	// it too, stopping the monitors.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	fmt.Println(`Checking requirements
 ---------------------`)
-	authenticateToStackPath()
-	findStack()
-	findDomainOnStack()
+	var clientOpts []stackpath.Option
+	if *dumpResponsesDir != "" {
+		clientOpts = append(clientOpts, stackpath.WithResponseDump(*dumpResponsesDir))
+	}
+	if *logAPIRequests {
+		clientOpts = append(clientOpts, stackpath.WithLogger(logAPIRequest))
+	}
+	client := authenticateToStackPath(config, clientOpts...)
+
+	opts := deployOptions{
+		scaleMetric:        *scaleMetric,
+		scaleThreshold:     *scaleThreshold,
+		restartPolicy:      *restartPolicy,
+		cpuLimit:           *cpuLimit,
+		memoryLimit:        *memoryLimit,
+		readinessProbePath: *readinessProbePath,
+		demoVersion:        *demoVersion,
+		suggestNearby:      *suggestNearby,
+	}
+	for _, cityCode := range strings.Split(*cities, ",") {
+		if strings.TrimSpace(cityCode) != "" {
+			opts.cityCodes = append(opts.cityCodes, strings.ToUpper(strings.TrimSpace(cityCode)))
+		}
+	}
 
-	fmt.Println(`Requirements met!
-Press [Enter] to continue.`)
-	_, _ = reader.ReadString('\n')
+	if *status {
+		displayStatus(ctx, client, config)
+		fmt.Println("Done")
+		fmt.Println()
+		return
+	}
+	if *plan {
+		displayPlan(ctx, client, config, opts)
+		fmt.Println("Done")
+		fmt.Println()
+		return
+	}
+	if *teardown {
+		teardownDeployment(ctx, client, config)
+		fmt.Println("Done")
+		fmt.Println()
+		return
+	}
+	if *restartInstance != "" {
+		restartWorkloadInstance(ctx, client, config, *restartInstance)
+		fmt.Println("Done")
+		fmt.Println()
+		return
+	}
+
+	deployment := stackpath.NewDeployment(config.ProjectSubDomain)
+	findStack(ctx, client, config, deployment)
+	findDomainOnStack(ctx, client, config, deployment)
+
+	fmt.Println("Requirements met!")
+	promptEnter(reader, "Press [Enter] to continue.")
 
 	fmt.Println(`Deploying the application
 -------------------------`)
-	provisionComputeWorkload()
-	provisionSite()
-	waitForComputeWorkload()
-	findDeliveryDomain()
-	setDNSCNAMERecord()
-	provisionSSLCertificate()
-	createWAFRules()
-
-	fmt.Printf("Success! The project is available at https://%s.%s\n", ProjectSubDomain, DomainName)
-	fmt.Println("Press [Enter] to begin monitoring the application")
-	fmt.Println("Press [q] then [Enter] to end the program")
-	_, _ = reader.ReadString('\n')
+
+	err = deploy(ctx, client, reader, deployment, opts)
+	if err != nil {
+		reportDeployment(deployment)
+		if ctx.Err() != nil {
+			donef("Deployment canceled: %s", err)
+		}
+		if errors.Is(err, stackpath.ErrQuotaExceeded) {
+			donef("Error deploying the application: %s\nTear down workloads and sites left over from previous demos and try again.", err)
+		}
+		donef("Error deploying the application: %s", err)
+	}
+
+	if *metricsSnapshot != "" {
+		writeMetricsSnapshot(ctx, client, *metricsSnapshot, deployment)
+	}
+
+	if jsonOutput != nil {
+		emitDeploymentReport(ctx, client, deployment)
+	}
+
+	fmt.Printf("Success! The project is available at https://%s\n", deployment.Hostname())
+	if nonInteractive {
+		fmt.Printf("Monitoring the application for %s\n", *monitorDuration)
+	} else {
+		fmt.Println("Press [Enter] to begin monitoring the application")
+		fmt.Println("Press [q] then [Enter] to end the program")
+		_, _ = reader.ReadString('\n')
+	}
+
+	displayCertificateExpiry(ctx, client, deployment)
 
 	// Monitor the apps in functions that run concurrently echo'ing to STDOUT.
-	go displayWAFRequests()
-	go displayInstanceLogs()
+	// They return once the root context is cancelled.
+	monitoringStarted := client.ServerNow()
+	var monitors sync.WaitGroup
+	monitor := func(f func()) {
+		monitors.Add(1)
+		go func() {
+			defer monitors.Done()
+			f()
+		}()
+	}
+	monitor(func() { displayWAFRequests(ctx, client, deployment) })
+	monitor(func() { displayInstanceLogs(ctx, client, deployment) })
+	monitor(func() { displayScalingEvents(ctx, client, deployment) })
+	monitor(func() { displaySiteAnalytics(ctx, client, deployment) })
+	monitor(func() { warnBeforeTokenExpiry(ctx, client) })
+
+	quit := make(chan struct{})
 	go func() {
-		for {
-			select {}
+		if nonInteractive {
+			<-time.After(*monitorDuration)
+		} else {
+			_, _ = reader.ReadString('q')
 		}
+		close(quit)
 	}()
 
-	_, _ = reader.ReadString('q')
+	interrupted := false
+	select {
+	case <-quit:
+	case <-ctx.Done():
+		interrupted = true
+	}
+
+	stop()
+	fmt.Println()
+	fmt.Println("Stopping monitors...")
+	monitors.Wait()
+
+	if interrupted {
+		fmt.Println("Interrupted, monitoring stopped")
+		reportDeployment(deployment)
+	}
+
+	// The root context is cancelled by now, so summarize without it.
+	stats, err := client.GetWAFStats(context.Background(), deployment.Stack, deployment.Site, monitoringStarted, time.Time{})
+	if err != nil {
+		fmt.Printf("[WAF] Error loading WAF stats: %s\n", err)
+	} else {
+		displayWAFStats(deployment, stats)
+		displayTopCountries(deployment, stats.ByCountry)
+	}
+
 	fmt.Println("Done")
 	fmt.Println()
 }
 
-// authenticateToStackPath populates the `client` variable with an authenticated
-// StackPath API bearer token.
-func authenticateToStackPath() {
+// deployOptions holds the command line settings that shape a deployment.
+type deployOptions struct {
+	scaleMetric    string
+	scaleThreshold int
+
+	// cityCodes are the cities to deploy to. DefaultTargets() are used if
+	// it's empty.
+	cityCodes []string
+
+	// suggestNearby suggests the StackPath locations closest to the presenter
+	// when no cityCodes are given.
+	suggestNearby bool
+
+	// restartPolicy, cpuLimit, memoryLimit, and readinessProbePath configure
+	// the workload's containers. Empty values keep the platform defaults.
+	restartPolicy      string
+	cpuLimit           string
+	memoryLimit        string
+	readinessProbePath string
+
+	// demoVersion labels the workload and is smoke tested once deployed if
+	// it's set.
+	demoVersion string
+}
+
+// deploy chooses the deployment's targets, provisions the application with
+// Client.Deploy(), then checks on the result. If ctx is cancelled then deploy
+// stops after the current step and returns ctx's error, leaving the deployment
+// populated with everything provisioned so far. The same goes for a failed
+// provisioning step.
+func deploy(ctx context.Context, client *stackpath.Client, reader *bufio.Reader, d *stackpath.Deployment, opts deployOptions) error {
+	chooseTargets(ctx, client, reader, d, opts)
+
+	progress := &deployProgress{ctx: ctx, client: client, d: d}
+	_, err := client.Deploy(ctx, d, stackpath.DeployOptions{
+		Workload:        workloadSpec(d.Targets, opts),
+		OriginTimeouts:  stackpath.OriginTimeouts{Connect: OriginConnectTimeout, Read: OriginReadTimeout},
+		DNSRecordTTL:    DNSRecordTTL,
+		SSLCertTimeout:  SSLCertificateTimeout,
+		OnStepStart:     progress.stepStarted,
+		OnStepDone:      progress.stepDone,
+		OnInstancePhase: progress.instancePhase,
+	})
+	if err != nil {
+		progress.stop()
+		return err
+	}
+
+	steps := []func(){
+		func() { displayWorkloadTargets(ctx, client, d) },
+		func() { verifyWAFRules(ctx, client, d) },
+		func() { displayWAFPolicy(ctx, client, d) },
+		func() { smokeTest(ctx, client, d, opts) },
+	}
+
+	for _, step := range steps {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		step()
+	}
+
+	return ctx.Err()
+}
+
+// deployStepPrefixes are the spinner prefixes echoed as Client.Deploy() starts
+// each step.
+var deployStepPrefixes = map[string]string{
+	stackpath.DeployStepWorkload:       "Creating compute workload",
+	stackpath.DeployStepSite:           "Creating CDN and WAF service in front of the Edge Compute origin",
+	stackpath.DeployStepDeliveryDomain: "Locating the site's delivery domain",
+	stackpath.DeployStepSSLCert:        "Creating an SSL certificate",
+	stackpath.DeployStepWAFMode:        "Checking the WAF is blocking requests",
+	stackpath.DeployStepWAFRules:       "Creating custom WAF rules",
+}
+
+// deployProgress echos Client.Deploy()'s progress with a spinner per step,
+// pausing after each one. While the workload starts it emulates
+// startSpinner()'s and stopSpinner()'s behavior instead, since instance status
+// changes are echo'd as they happen.
+type deployProgress struct {
+	ctx    context.Context
+	client *stackpath.Client
+	d      *stackpath.Deployment
+
+	// s and t are the running spinner and when it started. s is nil between
+	// steps and once the first instance shows up.
+	s *spinner.Spinner
+	t time.Time
+}
+
+// stepStarted starts the step's spinner.
+func (p *deployProgress) stepStarted(step string) {
+	switch step {
+	case stackpath.DeployStepWaitForWorkload:
+		fmt.Println("Waiting for all containers to start before continuing")
+		p.t = time.Now()
+		p.s = spinner.New(spinner.CharSets[9], 100*time.Millisecond, spinner.WithWriter(os.Stdout))
+		p.s.Prefix = "| Waiting for the first instance to start "
+		p.s.Start()
+	case stackpath.DeployStepDNSRecord:
+		p.s, p.t = startSpinner(fmt.Sprintf("Creating the project DNS record: \"%s\"", p.d.Hostname()))
+	default:
+		p.s, p.t = startSpinner(deployStepPrefixes[step])
+	}
+}
+
+// stepDone stops the step's spinner with its summary and waits for [Enter].
+func (p *deployProgress) stepDone(step, summary string) {
+	if step == stackpath.DeployStepWaitForWorkload {
+		p.stop()
+		fmt.Println("| Done")
+		fmt.Printf("└ Took %v\n\n", time.Now().Sub(p.t))
+		promptEnter(bufio.NewReader(os.Stdin), "")
+		return
+	}
+
+	message := "Done"
+	if summary != "" {
+		message = "Done: " + summary
+	}
+	stopSpinner(p.s, p.t, message, true)
+	p.s = nil
+}
+
+// instancePhase echos an instance's new phase, with how long it took to start
+// once it's running.
+func (p *deployProgress) instancePhase(instance stackpath.Instance) {
+	if p.s != nil {
+		p.stop()
+	}
+
+	fmt.Printf("| Instance \"%s\" is %s", instance.Name, strings.ToLower(instance.Phase))
+	if instance.Phase == stackpath.InstancePhaseRunning {
+		timing, err := p.client.GetInstanceStartupTiming(p.ctx, p.d.Stack, p.d.Workload, &instance)
+		if err == nil && timing.StartupDuration() > 0 {
+			fmt.Printf(" (%s instance started in %s)", instance.Location.CityCode, timing.StartupDuration())
+		}
+	}
+	fmt.Println()
+}
+
+// stop stops the running spinner, if there is one, e.g. when a step fails.
+func (p *deployProgress) stop() {
+	if p.s == nil {
+		return
+	}
+
+	p.s.Stop()
+	fmt.Println()
+	p.s = nil
+}
+
+// reportDeployment echos the resources a deployment provisioned, so they can be
+// torn down after the program stops.
+func reportDeployment(d *stackpath.Deployment) {
+	fmt.Println()
+	fmt.Println("These resources are still provisioned on StackPath:")
+	if d.Workload != nil {
+		fmt.Printf("| Compute workload \"%s\" (ID: %s)\n", d.Workload.Name, d.Workload.ID)
+	}
+	if d.Site != nil {
+		fmt.Printf("| CDN and WAF site %s\n", d.Site.ID)
+	}
+	if d.DeliveryDomain != "" {
+		fmt.Printf("| DNS record \"%s\" (if created)\n", d.Hostname())
+	}
+	if d.Workload == nil && d.Site == nil {
+		fmt.Println("| None")
+	}
+	fmt.Println()
+}
+
+// authenticateToStackPath builds a StackPath API client with an authenticated
+// bearer token. It authenticates with the configured credential profile, or
+// with the configured API client ID and secret if no profile is named. The
+// client is configured with opts.
+func authenticateToStackPath(config *Config, opts ...stackpath.Option) *stackpath.Client {
+	var client *stackpath.Client
 	var err error
 	s, t := startSpinner("Authenticating to StackPath")
 
-	client, err = stackpath.NewClient(APIClientID, APIClientSecret)
+	if config.Profile != "" {
+		client, err = stackpath.NewClientFromProfile(CredentialsFile, config.Profile, opts...)
+	} else {
+		client, err = stackpath.NewClientWithOptions(config.APIClientID, config.APIClientSecret, opts...)
+	}
 	if err != nil {
 		donef("Error Authenticating to StackPath: %s", err)
 	}
 
 	stopSpinner(s, t, "Done", false)
+	return client
 }
 
-// findStack checks if the `StackSlug` stack exists and populates `stack` with
-// the stack if so.
-func findStack() {
+// logAPIRequest echos a finished StackPath API request to STDERR.
+func logAPIRequest(entry stackpath.RequestLog) {
+	if entry.Err != nil {
+		fmt.Fprintf(os.Stderr, "[API] %s %s: %d in %s: %s\n", entry.Method, entry.URL, entry.StatusCode, entry.Duration.Round(time.Millisecond), entry.Err)
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "[API] %s %s: %d in %s\n", entry.Method, entry.URL, entry.StatusCode, entry.Duration.Round(time.Millisecond))
+}
+
+// findStack checks if the `config.StackSlug` stack exists and populates the
+// deployment's stack with the stack if so. If not, it creates the stack when
+// `config.CreateMissingPrerequisites` is set.
+func findStack(ctx context.Context, client *stackpath.Client, config *Config, d *stackpath.Deployment) {
 	var err error
 	s, t := startSpinner("Finding the project stack")
 
-	stack, err = client.FindStackBySlug(StackSlug)
-	if err != nil {
+	d.Stack, err = client.FindStackBySlug(ctx, config.StackSlug)
+	if stackpath.IsUnauthorized(err) {
+		stopSpinner(s, t, "Access denied", false)
+		donef("The API credentials can't access stack \"%s\": %s", config.StackSlug, err)
+	}
+	if err != nil && !stackpath.IsNotFound(err) {
 		donef("Error locating stack: %s", err)
 	}
-	if stack == nil {
+	if d.Stack == nil && config.CreateMissingPrerequisites {
+		d.Stack, err = client.CreateStack(ctx, config.StackSlug, config.StackSlug, config.AccountID)
+		if errors.Is(err, stackpath.ErrStackExists) {
+			donef("Error creating stack: the \"%s\" slug is taken by a stack the API credentials can't access", config.StackSlug)
+		}
+		if err != nil {
+			donef("Error creating stack: %s", err)
+		}
+
+		stopSpinner(s, t, fmt.Sprintf("Done: created stack \"%s\" (slug: %s)", d.Stack.Name, d.Stack.Slug), false)
+		return
+	}
+	if d.Stack == nil {
 		stopSpinner(s, t, "Not found", false)
-		donef("Stack \"%s\" was not found", StackSlug)
+
+		// Help find the right stack slug by listing the stacks that are there.
+		stacks, err := client.ListStacks(ctx)
+		if err == nil && len(stacks) > 0 {
+			fmt.Println("These stacks are available to the API credentials:")
+			for _, stack := range stacks {
+				fmt.Printf("| %s (slug: %s)\n", stack.Name, stack.Slug)
+			}
+			fmt.Println()
+		}
+
+		donef("Stack \"%s\" was not found", config.StackSlug)
 	}
 
-	stopSpinner(s, t, fmt.Sprintf("Done: found stack \"%s\" (slug: %s)", stack.Name, stack.Slug), false)
+	stopSpinner(s, t, fmt.Sprintf("Done: found stack \"%s\" (slug: %s)", d.Stack.Name, d.Stack.Slug), false)
 }
 
-// findDomainOnStack looks for the `DomainName` domain on the `stack` stack and
-// populates `domain` if so.
-func findDomainOnStack() {
+// findDomainOnStack looks for the `config.DomainName` domain on the
+// deployment's stack and populates the deployment's domain if so. If not, it
+// creates the DNS zone when `config.CreateMissingPrerequisites` is set.
+func findDomainOnStack(ctx context.Context, client *stackpath.Client, config *Config, d *stackpath.Deployment) {
 	var err error
-	s, t := startSpinner(fmt.Sprintf("Locating the \"%s\" DNS zone", DomainName))
+	s, t := startSpinner(fmt.Sprintf("Locating the \"%s\" DNS zone", config.DomainName))
 
-	domain, err = client.FindDomainByName(stack, DomainName)
+	d.Domain, err = client.FindDomainByName(ctx, d.Stack, config.DomainName)
 	if err != nil {
 		donef("Error locating DNS Zone: %s", err)
 	}
-	if domain == nil {
+	if d.Domain == nil && config.CreateMissingPrerequisites {
+		d.Domain, err = client.CreateZone(ctx, d.Stack, config.DomainName)
+		if err != nil {
+			donef("Error creating DNS zone: %s", err)
+		}
+
+		stopSpinner(s, t, fmt.Sprintf("Done: created DNS zone \"%s\" (ID: %s)", d.Domain.Name, d.Domain.ID), false)
+		return
+	}
+	if d.Domain == nil {
 		stopSpinner(s, t, "Not found", false)
-		donef("DNS zone \"%s\" was not found", DomainName)
+		donef("DNS zone \"%s\" was not found", config.DomainName)
 	}
 
-	stopSpinner(s, t, fmt.Sprintf("Done: found DNS zone \"%s\" (ID: %s)", domain.Name, domain.ID), false)
+	stopSpinner(s, t, fmt.Sprintf("Done: found DNS zone \"%s\" (ID: %s)", d.Domain.Name, d.Domain.ID), false)
 }
 
-// provisionComputeWorkload creates a new Edge Compute workload on the StackPath
-// platform and populates `workload` the new workload object.
-func provisionComputeWorkload() {
-	var err error
-	s, t := startSpinner("Creating compute workload")
+// chooseTargets populates the deployment's targets with the cities given on
+// the command line, or with the demo's default locations. With
+// -suggest-nearby it suggests the StackPath POPs closest to the presenter
+// instead and asks whether to deploy there or to the default locations. Every
+// target scales on the chosen metric and threshold.
+func chooseTargets(ctx context.Context, client *stackpath.Client, reader *bufio.Reader, d *stackpath.Deployment, opts deployOptions) {
+	if len(opts.cityCodes) > 0 {
+		d.Targets = stackpath.CityTargets(opts.cityCodes)
+		fmt.Printf("Deploying to %s\n", strings.Join(opts.cityCodes, ", "))
+	} else if !opts.suggestNearby {
+		d.Targets = stackpath.DefaultTargets()
+	} else {
+		s, t := startSpinner("Finding the StackPath locations closest to you")
+
+		d.Targets = client.SuggestNearbyTargets(ctx)
+
+		var cityCodes []string
+		for _, target := range d.Targets {
+			cityCodes = append(cityCodes, target.CityCodes...)
+		}
 
-	workload, err = client.CreateWorkload(stack)
-	if err != nil {
-		donef("Error creating compute workload: %s", err)
+		stopSpinner(s, t, fmt.Sprintf("Done: found %s", strings.Join(cityCodes, ", ")), false)
+
+		// Non-interactive runs deploy to the suggested locations.
+		if !nonInteractive {
+			fmt.Println("Press [Enter] to deploy to these locations")
+			fmt.Println("Press [d] then [Enter] to deploy to the default DFW, FRA, and AMS locations")
+			choice, _ := reader.ReadString('\n')
+			if strings.TrimSpace(choice) == "d" {
+				d.Targets = stackpath.DefaultTargets()
+			}
+		}
 	}
 
-	stopSpinner(
-		s,
-		t,
-		fmt.Sprintf("Done: workload \"%s\" created, anycast IP: %s", workload.Name, workload.AnycastIP),
-		true,
+	for i := range d.Targets {
+		d.Targets[i].ScaleMetric = opts.scaleMetric
+		d.Targets[i].ScaleThreshold = opts.scaleThreshold
+	}
+
+	estimate, err := stackpath.EstimateWorkloadCost(workloadSpec(d.Targets, opts), time.Hour)
+	if err != nil {
+		donef("Error estimating the workload's cost: %s", err)
+	}
+	fmt.Printf(
+		"| Estimated compute cost: %.2f-%.2f %s per hour (%d-%d instances)\n\n",
+		estimate.Min,
+		estimate.Max,
+		estimate.Currency,
+		estimate.MinInstances,
+		estimate.MaxInstances,
 	)
 }
 
-// provisionSite creates CDN and WAF service using the workload's anycast IP as
-// the origin and populates `site` with the resulting site object.
-func provisionSite() {
-	var err error
-	s, t := startSpinner("Creating CDN and WAF service in front of the Edge Compute origin")
+// workloadSpec returns the demo's workload spec deployed to targets with the
+// container settings in opts.
+func workloadSpec(targets []stackpath.Target, opts deployOptions) stackpath.WorkloadSpec {
+	spec := stackpath.DefaultWorkloadSpec()
+	spec.Targets = targets
+	spec.RestartPolicy = opts.restartPolicy
+	spec.Resources.Limits = stackpath.ResourceList{CPU: opts.cpuLimit, Memory: opts.memoryLimit}
+	if opts.readinessProbePath != "" {
+		spec.ReadinessProbe = &stackpath.Probe{
+			Path:             opts.readinessProbePath,
+			Port:             80,
+			Period:           10 * time.Second,
+			FailureThreshold: 3,
+		}
+	}
+	if opts.demoVersion != "" {
+		spec.SetDemoVersion(opts.demoVersion)
+	}
+
+	return spec
+}
 
-	site, err = client.CreateSiteDelivery(stack, workload.AnycastIP, fmt.Sprintf("%s.%s", ProjectSubDomain, DomainName))
+// displayWorkloadTargets echos a table of the deployment workload's targets and
+// their scaling state.
+func displayWorkloadTargets(ctx context.Context, client *stackpath.Client, d *stackpath.Deployment) {
+	s, t := startSpinner("Loading the workload's scaling state")
+
+	targets, err := client.GetWorkloadTargets(ctx, d.Stack, d.Workload)
 	if err != nil {
-		donef("Error creating CDN and WAF service: %s", err)
+		stopSpinner(s, t, fmt.Sprintf("Warning: unable to load the workload's targets: %s", err), false)
+		return
 	}
 
-	stopSpinner(s, t, fmt.Sprintf("Done: site \"%s\" created", site.ID), true)
+	s.Stop()
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "| TARGET\tCITIES\tMIN\tMAX\tDESIRED")
+	for _, target := range targets {
+		_, _ = fmt.Fprintf(
+			w,
+			"| %s\t%s\t%d\t%d\t%d\n",
+			target.Name,
+			strings.Join(target.CityCodes, ", "),
+			target.MinReplicas,
+			target.MaxReplicas,
+			target.DesiredReplicas,
+		)
+	}
+	_ = w.Flush()
+
+	stopSpinner(s, t, fmt.Sprintf("Done: %d targets", len(targets)), false)
 }
 
-// waitForComputeWorkload tracks the instances in `workload` and echos when
-// their state changes. It uses a spinner as a loading screen while waiting on
-// the first instance. This doesn't use but emulates startSpinner()'s and
-// stopSpinner()'s behavior because there's custom echo'ing to the console while
-// the workload starts.
-func waitForComputeWorkload() {
-	fmt.Println("Waiting for all containers to start before continuing")
-	t := time.Now()
-	s := spinner.New(spinner.CharSets[9], 100*time.Millisecond)
-	s.Prefix = "| Waiting for the first instance to start "
-	s.Start()
+// verifyWAFRules requests the demo WAF rules' paths on the deployment's project
+// URL to confirm the rules are live. Failures are reported but don't stop the
+// demo, since the DNS record and SSL certificate may still be propagating.
+func verifyWAFRules(ctx context.Context, client *stackpath.Client, d *stackpath.Deployment) {
+	s, t := startSpinner("Verifying the custom WAF rules took effect")
+
+	projectURL := "https://" + d.Hostname()
+	var results []string
+	for _, rule := range []struct{ path, action string }{
+		{"/blockme", stackpath.WAFActionBlock},
+		{"/anything", stackpath.WAFActionAllow},
+	} {
+		status, action, err := client.VerifyWAFRule(ctx, projectURL, rule.path, rule.action)
+		if err != nil {
+			results = append(results, fmt.Sprintf("Warning: unable to verify %s: %s", rule.path, err))
+			continue
+		}
 
-	// instanceStatus is a mapping of instance name -> status
-	instanceStatus := make(map[string]string, 0)
+		results = append(results, fmt.Sprintf("%s: %d (%s)", rule.path, status, action))
+	}
 
-	// Poll for instance status once per second. Display the spinner until the
-	// first instance starts. After that report instance status changes to the
-	// console. Quit the ticker after at least 3 instances are running, a fair
-	// assumption that all workload instances started.
-	for {
-		instances, err := client.GetInstances(stack, workload)
+	stopSpinner(s, t, "Done: "+strings.Join(results, ", "), true)
+}
+
+// smokeTest checks that the deployment serves the demo version given on the
+// command line. It's skipped if no version was given.
+func smokeTest(ctx context.Context, client *stackpath.Client, d *stackpath.Deployment, opts deployOptions) {
+	if opts.demoVersion == "" {
+		return
+	}
+
+	s, t := startSpinner(fmt.Sprintf("Smoke testing demo version %s", opts.demoVersion))
+
+	err := client.SmokeTest(ctx, d, opts.demoVersion)
+	if err != nil {
+		stopSpinner(s, t, fmt.Sprintf("Warning: smoke test failed: %s", err), true)
+		return
+	}
+
+	stopSpinner(s, t, "Done: the project serves the expected version", true)
+}
+
+// displayWAFPolicy echos a table of the deployment site's effective WAF
+// policy, in evaluation order.
+func displayWAFPolicy(ctx context.Context, client *stackpath.Client, d *stackpath.Deployment) {
+	s, t := startSpinner("Loading the effective WAF policy")
+
+	policy, err := client.GetEffectiveWAFPolicy(ctx, d.Stack, d.Site)
+	if err != nil {
+		stopSpinner(s, t, fmt.Sprintf("Warning: unable to load the effective WAF policy: %s", err), true)
+		return
+	}
+
+	s.Stop()
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "| #\tTYPE\tGROUP\tRULE\tACTION")
+	for i, rule := range policy {
+		_, _ = fmt.Fprintf(w, "| %d\t%s\t%s\t%s\t%s\n", i+1, rule.Type, rule.Group, rule.Name, rule.Action)
+	}
+	_ = w.Flush()
+
+	stopSpinner(s, t, fmt.Sprintf("Done: %d active rules", len(policy)), true)
+}
+
+// findProjectDeployment finds the configured project's existing deployment.
+// It exits if the lookup fails or if more than one workload or site matches
+// the project, since acting on the wrong one could affect another project.
+func findProjectDeployment(ctx context.Context, client *stackpath.Client, config *Config) *stackpath.Deployment {
+	d, err := client.FindDeployment(ctx, config.StackSlug, config.DomainName, config.ProjectSubDomain)
+	if errors.Is(err, stackpath.ErrAmbiguousMatch) {
+		donef("Error finding the project deployment: %s\nRemove the duplicates in the StackPath portal and try again.", err)
+	}
+	if err != nil {
+		donef("Error finding the project deployment: %s", err)
+	}
+
+	return d
+}
+
+// displayStatus finds an existing deployment of the project by name and echos a
+// summary of it. Only lookups are made, so nothing on StackPath is created,
+// changed, or deleted.
+func displayStatus(ctx context.Context, client *stackpath.Client, config *Config) {
+	s, t := startSpinner("Finding the project deployment")
+
+	d := findProjectDeployment(ctx, client, config)
+
+	switch {
+	case d.Stack == nil:
+		donef("Error: stack \"%s\" not found", config.StackSlug)
+	case d.Domain == nil:
+		donef("Error: DNS zone \"%s\" not found on stack \"%s\"", config.DomainName, config.StackSlug)
+	}
+
+	stopSpinner(s, t, "Done", false)
+
+	fmt.Printf("Stack: %s\n", d.Stack.Slug)
+	fmt.Printf("Project: https://%s\n", d.Hostname())
+
+	if d.Workload == nil {
+		fmt.Println("Compute workload: not found")
+	} else {
+		fmt.Printf("Compute workload: \"%s\" (ID: %s, anycast IP: %s)\n", d.Workload.Name, d.Workload.ID, d.Workload.AnycastIP)
+
+		instances, err := client.GetInstances(ctx, d.Stack, d.Workload)
 		if err != nil {
-			donef("Error querying instance status: %s", err)
+			donef("Error querying workload instances: %s", err)
 		}
+		for _, instance := range instances {
+			load := ""
+			if instance.Phase == stackpath.InstancePhaseRunning {
+				metrics, err := client.GetInstanceMetrics(ctx, d.Stack, d.Workload, instance.Name, client.ServerNow().Add(-5*time.Minute), time.Minute)
+				if err != nil {
+					donef("Error querying instance %s metrics: %s", instance.Name, err)
+				}
+				load = " " + cpuGauge(metrics.LatestCPU())
+			}
 
-		if len(instances) == 0 {
-			continue
+			fmt.Printf("| Instance %s (%s): %s%s\n", instance.Name, instance.Location.CityCode, strings.ToLower(instance.Phase), load)
+		}
+		fmt.Println()
+
+		displayWorkloadTargets(ctx, client, d)
+	}
+
+	if d.Site == nil {
+		fmt.Println("CDN and WAF site: not found")
+		fmt.Println()
+		return
+	}
+
+	fmt.Printf("CDN and WAF site: %s (delivery domain: %s)\n", d.Site.ID, d.DeliveryDomain)
+	displayCertificateExpiry(ctx, client, d)
+
+	mode, err := client.GetWAFMode(ctx, d.Stack, d.Site)
+	if err != nil {
+		donef("Error checking the WAF mode: %s", err)
+	}
+	fmt.Printf("[WAF] mode: %s\n", strings.ToLower(mode))
+
+	requests, err := client.GetWAFRequests(ctx, d.Stack, d.Site, client.ServerNow().Add(-time.Hour), time.Time{})
+	if err != nil {
+		donef("Error getting WAF requests: %s", err)
+	}
+	blocked := 0
+	for _, request := range requests {
+		if request.Action == stackpath.WAFActionBlock {
+			blocked++
 		}
+	}
+	fmt.Printf("[WAF] %d requests in the last hour, %d blocked\n", len(requests), blocked)
+	fmt.Println()
+
+	displayWAFPolicy(ctx, client, d)
+}
 
-		s.Stop()
+// displayPlan compares an existing deployment of the project with what the
+// demo would deploy and echos what differs. The workload is compared with the
+// cities given on the command line, or with the default locations since
+// -suggest-nearby only suggests nearby ones while deploying. Only lookups are
+// made.
+func displayPlan(ctx context.Context, client *stackpath.Client, config *Config, opts deployOptions) {
+	s, t := startSpinner("Comparing the project deployment with the demo's")
+
+	targets := stackpath.DefaultTargets()
+	if len(opts.cityCodes) > 0 {
+		targets = stackpath.CityTargets(opts.cityCodes)
+	}
+	for i := range targets {
+		targets[i].ScaleMetric = opts.scaleMetric
+		targets[i].ScaleThreshold = opts.scaleThreshold
+	}
 
-		allInstancesRunning := true
-		for i, instance := range instances {
-			_, found := instanceStatus[instance.Name]
+	desired := stackpath.NewDesiredDeployment(config.StackSlug, config.DomainName, config.ProjectSubDomain)
+	desired.Workload = workloadSpec(targets, opts)
 
-			if !found || instanceStatus[instance.Name] != instance.Phase {
-				if i == 0 {
-					fmt.Println()
-				}
+	diff, err := client.DiffDeployment(ctx, desired)
+	if err != nil {
+		donef("Error comparing the project deployment: %s", err)
+	}
 
-				fmt.Printf("| Instance \"%s\" is %s\n", instance.Name, strings.ToLower(instance.Phase))
-				instanceStatus[instance.Name] = instance.Phase
+	if diff.Empty() {
+		stopSpinner(s, t, "Done: the deployment is up to date", false)
+		return
+	}
+
+	stopSpinner(s, t, "Done", false)
+
+	sections := []struct {
+		name  string
+		diffs []stackpath.FieldDiff
+	}{
+		{"Compute workload", diff.Workload},
+		{"CDN and WAF site", diff.Site},
+		{"DNS", diff.DNS},
+		{"WAF rules", diff.WAF},
+	}
+	for _, section := range sections {
+		if len(section.diffs) == 0 {
+			continue
+		}
+
+		fmt.Printf("%s:\n", section.name)
+		for _, fieldDiff := range section.diffs {
+			switch {
+			case fieldDiff.Live == "":
+				fmt.Printf("| + %s: %s\n", fieldDiff.Field, fieldDiff.Desired)
+			case fieldDiff.Desired == "":
+				fmt.Printf("| - %s: %s\n", fieldDiff.Field, fieldDiff.Live)
+			default:
+				fmt.Printf("| ~ %s: %s -> %s\n", fieldDiff.Field, fieldDiff.Live, fieldDiff.Desired)
 			}
+		}
+		fmt.Println()
+	}
+}
+
+// teardownDeployment finds an existing deployment of the project by name and
+// deletes what it provisioned in dependency order: the project's DNS CNAME,
+// the demo WAF rules, the site along with its SSL certificate, then the
+// compute workload. Resources that are already gone are skipped.
+func teardownDeployment(ctx context.Context, client *stackpath.Client, config *Config) {
+	s, t := startSpinner("Finding the project deployment")
+
+	d := findProjectDeployment(ctx, client, config)
+	if d.Stack == nil || (d.Domain == nil && d.Site == nil && d.Workload == nil) {
+		stopSpinner(s, t, "Done: nothing to tear down", false)
+		return
+	}
+
+	stopSpinner(s, t, "Done", false)
+
+	var err error
+	if d.Domain != nil {
+		hostname := d.Hostname()
+		s, t = startSpinner(fmt.Sprintf("Deleting the project DNS record: \"%s\"", hostname))
+		records, err := client.ListDNSRecords(ctx, d.Stack, d.Domain)
+		if err != nil {
+			donef("Error listing DNS records: %s", err)
+		}
 
-			if instance.Phase != "RUNNING" {
-				allInstancesRunning = false
+		// Only the project's CNAME is the demo's. Other records on the same
+		// name, like TXT verification records, are left alone.
+		deleted := 0
+		for _, record := range records {
+			if record.Type == stackpath.DNSRecordTypeCNAME && strings.EqualFold(record.Name, d.SubDomain) {
+				err = client.DeleteDNSRecord(ctx, d.Stack, d.Domain, record.ID)
+				if err != nil {
+					donef("Error deleting DNS record %s: %s", record.ID, err)
+				}
+				deleted++
 			}
 		}
-		if allInstancesRunning && len(instances) >= 3 {
-			break
+		stopSpinner(s, t, fmt.Sprintf("Done: deleted %d records", deleted), false)
+	}
+
+	if d.Site != nil {
+		s, t = startSpinner("Deleting the demo WAF rules")
+		deleted, err := client.DeleteDemoWAFRules(ctx, d.Stack, d.Site)
+		if err != nil {
+			donef("Error deleting WAF rules: %s", err)
 		}
+		stopSpinner(s, t, fmt.Sprintf("Done: deleted %d rules", deleted), false)
 
-		time.Sleep(time.Second)
+		s, t = startSpinner("Deleting the CDN and WAF site and its SSL certificate")
+		err = client.DeleteSite(ctx, d.Stack, d.Site)
+		if err != nil {
+			donef("Error deleting site %s: %s", d.Site.ID, err)
+		}
+		stopSpinner(s, t, fmt.Sprintf("Done: deleted site \"%s\"", d.Site.ID), false)
 	}
 
-	fmt.Println("| Done")
-	fmt.Printf("└ Took %v\n\n", time.Now().Sub(t))
-	_, _ = bufio.NewReader(os.Stdin).ReadString('\n')
+	if d.Workload != nil {
+		s, t = startSpinner("Deleting the Edge Compute workload")
+		err = client.DeleteWorkload(ctx, d.Stack, d.Workload)
+		if err != nil {
+			donef("Error deleting workload \"%s\": %s", d.Workload.Name, err)
+		}
+		stopSpinner(s, t, fmt.Sprintf("Done: deleted workload \"%s\"", d.Workload.Name), false)
+	}
 }
 
-// findDeliveryDomain looks for `site`'s delivery domain, also called an edge
-// address, and populates it in `deliveryDomain`. The delivery domain is used as
-// a DNS CNAME target for the project's subdomain.
-func findDeliveryDomain() {
-	var err error
-	s, t := startSpinner("Locating the site's delivery domain")
+// restartWorkloadInstance finds an existing deployment of the project by name
+// and restarts one of its compute workload's instances.
+func restartWorkloadInstance(ctx context.Context, client *stackpath.Client, config *Config, name string) {
+	s, t := startSpinner("Restarting instance " + name)
+
+	d := findProjectDeployment(ctx, client, config)
+	if d.Workload == nil {
+		donef("Error: compute workload not found")
+	}
 
-	deliveryDomain, err = client.FindSiteDeliveryDomain(stack, site)
+	err := client.RestartInstance(ctx, d.Stack, d.Workload, name)
+	var notRunning *stackpath.InstanceNotRunningError
+	if errors.As(err, &notRunning) {
+		donef("Error: %s. Try again once it's running.", err)
+	}
 	if err != nil {
-		donef("Error locating the site's delivery domain: %s", err)
+		donef("Error restarting instance %s: %s", name, err)
+	}
+
+	stopSpinner(s, t, "Done", false)
+}
+
+// cpuGauge renders a CPU utilization percentage as a compact ten step gauge,
+// e.g. "cpu [####------] 42%".
+func cpuGauge(percent float64) string {
+	steps := int(math.Round(percent / 10))
+	if steps < 0 {
+		steps = 0
+	}
+	if steps > 10 {
+		steps = 10
 	}
 
-	stopSpinner(s, t, fmt.Sprintf("Done: found the delivery domain \"%s\"", deliveryDomain), true)
+	return fmt.Sprintf("cpu [%s%s] %.0f%%", strings.Repeat("#", steps), strings.Repeat("-", 10-steps), percent)
 }
 
-// setDNSCNAMERecods creates the project's DNS CNAME record, using to the site's
-// delivery domain as the target.
-func setDNSCNAMERecord() {
-	s, t := startSpinner(fmt.Sprintf("Creating the project DNS record: \"%s.%s\"", ProjectSubDomain, DomainName))
+// writeMetricsSnapshot writes the deployment's current metrics to a file in
+// Prometheus text exposition format.
+func writeMetricsSnapshot(ctx context.Context, client *stackpath.Client, path string, d *stackpath.Deployment) {
+	s, t := startSpinner("Writing a metrics snapshot to " + path)
 
-	err := client.SetDNSCNAME(stack, domain, ProjectSubDomain, deliveryDomain)
+	f, err := os.Create(path)
 	if err != nil {
-		donef("Error creating project DNS CNAME: %s", err)
+		donef("Error creating the metrics snapshot: %s", err)
 	}
 
-	stopSpinner(s, t, "Done", true)
-}
+	err = client.WriteMetricsSnapshot(ctx, f, d)
+	if err != nil {
+		_ = f.Close()
+		donef("Error writing the metrics snapshot: %s", err)
+	}
 
-// provisionSSLCertificate requests an SSL certificate on `site`.
-func provisionSSLCertificate() {
-	s, t := startSpinner("Creating an SSL certificate")
+	err = f.Close()
+	if err != nil {
+		donef("Error writing the metrics snapshot: %s", err)
+	}
 
-	err := client.RequestFreeSSLCert(stack, site)
+	stopSpinner(s, t, "Done", false)
+}
+
+// displayCertificateExpiry echos how long until the deployment site's SSL
+// certificate renews.
+func displayCertificateExpiry(ctx context.Context, client *stackpath.Client, d *stackpath.Deployment) {
+	days, err := client.CertificateDaysUntilExpiry(ctx, d.Stack, d.Site)
 	if err != nil {
-		donef("Error creating an SSL certificate: %s", err)
+		fmt.Printf("[SSL] %s: %s\n", d.Hostname(), err)
+		return
 	}
 
-	stopSpinner(s, t, "Done", true)
+	fmt.Printf("[SSL] %s: certificate renews in %d days\n", d.Hostname(), days)
 }
 
-// createWAFRules creates a demo block rule on `site`.
-func createWAFRules() {
-	s, t := startSpinner("Creating custom WAF rules")
+// displayWAFStats echos a headline of the requests the deployment site's WAF
+// blocked since monitoring started.
+func displayWAFStats(d *stackpath.Deployment, stats *stackpath.WAFStats) {
+	countries := "countries"
+	if len(stats.BlockedByCountry) == 1 {
+		countries = "country"
+	}
 
-	err := client.CreateDemoWAFRules(stack, site)
-	if err != nil {
-		donef("Error creating custom WAF rule: %s", err)
+	fmt.Printf(
+		"The WAF blocked %d of %d requests to %s from %d %s\n",
+		stats.Blocked,
+		stats.Total,
+		d.Hostname(),
+		len(stats.BlockedByCountry),
+		countries,
+	)
+}
+
+// displayTopCountries echos the countries that sent the most requests to the
+// deployment's site since monitoring started, given the number of requests
+// from each country.
+func displayTopCountries(d *stackpath.Deployment, distribution map[string]int) {
+	const topCountries = 5
+
+	if len(distribution) == 0 {
+		return
+	}
+
+	countries := make([]string, 0, len(distribution))
+	for country := range distribution {
+		countries = append(countries, country)
+	}
+	sort.Slice(countries, func(i, j int) bool {
+		if distribution[countries[i]] != distribution[countries[j]] {
+			return distribution[countries[i]] > distribution[countries[j]]
+		}
+
+		return countries[i] < countries[j]
+	})
+	if len(countries) > topCountries {
+		countries = countries[:topCountries]
 	}
 
-	stopSpinner(s, t, "Done", true)
+	fmt.Printf("Top countries requesting %s:\n", d.Hostname())
+	for _, country := range countries {
+		fmt.Printf("| %s: %d requests\n", country, distribution[country])
+	}
 }
 
-// displayWAFRequests polls the WAF for a request log once a second and sends
-// formatted logs to STDOUT.
-func displayWAFRequests() {
-	mostRecentRequestTime := time.Now().Add(time.Hour * 24 * -30)
+// wafRequestOverlap is how far before the most recent WAF request each poll
+// starts from. Requests that share a timestamp with it, or that the WAF logs
+// late, are picked up by the next poll and de-duplicated by ID.
+const wafRequestOverlap = 5 * time.Second
+
+// maxSeenWAFRequests bounds how many WAF request IDs are remembered to
+// de-duplicate overlapping polls.
+const maxSeenWAFRequests = 10000
+
+// displayWAFRequests polls the deployment site's WAF for a request log once a
+// second and sends formatted logs to STDOUT until ctx is cancelled. Each
+// request is displayed exactly once.
+func displayWAFRequests(ctx context.Context, client *stackpath.Client, d *stackpath.Deployment) {
+	mostRecentRequestTime := client.ServerNow().Add(time.Hour * 24 * -30)
+	since := mostRecentRequestTime
+	seen := newSeenIDs(maxSeenWAFRequests)
 
 	for {
-		requests, err := client.GetWAFRequests(stack, site, mostRecentRequestTime)
+		until := client.ServerNow()
+		requests, through, err := client.GetWAFRequestsFiltered(
+			ctx,
+			d.Stack,
+			d.Site,
+			since,
+			until,
+			stackpath.WAFRequestFilter{Action: WAFRequestsAction},
+		)
 		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
 			donef("Error getting WAF requests: %s", err)
 		}
 
-		for i, request := range requests {
+		for _, request := range requests {
+			if request.RequestTime.After(mostRecentRequestTime) {
+				mostRecentRequestTime = request.RequestTime
+			}
+			if request.ID != "" && !seen.add(request.ID) {
+				continue
+			}
+
 			fullRuleName := ""
 			if request.RuleName != "" {
 				fullRuleName = ": " + request.RuleName
 			}
 
-			fmt.Printf(
-				"[WAF %s%s] %s %s %s - %s (%s) - %s\n",
-				request.Action,
-				fullRuleName,
-				request.RequestTime,
-				request.Method,
-				request.Path,
-				request.ClientIP,
-				request.Country,
-				request.UserAgent,
-			)
-
-			if i == len(requests)-1 {
-				mostRecentRequestTime = request.RequestTime.Add(time.Second)
+			if jsonOutput != nil {
+				emitJSON(wafRequestEvent{Type: "waf_request", WAFRequest: request})
+			} else {
+				fmt.Printf(
+					"[WAF %s%s] %s %s %s - %s (%s) - %s\n",
+					request.Action,
+					fullRuleName,
+					request.RequestTime,
+					request.Method,
+					request.Path,
+					request.ClientIP,
+					request.Country,
+					request.UserAgent,
+				)
 			}
 		}
 
-		time.Sleep(time.Second)
+		// A window too busy to read in one poll is only read up to through,
+		// so continue from there.
+		if through.Before(until) {
+			since = through
+		} else {
+			since = mostRecentRequestTime.Add(-wafRequestOverlap)
+		}
+
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// displaySiteAnalytics echos a summary of the deployment site's CDN traffic
+// every SiteAnalyticsInterval until ctx is cancelled.
+func displaySiteAnalytics(ctx context.Context, client *stackpath.Client, d *stackpath.Deployment) {
+	for {
+		select {
+		case <-time.After(SiteAnalyticsInterval):
+		case <-ctx.Done():
+			return
+		}
+
+		until := client.ServerNow()
+		metrics, err := client.GetSiteAnalytics(
+			ctx,
+			d.Stack,
+			d.Site,
+			until.Add(-SiteAnalyticsInterval),
+			until,
+			stackpath.SiteMetricGranularity5Minutes,
+		)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			fmt.Printf("[CDN] Error getting site analytics: %s\n", err)
+			continue
+		}
+
+		// Weigh each bucket's cache hit ratio by its requests.
+		var requests, bandwidth int64
+		cacheHits := 0.0
+		for _, metric := range metrics {
+			requests += metric.Requests
+			bandwidth += metric.BandwidthBytes
+			cacheHits += metric.CacheHitRatio * float64(metric.Requests)
+		}
+
+		cacheHitRatio := 0.0
+		if requests > 0 {
+			cacheHitRatio = cacheHits / float64(requests)
+		}
+
+		fmt.Printf(
+			"[CDN] last %s: %s requests, %.1f MB, %.0f%% cache hit\n",
+			strings.TrimSuffix(SiteAnalyticsInterval.String(), "0s"),
+			abbreviateCount(requests),
+			float64(bandwidth)/1000/1000,
+			cacheHitRatio*100,
+		)
+	}
+}
+
+// abbreviateCount formats a count like 1234 as 1.2k.
+func abbreviateCount(n int64) string {
+	switch {
+	case n >= 1000*1000:
+		return fmt.Sprintf("%.1fM", float64(n)/1000/1000)
+	case n >= 1000:
+		return fmt.Sprintf("%.1fk", float64(n)/1000)
+	}
+
+	return strconv.FormatInt(n, 10)
+}
+
+// displayScalingEvents echos a line every time one of the deployment
+// workload's targets scales up or down, until ctx is cancelled.
+func displayScalingEvents(ctx context.Context, client *stackpath.Client, d *stackpath.Deployment) {
+	events, err := client.StreamScalingEvents(ctx, d.Stack, d.Workload)
+	if err != nil {
+		fmt.Printf("[Scaling] Error watching the workload's targets: %s\n", err)
+		return
+	}
+
+	for event := range events {
+		direction := "down"
+		if event.ScaledUp() {
+			direction = "up"
+		}
+
+		fmt.Printf(
+			"[Scaling] %s scaling %s %s to %d replicas\n",
+			event.Time.Format(time.RFC3339),
+			direction,
+			strings.Join(event.CityCodes, ", "),
+			event.To,
+		)
 	}
 }
 
-// displayInstanceLogs polls the workload for instances once a second and loads
-// the instance's console logs, echo'ing every log line to STDOUT.
-func displayInstanceLogs() {
-	mostRecentRequestTime := time.Now().Add(time.Hour * 24 * -30)
+// displayInstanceLogs polls the deployment's workload for instances once a
+// second and loads the instance's console logs, echo'ing every log line to
+// STDOUT until ctx is cancelled.
+func displayInstanceLogs(ctx context.Context, client *stackpath.Client, d *stackpath.Deployment) {
+	startTime := client.ServerNow().Add(time.Hour * 24 * -30)
 	instanceStatus := make(map[string]string, 0)
+	limiters := make(map[string]*logLimiter, 0)
 	i := 0
 
+	// labels is a mapping of instance name -> the city code its logs are
+	// labelled with. Instances whose city can't be resolved are labelled by
+	// name.
+	labels := make(map[string]string, 0)
+	label := func(name string) string {
+		if l, found := labels[name]; found {
+			return l
+		}
+
+		return name
+	}
+
+	// Each poll overlaps the previous one and skips lines an instance already
+	// returned, so lines logged while the previous poll was in flight aren't
+	// lost.
+	cursors := newLogCursors()
+
 	for {
-		instances, err := client.GetInstances(stack, workload)
+		instances, err := client.GetInstances(ctx, d.Stack, d.Workload)
 		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
 			donef("Error querying workload instances: %s", err)
 		}
 
 		for _, instance := range instances {
+			_, cityCode := stackpath.ResolveInstanceTarget(&instance, d.Targets)
+			if cityCode != "" {
+				labels[instance.Name] = cityCode
+			}
+
 			// Look for status changes
 			//
 			// On first run populate the instance status map, so we can watch
@@ -372,55 +1394,284 @@ func displayInstanceLogs() {
 					instanceStatus[instance.Name] = instance.Phase
 				}
 			}
+		}
 
-			// Get and echo the instance's logs.
-			logs, err := client.GetInstanceLogs(stack, workload, &instance, mostRecentRequestTime)
-			if err != nil {
-				donef("Error querying %s instance logs: %s", instance.Name, err)
+		// Get and echo every instance's logs. Only echo the tail of each
+		// instance's backlog on the first poll.
+		tailLines := 0
+		if i == 0 {
+			tailLines = StartupLogLines
+		}
+		logs, err := client.GetWorkloadLogs(ctx, d.Stack, d.Workload, cursors.poll(startTime, client.ServerNow()), tailLines)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
 			}
+			donef("Error querying workload logs: %s", err)
+		}
 
-			scanner := bufio.NewScanner(strings.NewReader(logs))
+		suppressed := make(map[string]int, 0)
+		for _, line := range cursors.newLines(logs) {
+			limiter, found := limiters[line.Instance]
+			if !found {
+				limiter = newLogLimiter(MaxLogLinesPerSecond)
+				limiters[line.Instance] = limiter
+			}
 
-			for scanner.Scan() {
-				fmt.Printf("[%s] %s\n", instance.Name, scanner.Text())
+			if !limiter.allow() {
+				suppressed[line.Instance]++
+				continue
+			}
+
+			if jsonOutput != nil {
+				event := instanceLogEvent{
+					Type:     "instance_log",
+					Instance: line.Instance,
+					CityCode: labels[line.Instance],
+					Text:     line.Text,
+				}
+				if !line.Timestamp.IsZero() {
+					event.Timestamp = &line.Timestamp
+				}
+				emitJSON(event)
+			} else if line.Timestamp.IsZero() {
+				fmt.Printf("[%s] %s\n", label(line.Instance), line.Text)
+			} else {
+				fmt.Printf("[%s] %s %s\n", label(line.Instance), line.Timestamp.Format(time.RFC3339Nano), line.Text)
 			}
 		}
 
+		for name, count := range suppressed {
+			fmt.Printf("[%s] ... (suppressed %d lines)\n", label(name), count)
+		}
+
 		// Check for instances that went away. They'd show up in the map but not
-		// in the retrieved instance list.
+		// in the retrieved instance list. Confirm with a direct lookup, since
+		// the list may be mid-update while instances are rescheduled.
 		if i != 0 {
 			newInstanceStatus := make(map[string]string, 0)
+			for _, instance := range instances {
+				newInstanceStatus[instance.Name] = instance.Phase
+			}
 
-			for checkName, _ := range instanceStatus {
-				found := false
+			for checkName, phase := range instanceStatus {
+				if _, found := newInstanceStatus[checkName]; found {
+					continue
+				}
 
-				for _, instance := range instances {
-					if checkName == instance.Name {
-						found = true
-						newInstanceStatus[checkName] = instance.Phase
+				instance, err := client.GetInstance(ctx, d.Stack, d.Workload, checkName)
+				if err != nil {
+					if ctx.Err() != nil {
+						return
 					}
+					donef("Error querying workload instance %s: %s", checkName, err)
 				}
 
-				if !found {
-					fmt.Printf("[%s] instance went away\n", checkName)
+				if instance != nil {
+					if instance.Phase != phase {
+						fmt.Printf("[%s] instance is now %s\n", checkName, strings.ToLower(instance.Phase))
+					}
+					newInstanceStatus[checkName] = instance.Phase
+					continue
 				}
+
+				fmt.Printf("[%s] instance went away\n", checkName)
+				delete(limiters, checkName)
+				delete(labels, checkName)
+				cursors.forget(checkName)
 			}
 
 			instanceStatus = newInstanceStatus
 		}
 
 		i++
-		mostRecentRequestTime = time.Now()
-		time.Sleep(time.Second)
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// warnBeforeTokenExpiry checks the StackPath bearer token's expiry every 30
+// seconds and echos a warning once it's within `TokenExpiryWarning` of
+// expiring, until ctx is cancelled. The client refreshes the token before it
+// expires, which is echoed too.
+func warnBeforeTokenExpiry(ctx context.Context, client *stackpath.Client) {
+	warned := false
+	var lastExpiry time.Time
+
+	for {
+		expiry, err := client.TokenExpiry()
+		if err == nil && !lastExpiry.IsZero() && expiry.After(lastExpiry) {
+			fmt.Println("[Auth] The StackPath API token was refreshed")
+			warned = false
+		}
+		if err == nil {
+			lastExpiry = expiry
+		}
+
+		if err == nil && !warned && time.Until(expiry) < TokenExpiryWarning {
+			fmt.Printf("[Auth] The StackPath API token expires in %s and will be refreshed\n", time.Until(expiry).Round(time.Second))
+			warned = true
+		}
+
+		select {
+		case <-time.After(30 * time.Second):
+		case <-ctx.Done():
+			return
+		}
 	}
 }
 
+// logLimiter is a token bucket that limits how many log lines an instance can
+// echo per second.
+type logLimiter struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// newLogLimiter builds a logLimiter that allows up to `rate` lines per second.
+// A rate of 0 allows every line.
+func newLogLimiter(rate int) *logLimiter {
+	return &logLimiter{
+		rate:   float64(rate),
+		tokens: float64(rate),
+		last:   time.Now(),
+	}
+}
+
+// allow reports whether another log line may be echoed, refilling the bucket
+// for the time passed since the last call.
+func (l *logLimiter) allow() bool {
+	if l.rate == 0 {
+		return true
+	}
+
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+
+	if l.tokens < 1 {
+		return false
+	}
+
+	l.tokens--
+	return true
+}
+
+// seenIDs is a set of the most recently seen IDs. Once it holds `size` IDs,
+// adding another forgets the oldest.
+type seenIDs struct {
+	ids   map[string]struct{}
+	order []string
+	next  int
+}
+
+// newSeenIDs builds an empty seenIDs that remembers up to `size` IDs.
+func newSeenIDs(size int) *seenIDs {
+	return &seenIDs{
+		ids:   make(map[string]struct{}, size),
+		order: make([]string, 0, size),
+	}
+}
+
+// add records an ID, reporting whether it wasn't already in the set.
+func (s *seenIDs) add(id string) bool {
+	if _, found := s.ids[id]; found {
+		return false
+	}
+
+	if len(s.order) < cap(s.order) {
+		s.order = append(s.order, id)
+	} else {
+		delete(s.ids, s.order[s.next])
+		s.order[s.next] = id
+		s.next = (s.next + 1) % len(s.order)
+	}
+	s.ids[id] = struct{}{}
+
+	return true
+}
+
+// logPollOverlap is how far before the previous log poll each poll reaches
+// back, to pick up lines logged while the previous poll was in flight.
+const logPollOverlap = 10 * time.Second
+
+// logCursors tracks the timestamp of the last log line returned for each
+// instance, so overlapping log polls only echo each line once.
+type logCursors struct {
+	last map[string]time.Time
+
+	// polled is when the previous poll was made, or zero before the first
+	// poll.
+	polled time.Time
+}
+
+// newLogCursors builds logCursors that haven't seen any log lines.
+func newLogCursors() *logCursors {
+	return &logCursors{last: make(map[string]time.Time)}
+}
+
+// poll records a log poll made at now and returns the time to request logs
+// since: logPollOverlap before the previous poll, since every line before
+// that was already returned. Instances are queried together, so bounding the
+// window this way keeps an instance that stops logging from holding every poll
+// back. The first poll is since fallback.
+func (c *logCursors) poll(fallback, now time.Time) time.Time {
+	previous := c.polled
+	c.polled = now
+	if previous.IsZero() {
+		return fallback
+	}
+
+	return previous.Add(-logPollOverlap)
+}
+
+// newLines returns the lines that are newer than their instance's last log
+// line and moves the instances' cursors past them. Lines without a timestamp
+// continue the instance's previous line, so they're only returned if that line
+// was.
+func (c *logCursors) newLines(lines []stackpath.InstanceLogLine) []stackpath.InstanceLogLine {
+	var newLines []stackpath.InstanceLogLine
+	echoing := make(map[string]bool, 0)
+	for _, line := range lines {
+		if line.Timestamp.IsZero() {
+			if !echoing[line.Instance] {
+				continue
+			}
+		} else {
+			last, found := c.last[line.Instance]
+			echoing[line.Instance] = !found || line.Timestamp.After(last)
+			if !echoing[line.Instance] {
+				continue
+			}
+			c.last[line.Instance] = line.Timestamp
+		}
+
+		newLines = append(newLines, line)
+	}
+
+	return newLines
+}
+
+// forget drops an instance's cursor once it goes away.
+func (c *logCursors) forget(instance string) {
+	delete(c.last, instance)
+}
+
 // startSpinner wraps spinner.New() with a common charset and duration, sets a
 // spinner prefix, and starts the spinner. It returns the spinner and a
 // time.Time object so stopSpinner() can stop the spinner and calculate a time
 // duration later.
 func startSpinner(prefix string) (*spinner.Spinner, time.Time) {
-	s := spinner.New(spinner.CharSets[9], 100*time.Millisecond)
+	// Spinners write to os.Stdout as it is now rather than the spinner
+	// package's default, since it's swapped for STDERR in JSON output mode.
+	s := spinner.New(spinner.CharSets[9], 100*time.Millisecond, spinner.WithWriter(os.Stdout))
 	s.Prefix = prefix + " "
 	s.Start()
 
@@ -428,18 +1679,31 @@ func startSpinner(prefix string) (*spinner.Spinner, time.Time) {
 }
 
 // stopSpinner stops a *spinner.Spinner created by startSpinner() and echos a
-// message and time duration.
+// message and time duration. It waits for [Enter] afterwards if pauseAtTheEnd
+// is set, unless the program is running non-interactively.
 func stopSpinner(s *spinner.Spinner, t time.Time, message string, pauseAtTheEnd bool) {
 	s.Stop()
 	fmt.Printf("\n| %s\n", message)
 	fmt.Printf("└ Took %s\n\n", time.Now().Sub(t))
 
 	if pauseAtTheEnd {
-		fmt.Println("Press [Enter] to continue.")
-		_, _ = bufio.NewReader(os.Stdin).ReadString('\n')
+		promptEnter(bufio.NewReader(os.Stdin), "Press [Enter] to continue.")
 	}
 }
 
+// promptEnter echos a prompt, if there is one, and waits for [Enter] on STDIN.
+// It returns right away when the program is running non-interactively.
+func promptEnter(reader *bufio.Reader, prompt string) {
+	if nonInteractive {
+		return
+	}
+
+	if prompt != "" {
+		fmt.Println(prompt)
+	}
+	_, _ = reader.ReadString('\n')
+}
+
 // donef is a wrapper to exit the program with the exit code 1 and a message
 func donef(format string, a ...interface{}) {
 	fmt.Printf(format+"\n", a...)
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"reflect"
+	"stackpath-demonstration-app/pkg/stackpath"
+	"testing"
+	"time"
+)
+
+func TestSeenIDs(t *testing.T) {
+	seen := newSeenIDs(3)
+
+	// Each poll overlaps the previous one, so it returns some of the same
+	// requests again.
+	polls := []struct {
+		ids     []string
+		wantNew []string
+	}{
+		{ids: []string{"a", "b"}, wantNew: []string{"a", "b"}},
+		{ids: []string{"b", "c"}, wantNew: []string{"c"}},
+		{ids: []string{"c", "d"}, wantNew: []string{"d"}},
+		// Remembering d evicted a, the oldest ID, so it's new again.
+		{ids: []string{"b", "c", "d", "a"}, wantNew: []string{"a"}},
+	}
+
+	for i, poll := range polls {
+		var got []string
+		for _, id := range poll.ids {
+			if seen.add(id) {
+				got = append(got, id)
+			}
+		}
+
+		if len(got) != len(poll.wantNew) {
+			t.Fatalf("poll %d: expected new IDs %q, got %q", i, poll.wantNew, got)
+		}
+		for j := range got {
+			if got[j] != poll.wantNew[j] {
+				t.Fatalf("poll %d: expected new IDs %q, got %q", i, poll.wantNew, got)
+			}
+		}
+	}
+}
+
+func TestLogCursors(t *testing.T) {
+	startTime := time.Date(2021, 3, 2, 15, 0, 0, 0, time.UTC)
+	at := func(seconds float64) time.Time {
+		return startTime.Add(time.Duration(seconds * float64(time.Second)))
+	}
+
+	cursors := newLogCursors()
+	if since := cursors.poll(startTime, at(5)); !since.Equal(startTime) {
+		t.Fatalf("expected the first poll since %s, got %s", startTime, since)
+	}
+
+	first := []stackpath.InstanceLogLine{
+		{Instance: "dfw", Timestamp: at(1), Text: "GET /"},
+		{Instance: "fra", Timestamp: at(2), Text: "GET /"},
+		{Instance: "dfw", Timestamp: at(3), Text: "GET /get"},
+		{Instance: "dfw", Text: "  continued"},
+	}
+	if got := cursors.newLines(first); !reflect.DeepEqual(got, first) {
+		t.Fatalf("expected every line of the first poll, got %+v", got)
+	}
+
+	// The next poll overlaps the first, so it returns the first poll's lines
+	// again. fra logged a line while the first poll was in flight, timestamped
+	// before the first poll's last line.
+	if since := cursors.poll(startTime, at(6)); !since.Equal(at(-5)) {
+		t.Fatalf("expected the second poll since %s, got %s", at(-5), since)
+	}
+
+	second := []stackpath.InstanceLogLine{
+		{Instance: "dfw", Timestamp: at(1), Text: "GET /"},
+		{Instance: "fra", Timestamp: at(2), Text: "GET /"},
+		{Instance: "fra", Timestamp: at(2.5), Text: "GET /late"},
+		{Instance: "dfw", Timestamp: at(3), Text: "GET /get"},
+		{Instance: "dfw", Text: "  continued"},
+		{Instance: "dfw", Timestamp: at(6), Text: "GET /ip"},
+		{Instance: "dfw", Text: "  continued again"},
+	}
+	want := []stackpath.InstanceLogLine{second[2], second[5], second[6]}
+	if got := cursors.newLines(second); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected only the new lines %+v, got %+v", want, got)
+	}
+}
+
+func TestLogCursorsQuietInstance(t *testing.T) {
+	startTime := time.Date(2021, 3, 2, 15, 0, 0, 0, time.UTC)
+	at := func(seconds int) time.Time {
+		return startTime.Add(time.Duration(seconds) * time.Second)
+	}
+
+	cursors := newLogCursors()
+	cursors.poll(startTime, at(0))
+	cursors.newLines([]stackpath.InstanceLogLine{
+		{Instance: "fra", Timestamp: at(0), Text: "starting up"},
+		{Instance: "dfw", Timestamp: at(0), Text: "starting up"},
+	})
+
+	// fra stays quiet while dfw keeps logging. fra's last line doesn't hold
+	// the polls back.
+	for poll := 1; poll <= 100; poll++ {
+		since := cursors.poll(startTime, at(poll))
+		if want := at(poll - 1).Add(-logPollOverlap); !since.Equal(want) {
+			t.Fatalf("poll %d: expected logs since %s, got %s", poll, want, since)
+		}
+
+		lines := []stackpath.InstanceLogLine{
+			{Instance: "dfw", Timestamp: at(poll - 1), Text: "GET /"},
+			{Instance: "dfw", Timestamp: at(poll), Text: "GET /"},
+		}
+		if got := cursors.newLines(lines); len(got) != 1 || !got[0].Timestamp.Equal(at(poll)) {
+			t.Fatalf("poll %d: expected only dfw's new line, got %+v", poll, got)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"stackpath-demonstration-app/pkg/stackpath"
+	"sync"
+	"time"
+)
+
+// Output formats selected with the -output flag.
+const (
+	// OutputText is the default decorative console output.
+	OutputText = "text"
+
+	// OutputJSON emits a JSON document describing the deployment once it's
+	// provisioned, then a newline-delimited JSON event for every WAF request
+	// and instance log line while monitoring.
+	OutputJSON = "json"
+)
+
+// jsonOutput encodes JSON documents to the real STDOUT. It's nil unless the
+// JSON output format is selected. jsonOutputMu serializes encoding since the
+// monitors run concurrently.
+var (
+	jsonOutput   *json.Encoder
+	jsonOutputMu sync.Mutex
+)
+
+// enableJSONOutput keeps STDOUT for JSON documents and sends the rest of the
+// console output, spinners and prompts included, to STDERR instead.
+func enableJSONOutput() {
+	jsonOutput = json.NewEncoder(os.Stdout)
+	os.Stdout = os.Stderr
+}
+
+// emitJSON writes v to STDOUT as a single line of JSON.
+func emitJSON(v interface{}) {
+	jsonOutputMu.Lock()
+	defer jsonOutputMu.Unlock()
+
+	err := jsonOutput.Encode(v)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing JSON output: %s\n", err)
+	}
+}
+
+// deploymentReport describes every resource a deployment provisioned.
+type deploymentReport struct {
+	Stack          *stackpath.Stack   `json:"stack"`
+	Workload       *workloadReport    `json:"workload"`
+	SiteID         string             `json:"siteId"`
+	DeliveryDomain string             `json:"deliveryDomain"`
+	DNSRecord      *dnsRecordReport   `json:"dnsRecord"`
+	Certificate    *certificateReport `json:"certificate"`
+}
+
+type workloadReport struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	AnycastIP string `json:"anycastIp"`
+}
+
+type dnsRecordReport struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+	Data string `json:"data"`
+	TTL  int    `json:"ttl"`
+}
+
+type certificateReport struct {
+	ID             string    `json:"id"`
+	Status         string    `json:"status"`
+	ExpirationDate time.Time `json:"expirationDate"`
+}
+
+// emitDeploymentReport looks up the deployment's SSL certificate and emits a
+// deploymentReport for it.
+func emitDeploymentReport(ctx context.Context, client *stackpath.Client, d *stackpath.Deployment) {
+	report := deploymentReport{
+		Stack: d.Stack,
+		Workload: &workloadReport{
+			ID:        d.Workload.ID,
+			Name:      d.Workload.Name,
+			AnycastIP: d.Workload.AnycastIP,
+		},
+		SiteID:         d.Site.ID,
+		DeliveryDomain: d.DeliveryDomain,
+		DNSRecord: &dnsRecordReport{
+			Type: stackpath.DNSRecordTypeCNAME,
+			Name: d.Hostname(),
+			Data: d.DeliveryDomain,
+			TTL:  DNSRecordTTL,
+		},
+	}
+
+	cert, err := client.GetSSLCertStatus(ctx, d.Stack, d.Site)
+	if err != nil {
+		donef("Error checking the SSL certificate status: %s", err)
+	}
+	if cert != nil {
+		report.Certificate = &certificateReport{
+			ID:             cert.ID,
+			Status:         cert.Status,
+			ExpirationDate: cert.ExpirationDate,
+		}
+	}
+
+	emitJSON(report)
+}
+
+// wafRequestEvent is emitted for every WAF request while monitoring.
+type wafRequestEvent struct {
+	Type string `json:"type"`
+	stackpath.WAFRequest
+}
+
+// instanceLogEvent is emitted for every instance log line while monitoring. A
+// nil Timestamp means the line didn't have one.
+type instanceLogEvent struct {
+	Type      string     `json:"type"`
+	Instance  string     `json:"instance"`
+	CityCode  string     `json:"cityCode,omitempty"`
+	Timestamp *time.Time `json:"timestamp,omitempty"`
+	Text      string     `json:"text"`
+}
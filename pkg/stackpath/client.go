@@ -3,80 +3,434 @@ package stackpath
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Client wraps http.Client with a StackPath bearer JWT and has a number of
 // repository-like functions to assist in making StackPath API calls.
 type Client struct {
-	accessToken string
-	c           http.Client
+	accessToken     string
+	c               *http.Client
+	requestIDHeader string
+
+	// timeout is the request timeout set with WithTimeout(), if timeoutSet.
+	timeout    time.Duration
+	timeoutSet bool
+
+	// baseURL is the StackPath API gateway's URL, without a trailing slash.
+	baseURL string
+
+	// apiClientID and apiClientSecret are kept to re-authenticate before the
+	// bearer token expires at tokenExpiresAt. tokenMu guards the token and its
+	// expiry.
+	apiClientID     string
+	apiClientSecret string
+	tokenExpiresAt  time.Time
+	tokenMu         sync.Mutex
+
+	// authMaxAttempts is how many times the token request is attempted before
+	// NewClientWithOptions() gives up.
+	authMaxAttempts int
+
+	// retryPolicy controls how transient failures are retried.
+	retryPolicy RetryPolicy
+
+	// dumpDir is the directory response bodies are written to, or empty to
+	// not write them.
+	dumpDir string
+
+	// logger is called with every request, or nil to not log requests.
+	logger Logger
+
+	// interceptors wrap every request, outermost first.
+	interceptors []Interceptor
+
+	// etags caches the most recent ETag and body of GET responses, keyed by
+	// URL path, so polling requests can be made conditionally.
+	etags   map[string]cachedResponse
+	etagsMu sync.Mutex
+
+	// workloadLogsUnsupported is set to 1 once the workload-level logs
+	// endpoint fails, so GetWorkloadLogs() goes straight to per-instance logs.
+	workloadLogsUnsupported int32
+
+	// clockSkew is how far StackPath's clock is ahead of the local clock, in
+	// nanoseconds, as measured from the most recent response's Date header.
+	clockSkew int64
+
+	// rateLimit is the rate limit reported by the most recent response.
+	rateLimit   *RateLimit
+	rateLimitMu sync.Mutex
 }
 
+// RateLimit models the API rate limit reported in a response's X-RateLimit-*
+// headers.
+type RateLimit struct {
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+// cachedResponse is a GET response body saved alongside its ETag.
+type cachedResponse struct {
+	url  string
+	etag string
+	body []byte
+}
+
+// Option configures optional Client behavior in NewClientWithOptions().
+type Option func(*Client)
+
 const (
-	userAgent = "forrester-demo-2021"
-	baseURL   = "https://gateway.stackpath.com"
+	userAgent              = "forrester-demo-2021"
+	defaultBaseURL         = "https://gateway.stackpath.com"
+	defaultRequestIDHeader = "X-Request-ID"
+	defaultAuthMaxAttempts = 3
+	authRetryBaseDelay     = time.Second
+	tokenPath              = "/identity/v1/oauth2/token"
+	defaultTimeout         = 30 * time.Second
+
+	// tokenRefreshMargin is how long before the bearer token expires that it's
+	// refreshed.
+	tokenRefreshMargin = 60 * time.Second
 )
 
+// WithBaseURL points the client at another StackPath API gateway, like a
+// staging gateway or a local mock server, instead of the default
+// https://gateway.stackpath.com.
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) {
+		c.baseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+// WithHTTPClient makes the client send requests with the given http.Client, for
+// instance one with custom dial and response timeouts, an instrumented
+// transport, or a shared connection pool. It can't be combined with
+// WithTimeout(); set the timeout on the http.Client instead.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.c = httpClient
+	}
+}
+
+// WithTimeout sets how long a request may take in total, including reading the
+// response body. The default is 30 seconds and 0 means no timeout. It can't be
+// combined with WithHTTPClient().
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = timeout
+		c.timeoutSet = true
+	}
+}
+
+// WithRequestIDHeader sets the name of the request header that carries each
+// request's generated correlation ID. The default is X-Request-ID.
+func WithRequestIDHeader(name string) Option {
+	return func(c *Client) {
+		c.requestIDHeader = name
+	}
+}
+
+// WithAuthMaxAttempts sets how many times the token request is attempted when
+// the client is built, backing off exponentially between attempts. The default
+// is 3. Values less than 1 are treated as 1.
+func WithAuthMaxAttempts(attempts int) Option {
+	return func(c *Client) {
+		c.authMaxAttempts = attempts
+	}
+}
+
 // NewClient builds a new StackPath API client by authenticating the client ID
-// and secret into a bearer token for use in future calls.
+// and secret into a bearer token for use in future calls. The client keeps the
+// ID and secret to transparently refresh the token shortly before it expires.
 //
 // See: https://stackpath.dev/reference/authentication#getaccesstoken
 func NewClient(apiClientID, apiClientSecret string) (*Client, error) {
-	client := &Client{}
+	return NewClientWithOptions(apiClientID, apiClientSecret)
+}
+
+// NewClientWithOptions builds a new StackPath API client like NewClient(),
+// configured with the given options.
+//
+// See: https://stackpath.dev/reference/authentication#getaccesstoken
+func NewClientWithOptions(apiClientID, apiClientSecret string, opts ...Option) (*Client, error) {
+	client := &Client{
+		baseURL:         defaultBaseURL,
+		requestIDHeader: defaultRequestIDHeader,
+		authMaxAttempts: defaultAuthMaxAttempts,
+		apiClientID:     apiClientID,
+		apiClientSecret: apiClientSecret,
+		retryPolicy:     DefaultRetryPolicy(),
+	}
+	for _, opt := range opts {
+		opt(client)
+	}
+
+	if client.c != nil && client.timeoutSet {
+		return nil, fmt.Errorf("WithHTTPClient and WithTimeout can't be used together")
+	}
+	if client.c == nil {
+		client.c = &http.Client{Timeout: defaultTimeout}
+		if client.timeoutSet {
+			client.c.Timeout = client.timeout
+		}
+	}
+
+	if client.authMaxAttempts < 1 {
+		client.authMaxAttempts = 1
+	}
+	if client.retryPolicy.MaxAttempts < 1 {
+		client.retryPolicy.MaxAttempts = 1
+	}
+
+	// A transient failure while authenticating would otherwise abort the
+	// program at startup, so retry with exponential backoff.
+	client.tokenMu.Lock()
+	defer client.tokenMu.Unlock()
+
+	var err error
+	delay := authRetryBaseDelay
+	for attempt := 1; attempt <= client.authMaxAttempts; attempt++ {
+		err = client.authenticate(context.Background())
+		if err == nil {
+			return client, nil
+		}
+
+		// Rejected credentials won't be accepted on a retry.
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode < 500 && apiErr.StatusCode != http.StatusTooManyRequests {
+			return nil, err
+		}
+
+		if attempt < client.authMaxAttempts {
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+
+	return nil, fmt.Errorf("authenticating after %d attempts: %w", client.authMaxAttempts, err)
+}
+
+// authenticate exchanges the client's API client ID and secret for a bearer
+// token and sets it and its expiry on the client. Callers must hold tokenMu.
+//
+// See: https://stackpath.dev/reference/authentication#getaccesstoken
+func (c *Client) authenticate(ctx context.Context) error {
 	reqBody := bytes.NewBuffer([]byte(`{
   "grant_type": "client_credentials",
-  "client_id": "` + apiClientID + `",
-  "client_secret": "` + apiClientSecret + `"
+  "client_id": "` + c.apiClientID + `",
+  "client_secret": "` + c.apiClientSecret + `"
 }`))
-	req, err := http.NewRequest(http.MethodPost, baseURL+"/identity/v1/oauth2/token", reqBody)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+tokenPath, reqBody)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	res, err := client.Do(req)
+	res, err := c.Do(req)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	body, err := ioutil.ReadAll(res.Body)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	err = res.Body.Close()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	authRes := struct {
 		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
 	}{}
 	err = json.Unmarshal(body, &authRes)
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	c.accessToken = authRes.AccessToken
+
+	// A zero expiry means the token isn't refreshed.
+	c.tokenExpiresAt = time.Time{}
+	if authRes.ExpiresIn > 0 {
+		c.tokenExpiresAt = time.Now().Add(time.Duration(authRes.ExpiresIn) * time.Second)
+	}
+
+	return nil
+}
+
+// bearerToken returns the client's bearer token, re-authenticating first if the
+// token expires within tokenRefreshMargin.
+func (c *Client) bearerToken(ctx context.Context) (string, error) {
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+
+	if !c.tokenExpiresAt.IsZero() && time.Until(c.tokenExpiresAt) < tokenRefreshMargin {
+		err := c.authenticate(ctx)
+		if err != nil {
+			return "", fmt.Errorf("refreshing the bearer token: %w", err)
+		}
+	}
+
+	return c.accessToken, nil
+}
+
+// TokenExpiry returns when the client's bearer token expires, read from the
+// JWT's exp claim. The token's signature isn't verified.
+func (c *Client) TokenExpiry() (time.Time, error) {
+	c.tokenMu.Lock()
+	accessToken := c.accessToken
+	c.tokenMu.Unlock()
+
+	parts := strings.Split(accessToken, ".")
+	if len(parts) != 3 {
+		return time.Time{}, fmt.Errorf("access token is not a JWT")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	claims := struct {
+		Exp int64 `json:"exp"`
+	}{}
+	err = json.Unmarshal(payload, &claims)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if claims.Exp == 0 {
+		return time.Time{}, fmt.Errorf("access token has no exp claim")
 	}
 
-	return &Client{
-		accessToken: authRes.AccessToken,
-		c:           http.Client{},
-	}, nil
+	return time.Unix(claims.Exp, 0), nil
 }
 
 // Do executes a StackPath HTTP request by making a call to the underlying
 // http.Client.Do() func. It sets a common user agent request header and treats
 //responses whose status codes are greater than or equal to 300 as an error.
+//
+// The bearer token is refreshed before the request is sent if it's about to
+// expire.
+//
+// Transient 5xx responses and network errors are retried with exponential
+// backoff according to the client's RetryPolicy.
+//
+// Requests made with http.NewRequestWithContext() are cancelled when their
+// context is cancelled or reaches its deadline.
+//
+// Responses are requested gzip compressed and transparently decompressed, which
+// considerably shrinks the logs and WAF requests fetched by polling monitors.
+//
+// Error responses are returned as an *APIError. Errors caused by the account
+// reaching a resource quota are returned as a *QuotaExceededError wrapping the
+// *APIError.
+//
+// Every request is tagged with a generated correlation ID in the request ID
+// header. Error messages include the ID so it can be quoted to StackPath
+// support.
+//
+// Response bodies are written to a directory when the client was built with
+// WithResponseDump().
+//
+// GET requests are made conditionally with If-None-Match when a previous
+// response to the same URL had an ETag. A 304 Not Modified response means no
+// change, so the previous response body is served in its place.
+//
+// Every request is passed to the client's Logger once it's finished when the
+// client was built with WithLogger().
+//
+// Requests are wrapped in the client's interceptors when it was built with
+// WithInterceptors().
 func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	if c.logger == nil {
+		return c.intercept(req, 0)
+	}
+
+	start := time.Now()
+	res, err := c.intercept(req, 0)
+	c.logRequest(req, res, err, time.Since(start))
+
+	return res, err
+}
+
+// do executes a request for Do() once it's been through every interceptor.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
 	// Set common request headers
 	req.Header.Set("User-Agent", userAgent)
-	req.Header.Set("Authorization", "Bearer "+c.accessToken)
-	res, err := c.c.Do(req)
+	if req.URL.String() != c.baseURL+tokenPath {
+		token, err := c.bearerToken(req.Context())
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.Header.Set("Accept-Encoding", "gzip")
+	if req.Header.Get(c.requestIDHeader) == "" {
+		req.Header.Set(c.requestIDHeader, newRequestID())
+	}
+
+	cached, isCached := c.cachedResponse(req)
+	if isCached {
+		req.Header.Set("If-None-Match", cached.etag)
+	}
+
+	res, err := c.send(req)
 	if err != nil {
 		return nil, err
 	}
 
+	// Setting Accept-Encoding manually turns off http.Transport's transparent
+	// decompression, so decompress gzip responses here.
+	if res.Header.Get("Content-Encoding") == "gzip" {
+		gzipBody, err := gzip.NewReader(res.Body)
+		if err != nil {
+			_ = res.Body.Close()
+			return nil, err
+		}
+
+		res.Body = &gzipReadCloser{Reader: gzipBody, body: res.Body}
+		res.Header.Del("Content-Encoding")
+		res.Header.Del("Content-Length")
+		res.ContentLength = -1
+	}
+
+	if c.dumpDir != "" {
+		err = c.dumpResponse(req, res)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if res.StatusCode == http.StatusNotModified && isCached {
+		err = res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		res.Body = ioutil.NopCloser(bytes.NewReader(cached.body))
+		return res, nil
+	}
+
 	// Treat all non 2xx responses as errors
 	if res.StatusCode >= 300 {
 		body, err := ioutil.ReadAll(res.Body)
@@ -89,8 +443,211 @@ func (c *Client) Do(req *http.Request) (*http.Response, error) {
 			return nil, err
 		}
 
-		return nil, fmt.Errorf("%s: %s", res.Status, body)
+		apiErr := newAPIError(res.StatusCode, req.Header.Get(c.requestIDHeader), body)
+		if isQuotaExceeded(res.StatusCode, body) {
+			return nil, &QuotaExceededError{Message: apiErr.Error(), Err: apiErr}
+		}
+
+		return nil, apiErr
+	}
+
+	if req.Method == http.MethodGet && res.Header.Get("ETag") != "" {
+		body, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		err = res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		c.cacheResponse(req, res.Header.Get("ETag"), body)
+		res.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	return res, nil
+}
+
+// stream sends a request for a long-lived streaming response, like a followed
+// log, and returns the response for the caller to read and close. Streams
+// can't go through Do(): the client's timeout would cut them off, and response
+// dumping and ETag caching read the whole body first. So the request is sent
+// without a timeout, ending only when its context is cancelled, and with just
+// the User-Agent and bearer token headers. Error responses are returned as an
+// *APIError.
+func (c *Client) stream(req *http.Request) (*http.Response, error) {
+	req.Header.Set("User-Agent", userAgent)
+	token, err := c.bearerToken(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	streamClient := &http.Client{Transport: c.c.Transport}
+	res, err := streamClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode >= 300 {
+		body, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		err = res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, newAPIError(res.StatusCode, "", body)
 	}
 
 	return res, nil
 }
+
+// gzipReadCloser decompresses a gzip response body and closes both the gzip
+// reader and the underlying body when closed.
+type gzipReadCloser struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+// Close closes the gzip reader and the underlying response body.
+func (g *gzipReadCloser) Close() error {
+	err := g.Reader.Close()
+	if err != nil {
+		_ = g.body.Close()
+		return err
+	}
+
+	return g.body.Close()
+}
+
+// LastRateLimit returns the API rate limit reported by the most recent
+// response. ok is false if no response has reported a rate limit yet.
+func (c *Client) LastRateLimit() (rateLimit RateLimit, ok bool) {
+	c.rateLimitMu.Lock()
+	defer c.rateLimitMu.Unlock()
+
+	if c.rateLimit == nil {
+		return RateLimit{}, false
+	}
+
+	return *c.rateLimit, true
+}
+
+// ClockSkew returns how far StackPath's clock is ahead of the local clock, or a
+// negative duration if it's behind. It's measured from the Date header of every
+// response, so it's zero until the first response is received and only
+// accurate to about a second.
+func (c *Client) ClockSkew() time.Duration {
+	return time.Duration(atomic.LoadInt64(&c.clockSkew))
+}
+
+// ServerNow returns the current time on StackPath's clock. Use it instead of
+// time.Now() to compute the since times of log and event requests, so a
+// drifting local clock doesn't cause missed or duplicated events.
+func (c *Client) ServerNow() time.Time {
+	return time.Now().Add(c.ClockSkew())
+}
+
+// recordClockSkew measures the skew between StackPath's clock and the local
+// clock from a response's Date header, assuming the server's clock was read
+// halfway between when the request was sent and the response received.
+// Responses without a valid Date header are ignored.
+func (c *Client) recordClockSkew(res *http.Response, sent, received time.Time) {
+	serverTime, err := http.ParseTime(res.Header.Get("Date"))
+	if err != nil {
+		return
+	}
+
+	// The Date header has one second resolution, so assume the server's
+	// clock was halfway through the second.
+	serverTime = serverTime.Add(500 * time.Millisecond)
+	localTime := sent.Add(received.Sub(sent) / 2)
+
+	atomic.StoreInt64(&c.clockSkew, int64(serverTime.Sub(localTime)))
+}
+
+// recordRateLimit saves the rate limit reported in a response's headers.
+// Responses without a complete set of rate limit headers are ignored.
+func (c *Client) recordRateLimit(res *http.Response) {
+	limit, err := strconv.Atoi(res.Header.Get("X-RateLimit-Limit"))
+	if err != nil {
+		return
+	}
+
+	remaining, err := strconv.Atoi(res.Header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+
+	reset, err := strconv.ParseInt(res.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+
+	// The reset is either a Unix timestamp or a number of seconds from now.
+	// Anything too small to be a recent timestamp is treated as the latter.
+	resetTime := time.Unix(reset, 0)
+	if reset < 1000000000 {
+		resetTime = time.Now().Add(time.Duration(reset) * time.Second)
+	}
+
+	c.rateLimitMu.Lock()
+	defer c.rateLimitMu.Unlock()
+
+	c.rateLimit = &RateLimit{
+		Limit:     limit,
+		Remaining: remaining,
+		Reset:     resetTime,
+	}
+}
+
+// newRequestID generates a random correlation ID for a request.
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return ""
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// cachedResponse looks up a cached response for a GET request's URL.
+func (c *Client) cachedResponse(req *http.Request) (cachedResponse, bool) {
+	if req.Method != http.MethodGet {
+		return cachedResponse{}, false
+	}
+
+	c.etagsMu.Lock()
+	defer c.etagsMu.Unlock()
+
+	cached, found := c.etags[req.URL.Path]
+	if !found || cached.url != req.URL.String() {
+		return cachedResponse{}, false
+	}
+
+	return cached, true
+}
+
+// cacheResponse saves a GET response's ETag and body. Entries are keyed by
+// path so polling requests whose query strings change every call, like WAF
+// request and instance log windows, replace each other instead of piling up.
+func (c *Client) cacheResponse(req *http.Request, etag string, body []byte) {
+	c.etagsMu.Lock()
+	defer c.etagsMu.Unlock()
+
+	if c.etags == nil {
+		c.etags = make(map[string]cachedResponse)
+	}
+
+	c.etags[req.URL.Path] = cachedResponse{
+		url:  req.URL.String(),
+		etag: etag,
+		body: body,
+	}
+}
@@ -0,0 +1,359 @@
+package stackpath_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"stackpath-demonstration-app/pkg/stackpath"
+	"stackpath-demonstration-app/pkg/stackpath/stackpathtest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The default fixtures' resources, as the stackpath package models them.
+var (
+	testStack    = &stackpath.Stack{ID: stackpathtest.StackID, Slug: stackpathtest.StackSlug, Name: stackpathtest.StackSlug}
+	testDomain   = &stackpath.Domain{ID: stackpathtest.ZoneID, Name: stackpathtest.DomainName}
+	testSite     = &stackpath.Site{ID: stackpathtest.SiteID, Domain: "demo." + stackpathtest.DomainName}
+	testInstance = &stackpath.Instance{Name: stackpathtest.InstanceName, Phase: stackpath.InstancePhaseRunning}
+	testWorkload = &stackpath.Workload{
+		ID:   stackpathtest.WorkloadID,
+		Slug: stackpathtest.WorkloadSlug,
+		Name: stackpathtest.WorkloadName,
+	}
+)
+
+// newTestClient starts a mock StackPath API gateway and a client calling it.
+// The client's authentication request is forgotten, so only the requests made
+// by the test are recorded.
+func newTestClient(t *testing.T, opts ...stackpath.Option) (*stackpathtest.Server, *stackpath.Client) {
+	t.Helper()
+
+	server := stackpathtest.NewServer()
+	t.Cleanup(server.Close)
+
+	client, err := server.NewClient(opts...)
+	if err != nil {
+		t.Fatalf("unable to build a client: %s", err)
+	}
+
+	server.Reset()
+	return server, client
+}
+
+// wantRequest describes a request a client is expected to make. Only the
+// given query parameters are checked, and the request body must be JSON with
+// at least the fields in body. An empty body isn't checked.
+type wantRequest struct {
+	method string
+	path   string
+	query  url.Values
+	body   string
+}
+
+// requestTest is a call to a Client method and the request it should make.
+// setup optionally changes the server's fixtures before the call.
+type requestTest struct {
+	name  string
+	setup func(server *stackpathtest.Server)
+	call  func(ctx context.Context, client *stackpath.Client) error
+	want  wantRequest
+}
+
+// runRequestTests runs each test against a new mock server.
+func runRequestTests(t *testing.T, tests []requestTest) {
+	t.Helper()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, client := newTestClient(t)
+			if test.setup != nil {
+				test.setup(server)
+			}
+
+			err := test.call(context.Background(), client)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			assertRequest(t, server, test.want)
+		})
+	}
+}
+
+// assertRequest checks that the server received a request matching want and
+// returns the last one.
+func assertRequest(t *testing.T, server *stackpathtest.Server, want wantRequest) stackpathtest.Request {
+	t.Helper()
+
+	requests := server.RequestsTo(want.method, want.path)
+	if len(requests) == 0 {
+		var received []string
+		for _, req := range server.Requests() {
+			received = append(received, req.Method+" "+req.Path)
+		}
+		t.Fatalf("expected a %s %s request, got %s", want.method, want.path, strings.Join(received, ", "))
+	}
+	req := requests[len(requests)-1]
+
+	for key, values := range want.query {
+		if !reflect.DeepEqual(req.Query[key], values) {
+			t.Errorf("expected query parameter %s=%q, got %q", key, values, req.Query[key])
+		}
+	}
+
+	if want.body != "" {
+		if !containsJSON(decodeJSON(t, req.Body), decodeJSON(t, []byte(want.body))) {
+			t.Errorf("expected a body containing %s, got %s", want.body, req.Body)
+		}
+	}
+
+	return req
+}
+
+// decodeJSON decodes a JSON document for containsJSON().
+func decodeJSON(t *testing.T, b []byte) interface{} {
+	t.Helper()
+
+	var v interface{}
+	err := json.Unmarshal(b, &v)
+	if err != nil {
+		t.Fatalf("invalid JSON %q: %s", b, err)
+	}
+
+	return v
+}
+
+// containsJSON determines if a decoded JSON value has every field in want.
+// Objects may have more fields than want, but arrays must match element for
+// element.
+func containsJSON(got, want interface{}) bool {
+	switch want := want.(type) {
+	case map[string]interface{}:
+		gotObject, ok := got.(map[string]interface{})
+		if !ok {
+			return false
+		}
+
+		for key, value := range want {
+			gotValue, found := gotObject[key]
+			if !found || !containsJSON(gotValue, value) {
+				return false
+			}
+		}
+
+		return true
+	case []interface{}:
+		gotArray, ok := got.([]interface{})
+		if !ok || len(gotArray) != len(want) {
+			return false
+		}
+
+		for i := range want {
+			if !containsJSON(gotArray[i], want[i]) {
+				return false
+			}
+		}
+
+		return true
+	default:
+		return reflect.DeepEqual(got, want)
+	}
+}
+
+func TestNewClientAuthenticates(t *testing.T) {
+	server := stackpathtest.NewServer()
+	defer server.Close()
+
+	client, err := server.NewClient()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	assertRequest(t, server, wantRequest{
+		method: http.MethodPost,
+		path:   "/identity/v1/oauth2/token",
+		body:   `{"grant_type": "client_credentials", "client_id": "test-client-id", "client_secret": "test-client-secret"}`,
+	})
+
+	server.Reset()
+	_, err = client.ListStacks(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	req := assertRequest(t, server, wantRequest{method: http.MethodGet, path: "/stack/v1/stacks"})
+	if req.Header.Get("Authorization") != "Bearer "+stackpathtest.AccessToken {
+		t.Errorf("expected the bearer token, got %q", req.Header.Get("Authorization"))
+	}
+}
+
+func TestDoRevalidatesCachedResponses(t *testing.T) {
+	server, client := newTestClient(t)
+	server.Handle(http.MethodGet, "/stack/v1/stacks", stackpathtest.Response{
+		Header: http.Header{"Content-Type": {"application/json"}, "ETag": {`"v1"`}},
+		Body: `{
+  "pageInfo": {"hasNextPage": false},
+  "results": [{"id": "` + stackpathtest.StackID + `", "slug": "` + stackpathtest.StackSlug + `", "name": "` + stackpathtest.StackSlug + `"}]
+}`,
+	})
+
+	stacks, err := client.ListStacks(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(stacks) != 1 {
+		t.Fatalf("expected 1 stack, got %d", len(stacks))
+	}
+
+	server.Handle(http.MethodGet, "/stack/v1/stacks", stackpathtest.Response{StatusCode: http.StatusNotModified})
+	stacks, err = client.ListStacks(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	req := assertRequest(t, server, wantRequest{method: http.MethodGet, path: "/stack/v1/stacks"})
+	if req.Header.Get("If-None-Match") != `"v1"` {
+		t.Errorf("expected If-None-Match %q, got %q", `"v1"`, req.Header.Get("If-None-Match"))
+	}
+	if len(stacks) != 1 || stacks[0].Slug != stackpathtest.StackSlug {
+		t.Errorf("expected the cached stack, got %+v", stacks)
+	}
+}
+
+func TestLastRateLimit(t *testing.T) {
+	server, client := newTestClient(t)
+	_, ok := client.LastRateLimit()
+	if ok {
+		t.Fatal("expected no rate limit before a response reports one")
+	}
+
+	server.Handle(http.MethodGet, "/stack/v1/stacks", stackpathtest.Response{
+		Header: http.Header{
+			"Content-Type":          {"application/json"},
+			"X-Ratelimit-Limit":     {"100"},
+			"X-Ratelimit-Remaining": {"42"},
+			"X-Ratelimit-Reset":     {"1700000000"},
+		},
+		Body: `{"pageInfo": {"hasNextPage": false}, "results": []}`,
+	})
+	_, err := client.ListStacks(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	rateLimit, ok := client.LastRateLimit()
+	if !ok {
+		t.Fatal("expected a rate limit")
+	}
+	want := stackpath.RateLimit{Limit: 100, Remaining: 42, Reset: time.Unix(1700000000, 0)}
+	if rateLimit.Limit != want.Limit || rateLimit.Remaining != want.Remaining || !rateLimit.Reset.Equal(want.Reset) {
+		t.Errorf("expected %+v, got %+v", want, rateLimit)
+	}
+}
+
+func TestDoDecompressesGzipResponses(t *testing.T) {
+	server, client := newTestClient(t)
+
+	var body bytes.Buffer
+	gzipWriter := gzip.NewWriter(&body)
+	_, err := gzipWriter.Write([]byte(`{
+  "pageInfo": {"hasNextPage": false},
+  "results": [{"id": "` + stackpathtest.StackID + `", "slug": "` + stackpathtest.StackSlug + `", "name": "` + stackpathtest.StackSlug + `"}]
+}`))
+	if err != nil {
+		t.Fatalf("unable to compress the response: %s", err)
+	}
+	err = gzipWriter.Close()
+	if err != nil {
+		t.Fatalf("unable to compress the response: %s", err)
+	}
+
+	server.Handle(http.MethodGet, "/stack/v1/stacks", stackpathtest.Response{
+		Header: http.Header{"Content-Type": {"application/json"}, "Content-Encoding": {"gzip"}},
+		Body:   body.String(),
+	})
+	stacks, err := client.ListStacks(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	req := assertRequest(t, server, wantRequest{method: http.MethodGet, path: "/stack/v1/stacks"})
+	if req.Header.Get("Accept-Encoding") != "gzip" {
+		t.Errorf("expected Accept-Encoding gzip, got %q", req.Header.Get("Accept-Encoding"))
+	}
+	if len(stacks) != 1 || stacks[0].Slug != stackpathtest.StackSlug {
+		t.Errorf("expected the decompressed stack, got %+v", stacks)
+	}
+}
+
+func TestTokenExpiry(t *testing.T) {
+	_, client := newTestClient(t)
+
+	expiry, err := client.TokenExpiry()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !expiry.Equal(time.Unix(4102444800, 0)) {
+		t.Errorf("expected the token to expire at %s, got %s", time.Unix(4102444800, 0), expiry)
+	}
+}
+
+func TestTokenExpiryWithoutAJWT(t *testing.T) {
+	server := stackpathtest.NewServer()
+	defer server.Close()
+
+	server.HandleJSON(http.MethodPost, "/identity/v1/oauth2/token", http.StatusOK, `{"access_token": "opaque", "expires_in": 3600}`)
+	client, err := server.NewClient()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	_, err = client.TokenExpiry()
+	if err == nil {
+		t.Error("expected an error for a token that isn't a JWT")
+	}
+}
+
+func TestDoRefreshesAnExpiringToken(t *testing.T) {
+	tests := []struct {
+		name        string
+		expiresIn   int
+		wantRefresh bool
+	}{
+		{name: "about to expire", expiresIn: 30, wantRefresh: true},
+		{name: "still valid", expiresIn: 3600, wantRefresh: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := stackpathtest.NewServer()
+			defer server.Close()
+
+			server.HandleJSON(http.MethodPost, "/identity/v1/oauth2/token", http.StatusOK, fmt.Sprintf(
+				`{"access_token": "%s", "expires_in": %d}`, stackpathtest.AccessToken, test.expiresIn,
+			))
+			client, err := server.NewClient()
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			server.Reset()
+			_, err = client.ListStacks(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			refreshed := len(server.RequestsTo(http.MethodPost, "/identity/v1/oauth2/token")) > 0
+			if refreshed != test.wantRefresh {
+				t.Errorf("expected the token to be refreshed: %t, got %t", test.wantRefresh, refreshed)
+			}
+		})
+	}
+}
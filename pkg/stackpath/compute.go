@@ -1,12 +1,23 @@
 package stackpath
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"math"
 	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -16,129 +27,791 @@ type Workload struct {
 	Slug      string
 	Name      string
 	AnycastIP string
+	Targets   []Target
+
+	// Env is the container's environment variables. Secret values aren't
+	// returned by the API, so they're left out.
+	Env map[string]string
+
+	// pausedReplicas is the replica counts PauseWorkload() saved in the
+	// workload's metadata, or nil if the workload isn't paused.
+	pausedReplicas map[string]replicaRange
+}
+
+// replicaRange is a target's minimum and maximum replicas.
+type replicaRange struct {
+	MinReplicas int `json:"minReplicas"`
+	MaxReplicas int `json:"maxReplicas"`
 }
 
+// containerName is the name of the single container in the demo's workloads.
+const containerName = "my-app"
+
+// pausedReplicasAnnotation is the workload metadata annotation PauseWorkload()
+// saves each target's replica counts in, as a JSON object keyed by target
+// name.
+const pausedReplicasAnnotation = "demo.stackpath.dev/paused-replicas"
+
 // Instance models a StackPath Edge Compute workload instance. Instances are the
 // VMs and containers that are running in a workload.
 type Instance struct {
-	ID                string `json:"id"`
-	Name              string `json:"name"`
-	Phase             string `json:"phase"`
-	IPAddress         string `json:"ipAddress"`
-	ExternalIPAddress string `json:"externalIpAddress"`
+	ID                string   `json:"id"`
+	Name              string   `json:"name"`
+	Phase             string   `json:"phase"`
+	IPAddress         string   `json:"ipAddress"`
+	ExternalIPAddress string   `json:"externalIpAddress"`
+	Location          Location `json:"location"`
+}
+
+// The phases an Edge Compute instance goes through. Instances are scheduled
+// onto a POP and start, then run until they complete, fail, or are stopped.
+const (
+	InstancePhaseScheduling = "SCHEDULING"
+	InstancePhaseStarting   = "STARTING"
+	InstancePhaseRunning    = "RUNNING"
+	InstancePhaseCompleted  = "COMPLETED"
+	InstancePhaseFailed     = "FAILED"
+	InstancePhaseStopped    = "STOPPED"
+)
+
+// WorkloadStatus models how far along a workload's instances are. Phases
+// counts the instances in each InstancePhase* phase. The workload is Ready once
+// it has at least ExpectedReplicas instances and every one of them is running.
+type WorkloadStatus struct {
+	Instances        []Instance
+	Total            int
+	Phases           map[string]int
+	ExpectedReplicas int
+	Ready            bool
+}
+
+// Location models a StackPath POP that Edge Compute instances can run in.
+type Location struct {
+	City        string  `json:"city"`
+	CityCode    string  `json:"cityCode"`
+	CountryCode string  `json:"countryCode"`
+	Latitude    float64 `json:"latitude"`
+	Longitude   float64 `json:"longitude"`
+}
+
+// Target models a group of cities that a workload deploys instances to along
+// with the group's auto-scaling settings. DeploymentScope is the location
+// attribute the target selects POPs by and defaults to "cityCode", matching
+// CityCodes. Instances scale up when the average
+// ScaleMetric across them goes over ScaleThreshold. CPU and Memory optionally
+// override the workload's container resources in this target's cities, e.g.
+// for smaller instances in some regions. They're Kubernetes quantities like
+// Resources, e.g. "500m" or "2Gi". Empty values keep the workload's
+// resources.
+type Target struct {
+	Name            string
+	DeploymentScope string
+	CityCodes       []string
+	MinReplicas     int
+	MaxReplicas     int
+	ScaleMetric     string
+	ScaleThreshold  int
+	CPU             string
+	Memory          string
+}
+
+// ExpectedReplicas returns how many instances the target runs before scaling
+// up: MinReplicas in each of its cities when it's scoped by city code, or
+// MinReplicas in total otherwise.
+func (t Target) ExpectedReplicas() int {
+	if (t.DeploymentScope == "" || t.DeploymentScope == "cityCode") && len(t.CityCodes) > 0 {
+		return t.MinReplicas * len(t.CityCodes)
+	}
+
+	return t.MinReplicas
+}
+
+// ExpectedReplicas returns how many instances the workload runs across all of
+// its targets before scaling up.
+func (w *Workload) ExpectedReplicas() int {
+	replicas := 0
+	for _, target := range w.Targets {
+		replicas += target.ExpectedReplicas()
+	}
+
+	return replicas
+}
+
+// The metrics a target can auto-scale on. ScaleMetricCPU and ScaleMetricMemory
+// thresholds are a percentage of the instance's allocation and
+// ScaleMetricRequests thresholds are requests per second per instance.
+const (
+	ScaleMetricCPU      = "cpu"
+	ScaleMetricMemory   = "memory"
+	ScaleMetricRequests = "requests"
+)
+
+// ValidateScaleSettings checks that a scale metric is one a target can scale on
+// and that its threshold is in range for the metric.
+func ValidateScaleSettings(metric string, threshold int) error {
+	switch metric {
+	case ScaleMetricCPU, ScaleMetricMemory:
+		if threshold < 1 || threshold > 100 {
+			return fmt.Errorf("%s scale threshold %d must be a percentage from 1 to 100", metric, threshold)
+		}
+	case ScaleMetricRequests:
+		if threshold < 1 {
+			return fmt.Errorf("%s scale threshold %d must be at least 1 request per second", metric, threshold)
+		}
+	default:
+		return fmt.Errorf(
+			"unknown scale metric %q, must be one of %s, %s, %s",
+			metric,
+			ScaleMetricCPU,
+			ScaleMetricMemory,
+			ScaleMetricRequests,
+		)
+	}
+
+	return nil
+}
+
+// WorkloadTarget models a workload target's configured scaling settings along
+// with the number of instances the platform currently wants running in it.
+type WorkloadTarget struct {
+	Target
+	DesiredReplicas int
+}
+
+// targetsResponse models the "targets" object in a workload API response.
+type targetsResponse map[string]struct {
+	Spec struct {
+		DeploymentScope string `json:"deploymentScope"`
+		Deployments     struct {
+			MinReplicas int `json:"minReplicas"`
+			MaxReplicas int `json:"maxReplicas"`
+			Selectors   []struct {
+				Key    string   `json:"key"`
+				Values []string `json:"values"`
+			} `json:"selectors"`
+			ScaleSettings struct {
+				Metrics []struct {
+					Metric string `json:"metric"`
+
+					// averageUtilization and averageValue are sent as
+					// strings but may come back as numbers.
+					AverageUtilization json.RawMessage `json:"averageUtilization"`
+					AverageValue       json.RawMessage `json:"averageValue"`
+				} `json:"metrics"`
+			} `json:"scaleSettings"`
+		} `json:"deployments"`
+		Containers map[string]struct {
+			Resources struct {
+				Requests struct {
+					CPU    string `json:"cpu"`
+					Memory string `json:"memory"`
+				} `json:"requests"`
+			} `json:"resources"`
+		} `json:"containers"`
+	} `json:"spec"`
+	Status struct {
+		DesiredReplicas int `json:"desiredReplicas"`
+	} `json:"status"`
+}
+
+// toWorkloadTargets converts a workload API response's targets to
+// WorkloadTargets, sorted by name.
+func (t targetsResponse) toWorkloadTargets() []WorkloadTarget {
+	var targets []WorkloadTarget
+	for name, target := range t {
+		workloadTarget := WorkloadTarget{
+			Target: Target{
+				Name:            name,
+				DeploymentScope: target.Spec.DeploymentScope,
+				MinReplicas:     target.Spec.Deployments.MinReplicas,
+				MaxReplicas:     target.Spec.Deployments.MaxReplicas,
+			},
+			DesiredReplicas: target.Status.DesiredReplicas,
+		}
+
+		for _, selector := range target.Spec.Deployments.Selectors {
+			if selector.Key == "cityCode" {
+				workloadTarget.CityCodes = append(workloadTarget.CityCodes, selector.Values...)
+			}
+		}
+
+		// Resource overrides are merged into the target's container spec.
+		container, found := target.Spec.Containers[containerName]
+		if found {
+			workloadTarget.CPU = container.Resources.Requests.CPU
+			workloadTarget.Memory = container.Resources.Requests.Memory
+		}
+
+		for _, metric := range target.Spec.Deployments.ScaleSettings.Metrics {
+			threshold := metric.AverageUtilization
+			if metric.Metric == ScaleMetricRequests {
+				threshold = metric.AverageValue
+			}
+
+			workloadTarget.ScaleMetric = metric.Metric
+			workloadTarget.ScaleThreshold, _ = strconv.Atoi(strings.Trim(string(threshold), `"`))
+		}
+
+		targets = append(targets, workloadTarget)
+	}
+
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i].Name < targets[j].Name
+	})
+
+	return targets
+}
+
+// workloadResponse models a workload in a workload API response.
+type workloadResponse struct {
+	ID       string `json:"id"`
+	Slug     string `json:"slug"`
+	Name     string `json:"name"`
+	Metadata struct {
+		Annotations map[string]string `json:"annotations"`
+	} `json:"metadata"`
+	Spec struct {
+		Containers map[string]struct {
+			Env []struct {
+				Key   string `json:"key"`
+				Value string `json:"value"`
+			} `json:"env"`
+		} `json:"containers"`
+	} `json:"spec"`
+	Targets targetsResponse `json:"targets"`
+}
+
+// toWorkload converts a workload API response to a Workload. The anycast IP
+// annotation is a subnet, so only its address is kept.
+func (w workloadResponse) toWorkload() *Workload {
+	workload := &Workload{
+		ID:        w.ID,
+		Slug:      w.Slug,
+		Name:      w.Name,
+		AnycastIP: strings.Split(w.Metadata.Annotations["anycast.platform.stackpath.net/subnets"], "/")[0],
+	}
+	for _, target := range w.Targets.toWorkloadTargets() {
+		workload.Targets = append(workload.Targets, target.Target)
+	}
+
+	for _, env := range w.Spec.Containers[containerName].Env {
+		if workload.Env == nil {
+			workload.Env = make(map[string]string)
+		}
+		workload.Env[env.Key] = env.Value
+	}
+
+	// A malformed annotation is treated as the workload not being paused.
+	paused := w.Metadata.Annotations[pausedReplicasAnnotation]
+	if paused != "" {
+		var pausedReplicas map[string]replicaRange
+		if json.Unmarshal([]byte(paused), &pausedReplicas) == nil {
+			workload.pausedReplicas = pausedReplicas
+		}
+	}
+
+	return workload
+}
+
+// DefaultTargets returns the demo's workload targets: one instance in Dallas,
+// TX, US and one each in Frankfurt DE and Amsterdam NL, scaling up to two
+// instances per city at 50% CPU load.
+func DefaultTargets() []Target {
+	return []Target{
+		{
+			Name:           "north-america",
+			CityCodes:      []string{"DFW"},
+			MinReplicas:    1,
+			MaxReplicas:    2,
+			ScaleMetric:    ScaleMetricCPU,
+			ScaleThreshold: 50,
+		},
+		{
+			Name:           "europe",
+			CityCodes:      []string{"FRA", "AMS"},
+			MinReplicas:    1,
+			MaxReplicas:    2,
+			ScaleMetric:    ScaleMetricCPU,
+			ScaleThreshold: 50,
+		},
+	}
+}
+
+// CityTargets returns a single workload target deploying to the given cities
+// with the demo's scaling settings: one instance per city, scaling up to two
+// at 50% CPU load.
+func CityTargets(cityCodes []string) []Target {
+	return []Target{
+		{
+			Name:           "custom",
+			CityCodes:      cityCodes,
+			MinReplicas:    1,
+			MaxReplicas:    2,
+			ScaleMetric:    ScaleMetricCPU,
+			ScaleThreshold: 50,
+		},
+	}
+}
+
+// WorkloadSpec models the configuration of an Edge Compute workload with a
+// single container. Env and SecretEnv set the container's environment
+// variables. SecretEnv values are stored as secrets and aren't shown when the
+// workload is read back. The container isn't health checked unless
+// LivenessProbe or ReadinessProbe are set.
+type WorkloadSpec struct {
+	Name          string
+	Image         string
+	Command       []string
+	Env           map[string]string
+	SecretEnv     map[string]string
+	Ports         []Port
+	Resources     Resources
+	RestartPolicy string
+	Targets       []Target
+
+	LivenessProbe  *Probe
+	ReadinessProbe *Probe
+}
+
+// Probe models an HTTP health check of a workload's container: a GET request
+// to Path on Port every Period, starting InitialDelay after the container
+// starts. The probe fails after FailureThreshold failed requests in a row. An
+// instance failing its liveness probe is restarted and one failing its
+// readiness probe is taken out of rotation until it passes again. Zero
+// InitialDelay, Period, and FailureThreshold values leave them to the platform
+// defaults.
+type Probe struct {
+	Path             string
+	Port             int
+	InitialDelay     time.Duration
+	Period           time.Duration
+	FailureThreshold int
+}
+
+// Resources models the CPU and memory of a workload's container. Each instance
+// is guaranteed its Requests and may use up to its Limits.
+type Resources struct {
+	Requests ResourceList
+	Limits   ResourceList
+}
+
+// ResourceList models an amount of CPU and memory as Kubernetes style
+// quantities, e.g. "500m" or "1" CPU cores and "512Mi" or "2Gi" of memory.
+// Empty values aren't sent.
+type ResourceList struct {
+	CPU    string
+	Memory string
+}
+
+// cpuQuantity and memoryQuantity match Kubernetes style CPU and memory
+// quantities. memoryUnits are the multipliers of memory quantity suffixes.
+var (
+	cpuQuantity    = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)(m?)$`)
+	memoryQuantity = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)(Ki|Mi|Gi|Ti|k|M|G|T)?$`)
+	memoryUnits    = map[string]float64{
+		"":   1,
+		"k":  1e3,
+		"M":  1e6,
+		"G":  1e9,
+		"T":  1e12,
+		"Ki": 1 << 10,
+		"Mi": 1 << 20,
+		"Gi": 1 << 30,
+		"Ti": 1 << 40,
+	}
+)
+
+// Port models a port exposed from a workload's container. Protocol is TCP or
+// UDP and defaults to TCP. Public ports can be reached from the Internet. A
+// container can expose any number of ports, each with a unique name.
+type Port struct {
+	Name     string
+	Port     int
+	Protocol string
+	Public   bool
+}
+
+// DefaultWorkloadSpec returns the demo's workload: the kennethreitz/httpbin
+// diagnostic app with its access logs sent to STDOUT, serving HTTP publicly on
+// port 80 from 1 CPU core and 2 GiB of memory per instance in
+// DefaultTargets().
+func DefaultWorkloadSpec() WorkloadSpec {
+	return WorkloadSpec{
+		Name:  workloadName,
+		Image: "kennethreitz/httpbin:latest",
+		Command: []string{
+			"gunicorn", "--access-logfile", "-", "-b", "0.0.0.0:80", "httpbin:app",
+			"-k", "gevent", "--worker-tmp-dir", "/dev/shm",
+		},
+		Ports: []Port{
+			{Name: "http", Port: 80, Protocol: "TCP", Public: true},
+		},
+		Resources: Resources{
+			Requests: ResourceList{CPU: "1", Memory: "2Gi"},
+		},
+		RestartPolicy: RestartPolicyDefault,
+		Targets:       DefaultTargets(),
+	}
+}
+
+// DemoVersionEnv is the environment variable SetDemoVersion() sets on the
+// demo's container.
+const DemoVersionEnv = "DEMO_VERSION"
+
+// SetDemoVersion sets the DemoVersionEnv environment variable on the spec's
+// container, labeling the deployment with a version SmokeTest() can check.
+func (spec *WorkloadSpec) SetDemoVersion(version string) {
+	if spec.Env == nil {
+		spec.Env = make(map[string]string)
+	}
+	spec.Env[DemoVersionEnv] = version
+}
+
+// validate checks that a workload spec can be created.
+func (spec WorkloadSpec) validate() error {
+	if spec.Name == "" {
+		return fmt.Errorf("workload name must be set")
+	}
+	if spec.Image == "" {
+		return fmt.Errorf("workload image must be set")
+	}
+	if len(spec.Ports) == 0 {
+		return fmt.Errorf("workload must expose at least one port")
+	}
+	if len(spec.Targets) == 0 {
+		return fmt.Errorf("workload must have at least one target")
+	}
+
+	for key := range spec.Env {
+		if key == "" {
+			return fmt.Errorf("environment variable names must be set")
+		}
+		if _, found := spec.SecretEnv[key]; found {
+			return fmt.Errorf("environment variable %q can't be both plain and secret", key)
+		}
+	}
+	for key := range spec.SecretEnv {
+		if key == "" {
+			return fmt.Errorf("environment variable names must be set")
+		}
+	}
+
+	portNames := make(map[string]bool, len(spec.Ports))
+	for _, port := range spec.Ports {
+		if port.Name == "" || port.Port < 1 || port.Port > 65535 {
+			return fmt.Errorf("port %q: must have a name and a port from 1 to 65535", port.Name)
+		}
+		if port.Protocol != "" && port.Protocol != "TCP" && port.Protocol != "UDP" {
+			return fmt.Errorf("port %q: protocol %q must be TCP or UDP", port.Name, port.Protocol)
+		}
+		if portNames[port.Name] {
+			return fmt.Errorf("port %q: port names must be unique", port.Name)
+		}
+		portNames[port.Name] = true
+	}
+
+	if spec.Resources.Requests.CPU == "" || spec.Resources.Requests.Memory == "" {
+		return fmt.Errorf("workload CPU and memory requests must be set")
+	}
+	err := spec.Resources.validate()
+	if err != nil {
+		return err
+	}
+
+	switch spec.RestartPolicy {
+	case RestartPolicyDefault, RestartPolicyAlways, RestartPolicyOnFailure, RestartPolicyNever:
+	default:
+		return fmt.Errorf("unknown restart policy %q", spec.RestartPolicy)
+	}
+
+	if spec.LivenessProbe != nil {
+		err = spec.LivenessProbe.validate()
+		if err != nil {
+			return fmt.Errorf("liveness probe: %w", err)
+		}
+	}
+	if spec.ReadinessProbe != nil {
+		err = spec.ReadinessProbe.validate()
+		if err != nil {
+			return fmt.Errorf("readiness probe: %w", err)
+		}
+	}
+
+	return validateTargets(spec.Targets)
+}
+
+// validate checks that the resources' quantities are well formed and that no
+// limit is below its request.
+func (r Resources) validate() error {
+	quantities := []struct {
+		name    string
+		request string
+		limit   string
+		parse   func(string) (float64, error)
+	}{
+		{name: "CPU", request: r.Requests.CPU, limit: r.Limits.CPU, parse: parseCPU},
+		{name: "memory", request: r.Requests.Memory, limit: r.Limits.Memory, parse: parseMemory},
+	}
+
+	for _, q := range quantities {
+		var request, limit float64
+		var err error
+		if q.request != "" {
+			request, err = q.parse(q.request)
+			if err != nil {
+				return fmt.Errorf("%s request: %w", q.name, err)
+			}
+		}
+		if q.limit != "" {
+			limit, err = q.parse(q.limit)
+			if err != nil {
+				return fmt.Errorf("%s limit: %w", q.name, err)
+			}
+		}
+
+		if q.request != "" && q.limit != "" && limit < request {
+			return fmt.Errorf("%s limit %s is less than the request %s", q.name, q.limit, q.request)
+		}
+	}
+
+	return nil
+}
+
+// validate checks that a probe can be sent to the API.
+func (p Probe) validate() error {
+	if !strings.HasPrefix(p.Path, "/") {
+		return fmt.Errorf("path %q must start with /", p.Path)
+	}
+	if p.Port < 1 || p.Port > 65535 {
+		return fmt.Errorf("port %d must be from 1 to 65535", p.Port)
+	}
+	if p.InitialDelay < 0 || p.InitialDelay%time.Second != 0 {
+		return fmt.Errorf("initial delay %s must be a non-negative whole number of seconds", p.InitialDelay)
+	}
+	if p.Period < 0 || p.Period%time.Second != 0 {
+		return fmt.Errorf("period %s must be a non-negative whole number of seconds", p.Period)
+	}
+	if p.FailureThreshold < 0 {
+		return fmt.Errorf("failure threshold %d can't be negative", p.FailureThreshold)
+	}
+
+	return nil
+}
+
+// parseCPU converts a CPU quantity like "500m" or "1.5" to millicores.
+func parseCPU(quantity string) (float64, error) {
+	match := cpuQuantity.FindStringSubmatch(quantity)
+	if match == nil {
+		return 0, fmt.Errorf("invalid CPU quantity %q, e.g. \"500m\" or \"1\"", quantity)
+	}
+
+	value, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, err
+	}
+	if value == 0 {
+		return 0, fmt.Errorf("CPU quantity %q must be greater than zero", quantity)
+	}
+
+	if match[2] == "m" {
+		return value, nil
+	}
+
+	return value * 1000, nil
+}
+
+// parseMemory converts a memory quantity like "512Mi" or "2G" to bytes.
+func parseMemory(quantity string) (float64, error) {
+	match := memoryQuantity.FindStringSubmatch(quantity)
+	if match == nil {
+		return 0, fmt.Errorf("invalid memory quantity %q, e.g. \"512Mi\" or \"2Gi\"", quantity)
+	}
+
+	value, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, err
+	}
+	if value == 0 {
+		return 0, fmt.Errorf("memory quantity %q must be greater than zero", quantity)
+	}
+
+	return value * memoryUnits[match[2]], nil
+}
+
+// InstanceJSONLog models a single line from the console logs of an instance
+// whose app logs structured JSON. Fields holds the line's parsed JSON object.
+// Lines that aren't a JSON object have nil Fields and the line text in Raw.
+type InstanceJSONLog struct {
+	Timestamp time.Time
+	Fields    map[string]interface{}
+	Raw       string
+}
+
+// InstanceLogEntry models a single gunicorn access log line from an instance
+// running the demo's httpbin app. Bytes is 0 when the response had no body.
+type InstanceLogEntry struct {
+	Timestamp time.Time
+	ClientIP  string
+	Method    string
+	Path      string
+	Status    int
+	Bytes     int
+}
+
+// accessLogLine matches gunicorn's default access log format, e.g.
+// 10.0.0.1 - - [12/Mar/2021:10:00:00 +0000] "GET /get HTTP/1.1" 200 255 "-" "curl/7.64.1"
+var accessLogLine = regexp.MustCompile(`^(\S+) \S+ \S+ \[([^\]]+)\] "(\S+) (\S+)[^"]*" (\d{3}) (\d+|-)`)
+
+// accessLogTime is the layout of the time in gunicorn's access log lines.
+const accessLogTime = "02/Jan/2006:15:04:05 -0700"
+
+// ScalingEvent models a change in the number of replicas a workload target
+// wants running.
+type ScalingEvent struct {
+	Target    string
+	CityCodes []string
+	From      int
+	To        int
+	Time      time.Time
+}
+
+// ScaledUp determines if the event added replicas to its target.
+func (e ScalingEvent) ScaledUp() bool {
+	return e.To > e.From
+}
+
+// InstanceStartupTiming models when an instance passed through each phase of
+// starting up: when it was scheduled to a POP, when its container started
+// after the image was pulled, and when it was running. Zero values mean the
+// instance hasn't reached that phase yet.
+type InstanceStartupTiming struct {
+	Scheduled        time.Time
+	ContainerStarted time.Time
+	Running          time.Time
+}
+
+// StartupDuration returns how long the instance took to go from scheduled to
+// running, or zero if it isn't running yet.
+func (t InstanceStartupTiming) StartupDuration() time.Duration {
+	if t.Running.IsZero() {
+		return 0
+	}
+
+	return t.Running.Sub(t.Scheduled)
+}
+
+// MetricSample is a single timestamped metric value.
+type MetricSample struct {
+	Time  time.Time
+	Value float64
+}
+
+// InstanceMetrics models an instance's resource utilization over time. CPU
+// samples are the percent of the instance's CPU allocation in use and memory
+// samples are bytes in use. Samples are ordered oldest to newest.
+type InstanceMetrics struct {
+	CPU    []MetricSample
+	Memory []MetricSample
+}
+
+// LatestCPU returns the most recent CPU sample's value, or zero if there are no
+// samples.
+func (m InstanceMetrics) LatestCPU() float64 {
+	if len(m.CPU) == 0 {
+		return 0
+	}
+
+	return m.CPU[len(m.CPU)-1].Value
+}
+
+// The restart policies that control whether a workload's containers are
+// restarted when they exit. RestartPolicyDefault leaves the decision to the
+// platform default.
+const (
+	RestartPolicyDefault   = ""
+	RestartPolicyAlways    = "Always"
+	RestartPolicyOnFailure = "OnFailure"
+	RestartPolicyNever     = "Never"
+)
+
+// WorkloadCostEstimate models the rough cost of running a workload for some
+// duration. Min assumes every target stays at its minimum replica count and
+// Max assumes every target scales to its maximum.
+type WorkloadCostEstimate struct {
+	MinInstances int
+	MaxInstances int
+	Min          float64
+	Max          float64
+	Currency     string
+}
+
+// workloadName is the name DefaultWorkloadSpec() gives the demo workload, and
+// the start of the per-project names NewDeployment() gives deployments'
+// workloads.
+const workloadName = "My compute origin"
+
+// hourlyCPURate and hourlyMemoryRate are the approximate list prices in USD
+// per hour of one CPU core and one GiB of memory requested by an Edge Compute
+// container instance, so the demo's 1 core and 2 GiB instances cost about
+// 0.04 USD per hour. StackPath doesn't expose pricing over its API, so these
+// are built-in rates. Update them to match your account's pricing for accurate
+// estimates.
+const (
+	hourlyCPURate    = 0.02
+	hourlyMemoryRate = 0.01
+)
+
+// InstanceLogLine models a single timestamped line from an instance's console
+// logs, tagged with the instance and city it came from.
+type InstanceLogLine struct {
+	Instance  string
+	CityCode  string
+	Timestamp time.Time
+	Text      string
 }
 
-// CreateWorkload creates an Edge Compute workload suitable for demonstration
-// purposes.
+// CreateWorkload creates an Edge Compute workload from a spec. See
+// DefaultWorkloadSpec() for the demo's workload.
 //
 // The workload will have the following characteristics:
-// * The name "My compute origin"
+// * The spec's name
 // * An anycast IP
-// * Instances based on the kennethreitz/httpbin:latest container
-// * An overridden command to send httpbin's access logs to STDOUT
+// * Instances running a single container based on the spec's image, with the
+//   spec's command if it's set
 // * A single network interface per instance
-// * 1 CPU core and 2 GiB of memory per instance
-// * Port TCP/80 exposed from the container with public Internet access to it
-// * Instances in Frankfurt DE, Amsterdam NL, and Dallas, TX, US
-// * Autoscaling from one instance in each POP to two when an instance reaches
-//   50% CPU load.
+// * The spec's CPU and memory requests and limits per instance, unless a
+//   target overrides the requests
+// * The spec's ports exposed from the container, with public Internet access
+//   to the ports marked public
+// * Instances in the spec's targets, see DefaultTargets() for the demo's
+//   Frankfurt DE, Amsterdam NL, and Dallas, TX, US layout
+// * Autoscaling from each target's minimum to maximum replicas when the
+//   target's scale metric reaches its threshold
+// * The spec's container restart policy, or the platform default if it's
+//   RestartPolicyDefault
+//
+// A *QuotaExceededError is returned if the account can't have any more
+// workloads.
 //
 // See: https://stackpath.dev/reference/workloads#createworkload
-func (c *Client) CreateWorkload(stack *Stack) (*Workload, error) {
-	reqBody := bytes.NewBuffer([]byte(`{
-  "workload": {
-    "name": "My compute origin",
-    "metadata": {
-      "version": "1",
-      "annotations": {
-        "anycast.platform.stackpath.net": "true"
-      }
-    },
-    "spec": {
-      "networkInterfaces": [
-        {
-          "network": "default"
-        }
-      ],
-      "containers": {
-        "my-app": {
-          "image": "kennethreitz/httpbin:latest",
-          "command": ["gunicorn", "--access-logfile", "-", "-b", "0.0.0.0:80", "httpbin:app", "-k", "gevent", "--worker-tmp-dir", "/dev/shm"],
-          "ports": {
-            "http": {
-              "port": 80,
-              "enableImplicitNetworkPolicy": true
-            }
-          },
-          "resources": {
-            "requests": {
-              "cpu": "1",
-              "memory": "2Gi"
-            }
-          }
-        }
-      }
-    },
-    "targets": {
-      "north-america": {
-        "spec": {
-          "deploymentScope": "cityCode",
-          "deployments": {
-            "minReplicas": 1,
-            "maxReplicas": 2,
-            "selectors": [
-              {
-                "key": "cityCode",
-                "operator": "in",
-                "values": [
-                  "DFW"
-                ]
-              }
-            ],
-            "scaleSettings": {
-              "metrics": [
-                {
-                  "metric": "cpu",
-                  "averageUtilization": "50"
-                }
-              ]
-            }
-          }
-        }
-      },
-      "europe": {
-        "spec": {
-          "deploymentScope": "cityCode",
-          "deployments": {
-            "minReplicas": 1,
-            "maxReplicas": 2,
-            "selectors": [
-              {
-                "key": "cityCode",
-                "operator": "in",
-                "values": [
-                  "FRA", "AMS"
-                ]
-              }
-            ],
-            "scaleSettings": {
-              "metrics": [
-                {
-                  "metric": "cpu",
-                  "averageUtilization": "50"
-                }
-              ]
-            }
-          }
-        }
-      }
-    }
-  }
-}`))
-	req, err := http.NewRequest(
+func (c *Client) CreateWorkload(ctx context.Context, stack *Stack, spec WorkloadSpec) (*Workload, error) {
+	err := spec.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	reqBody, err := json.Marshal(map[string]interface{}{
+		"workload": buildWorkload(spec),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx,
 		http.MethodPost,
-		fmt.Sprintf(baseURL+"/workload/v1/stacks/%s/workloads", stack.Slug),
-		reqBody,
+		fmt.Sprintf(c.baseURL+"/workload/v1/stacks/%s/workloads", stack.Slug),
+		bytes.NewBuffer(reqBody),
 	)
 	if err != nil {
 		return nil, err
@@ -146,7 +819,7 @@ func (c *Client) CreateWorkload(stack *Stack) (*Workload, error) {
 
 	res, err := c.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, withQuotaResource(err, "workload")
 	}
 
 	body, err := ioutil.ReadAll(res.Body)
@@ -160,38 +833,34 @@ func (c *Client) CreateWorkload(stack *Stack) (*Workload, error) {
 	}
 
 	newWorkload := struct {
-		Workload struct {
-			ID       string `json:"id"`
-			Slug     string `json:"slug"`
-			Name     string `json:"name"`
-			Metadata struct {
-				Annotations struct {
-					AnycastIP string `json:"anycast.platform.stackpath.net/subnets"`
-				} `json:"annotations"`
-			} `json:"metadata"`
-		} `json:"workload"`
+		Workload workloadResponse `json:"workload"`
 	}{}
 	err = json.Unmarshal(body, &newWorkload)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Workload{
-		ID:        newWorkload.Workload.ID,
-		Slug:      newWorkload.Workload.Slug,
-		Name:      newWorkload.Workload.Name,
-		AnycastIP: strings.Split(newWorkload.Workload.Metadata.Annotations.AnycastIP, "/")[0],
-	}, nil
+	// Keep the targets as requested, including their resource overrides.
+	workload := newWorkload.Workload.toWorkload()
+	workload.Targets = spec.Targets
+	return workload, nil
 }
 
-// GetInstances gets a compute workload's instances. Instances are the
-// containers and VMs that make up the workload.
+// FindWorkloadByName searches a stack for an Edge Compute workload by name,
+// populating its targets from the workload's spec. A return value of nil means
+// the workload was not found. If more than one workload has the name an
+// *AmbiguousMatchError is returned rather than picking one.
 //
-// See: https://stackpath.dev/reference/instances#getworkloadinstances
-func (c *Client) GetInstances(stack *Stack, workload *Workload) ([]Instance, error) {
-	req, err := http.NewRequest(
+// See: https://stackpath.dev/reference/workloads#getworkloads
+func (c *Client) FindWorkloadByName(ctx context.Context, stack *Stack, name string) (*Workload, error) {
+	req, err := http.NewRequestWithContext(
+		ctx,
 		http.MethodGet,
-		fmt.Sprintf(baseURL+"/workload/v1/stacks/%s/workloads/%s/instances", stack.Slug, workload.Slug),
+		fmt.Sprintf(
+			c.baseURL+"/workload/v1/stacks/%s/workloads?page_request.filter=%s",
+			stack.Slug,
+			url.QueryEscape("name=\""+name+"\""),
+		),
 		nil,
 	)
 	if err != nil {
@@ -203,60 +872,1619 @@ func (c *Client) GetInstances(stack *Stack, workload *Workload) ([]Instance, err
 		return nil, err
 	}
 
-	resBody, err := ioutil.ReadAll(res.Body)
+	body, err := ioutil.ReadAll(res.Body)
 	if err != nil {
 		return nil, err
 	}
-
 	err = res.Body.Close()
 	if err != nil {
 		return nil, err
 	}
 
-	instanceRes := struct {
-		Results []Instance `json:"results"`
+	searchRes := struct {
+		Results []workloadResponse `json:"results"`
 	}{}
-	err = json.Unmarshal(resBody, &instanceRes)
+	err = json.Unmarshal(body, &searchRes)
 	if err != nil {
 		return nil, err
 	}
 
-	return instanceRes.Results, nil
+	// If results is empty then the workload wasn't found.
+	if len(searchRes.Results) == 0 {
+		return nil, nil
+	}
+	if len(searchRes.Results) > 1 {
+		return nil, &AmbiguousMatchError{Resource: "workload", Name: name, Count: len(searchRes.Results)}
+	}
+
+	return searchRes.Results[0].toWorkload(), nil
 }
 
-// GetInstanceLogs returns an instance's console logs from `since` until now as
-// a single string containing line breaks.
+// GetWorkload retrieves a single Edge Compute workload by its slug or ID. A
+// return value of nil means the workload was not found.
 //
-// See: https://stackpath.dev/reference/instance-logs#getlogs
-func (c *Client) GetInstanceLogs(stack *Stack, workload *Workload, instance *Instance, since time.Time) (string, error) {
-	req, err := http.NewRequest(
+// See: https://stackpath.dev/reference/workloads#getworkload
+func (c *Client) GetWorkload(ctx context.Context, stack *Stack, slugOrID string) (*Workload, error) {
+	req, err := http.NewRequestWithContext(
+		ctx,
 		http.MethodGet,
-		fmt.Sprintf(
-			baseURL+"/workload/v1/stacks/%s/workloads/%s/instances/%s/logs?timestamps=true&since_time=%s",
-			stack.Slug,
-			workload.Slug,
-			instance.Name,
-			since.Format(time.RFC3339),
-		),
+		fmt.Sprintf(c.baseURL+"/workload/v1/stacks/%s/workloads/%s", stack.Slug, url.PathEscape(slugOrID)),
 		nil,
 	)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	res, err := c.Do(req)
+	if IsNotFound(err) {
+		return nil, nil
+	}
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	body, err := ioutil.ReadAll(res.Body)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	err = res.Body.Close()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return string(body), nil
+	workloadRes := struct {
+		Workload workloadResponse `json:"workload"`
+	}{}
+	err = json.Unmarshal(body, &workloadRes)
+	if err != nil {
+		return nil, err
+	}
+
+	return workloadRes.Workload.toWorkload(), nil
+}
+
+// ListWorkloads lists every Edge Compute workload on a stack, following every
+// page of results.
+//
+// See: https://stackpath.dev/reference/workloads#getworkloads
+func (c *Client) ListWorkloads(ctx context.Context, stack *Stack) ([]Workload, error) {
+	var workloads []Workload
+	err := c.paginate(
+		ctx,
+		fmt.Sprintf(c.baseURL+"/workload/v1/stacks/%s/workloads", stack.Slug),
+		defaultMaxPages,
+		func(body []byte) error {
+			page := struct {
+				Results []workloadResponse `json:"results"`
+			}{}
+			err := json.Unmarshal(body, &page)
+			if err != nil {
+				return err
+			}
+
+			for _, result := range page.Results {
+				workloads = append(workloads, *result.toWorkload())
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return workloads, nil
+}
+
+// EstimateWorkloadCost estimates the cost of running a workload with the given
+// spec for a duration, before it's provisioned. Each instance is priced by the
+// CPU and memory it requests, taking the targets' CPU and Memory overrides into
+// account. The estimate is based on built-in rates and doesn't account for
+// bandwidth or regional pricing.
+func EstimateWorkloadCost(spec WorkloadSpec, duration time.Duration) (WorkloadCostEstimate, error) {
+	estimate := WorkloadCostEstimate{Currency: "USD"}
+	for _, target := range spec.Targets {
+		rate, err := hourlyRate(spec.Resources.Requests, target)
+		if err != nil {
+			return WorkloadCostEstimate{}, fmt.Errorf("target %s: %w", target.Name, err)
+		}
+
+		minInstances := target.ExpectedReplicas()
+		maxInstances := target.maxInstances()
+		estimate.MinInstances += minInstances
+		estimate.MaxInstances += maxInstances
+		estimate.Min += float64(minInstances) * rate * duration.Hours()
+		estimate.Max += float64(maxInstances) * rate * duration.Hours()
+	}
+
+	return estimate, nil
+}
+
+// maxInstances returns how many instances the target runs when it's scaled
+// all the way up, counted the same way as ExpectedReplicas().
+func (t Target) maxInstances() int {
+	if (t.DeploymentScope == "" || t.DeploymentScope == "cityCode") && len(t.CityCodes) > 0 {
+		return t.MaxReplicas * len(t.CityCodes)
+	}
+
+	return t.MaxReplicas
+}
+
+// hourlyRate returns the approximate price per hour of one of the target's
+// instances requesting the workload's requests, or the target's overrides
+// of them. Resources that aren't requested aren't priced.
+func hourlyRate(requests ResourceList, target Target) (float64, error) {
+	cpu, memory := requests.CPU, requests.Memory
+	if target.CPU != "" {
+		cpu = target.CPU
+	}
+	if target.Memory != "" {
+		memory = target.Memory
+	}
+
+	rate := 0.0
+	if cpu != "" {
+		millicores, err := parseCPU(cpu)
+		if err != nil {
+			return 0, err
+		}
+		rate += millicores / 1000 * hourlyCPURate
+	}
+	if memory != "" {
+		bytes, err := parseMemory(memory)
+		if err != nil {
+			return 0, err
+		}
+		rate += bytes / (1 << 30) * hourlyMemoryRate
+	}
+
+	return rate, nil
+}
+
+// GetWorkloadTargets retrieves a workload's targets with their city codes,
+// minimum and maximum replicas, and the number of replicas each target
+// currently wants running.
+//
+// See: https://stackpath.dev/reference/workloads#getworkload
+func (c *Client) GetWorkloadTargets(ctx context.Context, stack *Stack, workload *Workload) ([]WorkloadTarget, error) {
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodGet,
+		fmt.Sprintf(c.baseURL+"/workload/v1/stacks/%s/workloads/%s", stack.Slug, workload.ID),
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	err = res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	workloadRes := struct {
+		Workload struct {
+			Targets targetsResponse `json:"targets"`
+		} `json:"workload"`
+	}{}
+	err = json.Unmarshal(body, &workloadRes)
+	if err != nil {
+		return nil, err
+	}
+
+	return workloadRes.Workload.Targets.toWorkloadTargets(), nil
+}
+
+// PauseWorkload scales every one of a workload's targets down to zero
+// instances, parking the workload without deleting it. Each target's replica
+// counts are saved in the workload's metadata first, so ResumeWorkload() can
+// restore them from any client. Pausing a paused workload does nothing.
+//
+// See: https://stackpath.dev/reference/workloads#updateworkload
+func (c *Client) PauseWorkload(ctx context.Context, stack *Stack, workload *Workload) error {
+	current, err := c.GetWorkload(ctx, stack, workload.ID)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		return fmt.Errorf("workload %s not found", workload.Name)
+	}
+
+	// Saving the zero counts again would lose the original ones.
+	if current.pausedReplicas != nil {
+		return nil
+	}
+
+	saved := make(map[string]replicaRange, len(current.Targets))
+	paused := make([]Target, len(current.Targets))
+	for i, target := range current.Targets {
+		saved[target.Name] = replicaRange{MinReplicas: target.MinReplicas, MaxReplicas: target.MaxReplicas}
+		paused[i] = target
+		paused[i].MinReplicas = 0
+		paused[i].MaxReplicas = 0
+	}
+
+	annotation, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+
+	return c.updateWorkload(ctx, stack, workload, paused, map[string]interface{}{
+		pausedReplicasAnnotation: string(annotation),
+	})
+}
+
+// ResumeWorkload scales a paused workload's targets back up to the replica
+// counts PauseWorkload() saved, and clears them from the workload's metadata.
+// An error is returned if the workload isn't paused.
+//
+// See: https://stackpath.dev/reference/workloads#updateworkload
+func (c *Client) ResumeWorkload(ctx context.Context, stack *Stack, workload *Workload) error {
+	current, err := c.GetWorkload(ctx, stack, workload.ID)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		return fmt.Errorf("workload %s not found", workload.Name)
+	}
+	if current.pausedReplicas == nil {
+		return fmt.Errorf("workload %s isn't paused", workload.Name)
+	}
+
+	resumed := make([]Target, len(current.Targets))
+	for i, target := range current.Targets {
+		resumed[i] = target
+
+		saved, found := current.pausedReplicas[target.Name]
+		if found {
+			resumed[i].MinReplicas = saved.MinReplicas
+			resumed[i].MaxReplicas = saved.MaxReplicas
+		}
+	}
+
+	// A null annotation removes it.
+	return c.updateWorkload(ctx, stack, workload, resumed, map[string]interface{}{
+		pausedReplicasAnnotation: nil,
+	})
+}
+
+// DeleteWorkload deletes a workload and all of its instances. Deleting a
+// workload that's already gone isn't an error.
+//
+// See: https://stackpath.dev/reference/workloads#deleteworkload
+func (c *Client) DeleteWorkload(ctx context.Context, stack *Stack, workload *Workload) error {
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodDelete,
+		fmt.Sprintf(c.baseURL+"/workload/v1/stacks/%s/workloads/%s", stack.Slug, workload.ID),
+		nil,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Do(req)
+	if IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// updateWorkload replaces a workload's targets and merges annotations into its
+// metadata.
+func (c *Client) updateWorkload(ctx context.Context, stack *Stack, workload *Workload, targets []Target, annotations map[string]interface{}) error {
+	reqBody, err := json.Marshal(map[string]interface{}{
+		"workload": map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"annotations": annotations,
+			},
+			"targets": buildTargets(targets),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPatch,
+		fmt.Sprintf(c.baseURL+"/workload/v1/stacks/%s/workloads/%s", stack.Slug, workload.ID),
+		bytes.NewBuffer(reqBody),
+	)
+	if err != nil {
+		return err
+	}
+
+	// There's no need to save or interpret the API call response.
+	_, err = c.Do(req)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// buildWorkload converts a workload spec to the "workload" object in a workload
+// request body.
+func buildWorkload(spec WorkloadSpec) map[string]interface{} {
+	ports := make(map[string]interface{}, len(spec.Ports))
+	for _, port := range spec.Ports {
+		protocol := port.Protocol
+		if protocol == "" {
+			protocol = "TCP"
+		}
+
+		ports[port.Name] = map[string]interface{}{
+			"port":                        port.Port,
+			"protocol":                    protocol,
+			"enableImplicitNetworkPolicy": port.Public,
+		}
+	}
+
+	resources := make(map[string]interface{})
+	for name, list := range map[string]ResourceList{"requests": spec.Resources.Requests, "limits": spec.Resources.Limits} {
+		quantities := make(map[string]string)
+		if list.CPU != "" {
+			quantities["cpu"] = list.CPU
+		}
+		if list.Memory != "" {
+			quantities["memory"] = list.Memory
+		}
+		if len(quantities) > 0 {
+			resources[name] = quantities
+		}
+	}
+
+	container := map[string]interface{}{
+		"image":     spec.Image,
+		"ports":     ports,
+		"resources": resources,
+	}
+	if len(spec.Command) > 0 {
+		container["command"] = spec.Command
+	}
+	if len(spec.Env)+len(spec.SecretEnv) > 0 {
+		container["env"] = buildEnv(spec.Env, spec.SecretEnv)
+	}
+	if spec.LivenessProbe != nil {
+		container["livenessProbe"] = buildProbe(*spec.LivenessProbe)
+	}
+	if spec.ReadinessProbe != nil {
+		container["readinessProbe"] = buildProbe(*spec.ReadinessProbe)
+	}
+
+	workloadSpec := map[string]interface{}{
+		"networkInterfaces": []map[string]string{
+			{"network": "default"},
+		},
+		"containers": map[string]interface{}{
+			containerName: container,
+		},
+	}
+
+	// Only send a restart policy if one was chosen.
+	if spec.RestartPolicy != RestartPolicyDefault {
+		workloadSpec["restartPolicy"] = spec.RestartPolicy
+	}
+
+	return map[string]interface{}{
+		"name": spec.Name,
+		"metadata": map[string]interface{}{
+			"version": "1",
+			"annotations": map[string]string{
+				"anycast.platform.stackpath.net": "true",
+			},
+		},
+		"spec":    workloadSpec,
+		"targets": buildTargets(spec.Targets),
+	}
+}
+
+// buildProbe converts a probe to a "livenessProbe" or "readinessProbe" object
+// in a container spec. Zero values are left out so the platform defaults
+// apply.
+func buildProbe(probe Probe) map[string]interface{} {
+	spec := map[string]interface{}{
+		"httpGet": map[string]interface{}{
+			"path":   probe.Path,
+			"port":   probe.Port,
+			"scheme": "HTTP",
+		},
+	}
+	if probe.InitialDelay > 0 {
+		spec["initialDelaySeconds"] = int(probe.InitialDelay / time.Second)
+	}
+	if probe.Period > 0 {
+		spec["periodSeconds"] = int(probe.Period / time.Second)
+	}
+	if probe.FailureThreshold > 0 {
+		spec["failureThreshold"] = probe.FailureThreshold
+	}
+
+	return spec
+}
+
+// buildEnv converts environment variables to the "env" array in a container
+// spec, sorted by name so request bodies are stable.
+func buildEnv(env, secretEnv map[string]string) []map[string]string {
+	var keys []string
+	for key := range env {
+		keys = append(keys, key)
+	}
+	for key := range secretEnv {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	vars := make([]map[string]string, 0, len(keys))
+	for _, key := range keys {
+		if value, found := secretEnv[key]; found {
+			vars = append(vars, map[string]string{"key": key, "secretValue": value})
+			continue
+		}
+
+		vars = append(vars, map[string]string{"key": key, "value": env[key]})
+	}
+
+	return vars
+}
+
+// buildTargets converts targets to the "targets" object in a workload request
+// body.
+func buildTargets(targets []Target) map[string]interface{} {
+	spec := make(map[string]interface{}, len(targets))
+	for _, target := range targets {
+		deploymentScope := target.DeploymentScope
+		if deploymentScope == "" {
+			deploymentScope = "cityCode"
+		}
+
+		targetSpec := map[string]interface{}{
+			"deploymentScope": deploymentScope,
+			"deployments": map[string]interface{}{
+				"minReplicas": target.MinReplicas,
+				"maxReplicas": target.MaxReplicas,
+				"selectors": []map[string]interface{}{
+					{
+						"key":      "cityCode",
+						"operator": "in",
+						"values":   target.CityCodes,
+					},
+				},
+				"scaleSettings": map[string]interface{}{
+					"metrics": []map[string]interface{}{
+						buildScaleMetric(target),
+					},
+				},
+			},
+		}
+
+		// Merge resource overrides into the target's container spec.
+		requests := make(map[string]string)
+		if target.CPU != "" {
+			requests["cpu"] = target.CPU
+		}
+		if target.Memory != "" {
+			requests["memory"] = target.Memory
+		}
+		if len(requests) > 0 {
+			targetSpec["containers"] = map[string]interface{}{
+				containerName: map[string]interface{}{
+					"resources": map[string]interface{}{
+						"requests": requests,
+					},
+				},
+			}
+		}
+
+		spec[target.Name] = map[string]interface{}{
+			"spec": targetSpec,
+		}
+	}
+
+	return spec
+}
+
+// buildScaleMetric builds a target's scale settings metric. Percentage based
+// metrics use averageUtilization and the requests metric uses averageValue.
+func buildScaleMetric(target Target) map[string]interface{} {
+	metric := target.ScaleMetric
+	if metric == "" {
+		metric = ScaleMetricCPU
+	}
+
+	threshold := "averageUtilization"
+	if metric == ScaleMetricRequests {
+		threshold = "averageValue"
+	}
+
+	return map[string]interface{}{
+		"metric":  metric,
+		threshold: strconv.Itoa(target.ScaleThreshold),
+	}
+}
+
+// validateTargets checks that targets' scale settings are valid and that their
+// resource overrides are well formed quantities. Targets without a scale
+// metric scale on CPU.
+func validateTargets(targets []Target) error {
+	for _, target := range targets {
+		metric := target.ScaleMetric
+		if metric == "" {
+			metric = ScaleMetricCPU
+		}
+
+		err := ValidateScaleSettings(metric, target.ScaleThreshold)
+		if err != nil {
+			return fmt.Errorf("target %q: %w", target.Name, err)
+		}
+
+		if target.CPU != "" {
+			_, err := parseCPU(target.CPU)
+			if err != nil {
+				return fmt.Errorf("target %q: %w", target.Name, err)
+			}
+		}
+
+		if target.Memory != "" {
+			_, err := parseMemory(target.Memory)
+			if err != nil {
+				return fmt.Errorf("target %q: %w", target.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// contains determines if a string slice contains a value.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ResolveInstanceTarget determines which of a workload's targets an instance
+// belongs to and the city code of the POP it runs in. The city comes from the
+// instance's location, or from its name if the location wasn't reported, since
+// instance names are built from the workload, target, and city. Empty strings
+// are returned for anything that can't be resolved.
+func ResolveInstanceTarget(instance *Instance, targets []Target) (string, string) {
+	nameParts := strings.Split(strings.ToUpper(instance.Name), "-")
+
+	cityCode := instance.Location.CityCode
+	if cityCode == "" {
+		for _, target := range targets {
+			for _, code := range target.CityCodes {
+				if contains(nameParts, strings.ToUpper(code)) {
+					cityCode = code
+				}
+			}
+		}
+	}
+
+	for _, target := range targets {
+		for _, code := range target.CityCodes {
+			if strings.EqualFold(code, cityCode) {
+				return target.Name, cityCode
+			}
+		}
+	}
+
+	for _, target := range targets {
+		if strings.Contains(instance.Name, "-"+target.Name+"-") {
+			return target.Name, cityCode
+		}
+	}
+
+	return "", cityCode
+}
+
+// GetInstances gets a compute workload's instances. Instances are the
+// containers and VMs that make up the workload. Every page of results is read.
+//
+// See: https://stackpath.dev/reference/instances#getworkloadinstances
+func (c *Client) GetInstances(ctx context.Context, stack *Stack, workload *Workload) ([]Instance, error) {
+	var instances []Instance
+	err := c.paginate(ctx, fmt.Sprintf(c.baseURL+"/workload/v1/stacks/%s/workloads/%s/instances", stack.Slug, workload.Slug), defaultMaxPages, func(body []byte) error {
+		page := struct {
+			Results []Instance `json:"results"`
+		}{}
+		err := json.Unmarshal(body, &page)
+		if err != nil {
+			return err
+		}
+
+		instances = append(instances, page.Results...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return instances, nil
+}
+
+// GetWorkloadStatus counts a workload's instances by phase and determines if
+// the workload is ready, comparing them to the replicas its targets expect. A
+// workload without targets is ready once it has any instances and they're all
+// running.
+func (c *Client) GetWorkloadStatus(ctx context.Context, stack *Stack, workload *Workload) (*WorkloadStatus, error) {
+	instances, err := c.GetInstances(ctx, stack, workload)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &WorkloadStatus{
+		Instances:        instances,
+		Total:            len(instances),
+		Phases:           make(map[string]int),
+		ExpectedReplicas: workload.ExpectedReplicas(),
+	}
+	for _, instance := range instances {
+		status.Phases[instance.Phase]++
+	}
+
+	status.Ready = status.Total > 0 &&
+		status.Total >= status.ExpectedReplicas &&
+		status.Phases[InstancePhaseRunning] == status.Total
+
+	return status, nil
+}
+
+// GetInstance gets a single compute workload instance by name. A nil instance
+// result means the instance no longer exists, which is the case once it's torn
+// down.
+//
+// See: https://stackpath.dev/reference/instances#getworkloadinstance
+func (c *Client) GetInstance(ctx context.Context, stack *Stack, workload *Workload, name string) (*Instance, error) {
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodGet,
+		fmt.Sprintf(
+			c.baseURL+"/workload/v1/stacks/%s/workloads/%s/instances/%s",
+			stack.Slug,
+			workload.Slug,
+			url.PathEscape(name),
+		),
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.Do(req)
+	if IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	err = res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	instanceRes := struct {
+		Instance Instance `json:"instance"`
+	}{}
+	err = json.Unmarshal(body, &instanceRes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &instanceRes.Instance, nil
+}
+
+// RestartInstance restarts a running workload instance, recycling its
+// containers in place. An *InstanceNotRunningError is returned if the instance
+// isn't running yet. Restarting an instance that's gone, or that's already
+// being recreated, isn't an error.
+//
+// See: https://stackpath.dev/reference/instances#restartinstance
+func (c *Client) RestartInstance(ctx context.Context, stack *Stack, workload *Workload, instanceName string) error {
+	instance, err := c.GetInstance(ctx, stack, workload, instanceName)
+	if err != nil {
+		return err
+	}
+
+	// A missing instance was torn down and is recreated by the workload.
+	if instance == nil {
+		return nil
+	}
+
+	if instance.Phase != InstancePhaseRunning {
+		return &InstanceNotRunningError{Instance: instanceName, Phase: instance.Phase}
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		fmt.Sprintf(
+			c.baseURL+"/workload/v1/stacks/%s/workloads/%s/instances/%s/power/restart",
+			stack.Slug,
+			workload.Slug,
+			url.PathEscape(instanceName),
+		),
+		nil,
+	)
+	if err != nil {
+		return err
+	}
+
+	// StackPath answers 409 Conflict if the instance is mid-restart and 404 if
+	// it went away since it was looked up.
+	_, err = c.Do(req)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusConflict || apiErr.StatusCode == http.StatusNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetInstanceLogs returns an instance's console logs from `since` until now as
+// a single string containing line breaks. A positive `tailLines` bounds the
+// response to the last that many lines and 0 returns every line.
+//
+// See: https://stackpath.dev/reference/instance-logs#getlogs
+func (c *Client) GetInstanceLogs(ctx context.Context, stack *Stack, workload *Workload, instance *Instance, since time.Time, tailLines int) (string, error) {
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodGet,
+		fmt.Sprintf(
+			c.baseURL+"/workload/v1/stacks/%s/workloads/%s/instances/%s/logs?timestamps=true&since_time=%s%s",
+			stack.Slug,
+			workload.Slug,
+			instance.Name,
+			url.QueryEscape(since.UTC().Format(time.RFC3339)),
+			tailLinesQuery(tailLines),
+		),
+		nil,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := c.Do(req)
+	if err != nil {
+		return "", err
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	err = res.Body.Close()
+	if err != nil {
+		return "", err
+	}
+
+	return string(body), nil
+}
+
+// GetWorkloadLogs returns the console logs of every instance in a workload from
+// `since` until now, tagged by instance, in a single call to the workload logs
+// endpoint. If the endpoint isn't available, answering with a 404 Not Found or
+// 501 Not Implemented, it falls back to fetching each instance's logs, and
+// keeps doing so for the life of the client. Lines
+// without a leading timestamp have a zero Timestamp and the whole line in
+// Text. A positive `tailLines` bounds each instance's logs to its last that
+// many lines and 0 returns every line.
+//
+// See: https://stackpath.dev/reference/instance-logs#getlogs
+func (c *Client) GetWorkloadLogs(ctx context.Context, stack *Stack, workload *Workload, since time.Time, tailLines int) ([]InstanceLogLine, error) {
+	if atomic.LoadInt32(&c.workloadLogsUnsupported) == 0 {
+		lines, err := c.getWorkloadLogs(ctx, stack, workload, since, tailLines)
+		if err == nil {
+			return lines, nil
+		}
+
+		// Only a missing or unimplemented endpoint means it's unsupported.
+		// Other errors, like a timeout, would fail per-instance fetches too.
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) ||
+			(apiErr.StatusCode != http.StatusNotFound && apiErr.StatusCode != http.StatusNotImplemented) {
+			return nil, err
+		}
+
+		atomic.StoreInt32(&c.workloadLogsUnsupported, 1)
+	}
+
+	instances, err := c.GetInstances(ctx, stack, workload)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []InstanceLogLine
+	for i := range instances {
+		instance := &instances[i]
+		logs, err := c.GetInstanceLogs(ctx, stack, workload, instance, since, tailLines)
+		if err != nil {
+			return nil, err
+		}
+
+		scanner := bufio.NewScanner(strings.NewReader(logs))
+		for scanner.Scan() {
+			timestamp, text, _ := parseLogLine(scanner.Text())
+			lines = append(lines, InstanceLogLine{
+				Instance:  instance.Name,
+				CityCode:  instance.Location.CityCode,
+				Timestamp: timestamp,
+				Text:      text,
+			})
+		}
+	}
+
+	return lines, nil
+}
+
+// getWorkloadLogs calls the workload-level logs endpoint.
+func (c *Client) getWorkloadLogs(ctx context.Context, stack *Stack, workload *Workload, since time.Time, tailLines int) ([]InstanceLogLine, error) {
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodGet,
+		fmt.Sprintf(
+			c.baseURL+"/workload/v1/stacks/%s/workloads/%s/logs?timestamps=true&since_time=%s%s",
+			stack.Slug,
+			workload.Slug,
+			url.QueryEscape(since.UTC().Format(time.RFC3339)),
+			tailLinesQuery(tailLines),
+		),
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	err = res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	logRes := struct {
+		Results []struct {
+			InstanceName string    `json:"instanceName"`
+			CityCode     string    `json:"cityCode"`
+			Timestamp    time.Time `json:"timestamp"`
+			Line         string    `json:"line"`
+		} `json:"results"`
+	}{}
+	err = json.Unmarshal(body, &logRes)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make([]InstanceLogLine, len(logRes.Results))
+	for i, result := range logRes.Results {
+		lines[i] = InstanceLogLine{
+			Instance:  result.InstanceName,
+			CityCode:  result.CityCode,
+			Timestamp: result.Timestamp,
+			Text:      result.Line,
+		}
+	}
+
+	return lines, nil
+}
+
+// GetInstanceJSONLogs returns an instance's console logs from `since` until now
+// with each line parsed as a JSON object, for apps that log newline-delimited
+// JSON. Lines that aren't valid JSON are returned raw rather than dropped.
+//
+// See: https://stackpath.dev/reference/instance-logs#getlogs
+func (c *Client) GetInstanceJSONLogs(ctx context.Context, stack *Stack, workload *Workload, instance *Instance, since time.Time) ([]InstanceJSONLog, error) {
+	logs, err := c.GetInstanceLogs(ctx, stack, workload, instance, since, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var jsonLogs []InstanceJSONLog
+	scanner := bufio.NewScanner(strings.NewReader(logs))
+	for scanner.Scan() {
+		timestamp, text, _ := parseLogLine(scanner.Text())
+		jsonLog := InstanceJSONLog{Timestamp: timestamp}
+
+		err := json.Unmarshal([]byte(text), &jsonLog.Fields)
+		if err != nil {
+			jsonLog.Fields = nil
+			jsonLog.Raw = text
+		}
+
+		jsonLogs = append(jsonLogs, jsonLog)
+	}
+
+	return jsonLogs, nil
+}
+
+// ParseAccessLog parses the gunicorn access log lines in an instance's console
+// logs, as returned by GetInstanceLogs(), into entries. Entries are timestamped
+// with the line's leading log timestamp, falling back to gunicorn's own request
+// time. Lines that aren't access log lines are returned raw in `unparsed`.
+func (c *Client) ParseAccessLog(raw string) (entries []InstanceLogEntry, unparsed []string) {
+	scanner := bufio.NewScanner(strings.NewReader(raw))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		timestamp, text, _ := parseLogLine(line)
+		match := accessLogLine.FindStringSubmatch(text)
+		if match == nil {
+			unparsed = append(unparsed, line)
+			continue
+		}
+
+		if timestamp.IsZero() {
+			timestamp, _ = time.Parse(accessLogTime, match[2])
+		}
+
+		// The regular expression guarantees status and bytes are numeric,
+		// apart from the "-" gunicorn logs for empty responses.
+		status, _ := strconv.Atoi(match[5])
+		size, _ := strconv.Atoi(match[6])
+
+		entries = append(entries, InstanceLogEntry{
+			Timestamp: timestamp,
+			ClientIP:  match[1],
+			Method:    match[3],
+			Path:      match[4],
+			Status:    status,
+			Bytes:     size,
+		})
+	}
+
+	return entries, unparsed
+}
+
+// tailLinesQuery builds the logs endpoints' tail_lines query parameter, or
+// nothing if `tailLines` isn't positive.
+func tailLinesQuery(tailLines int) string {
+	if tailLines <= 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("&tail_lines=%d", tailLines)
+}
+
+// TailInstanceLogs returns the last `tailLines` lines of an instance's console
+// logs as a single string containing line breaks.
+//
+// See: https://stackpath.dev/reference/instance-logs#getlogs
+func (c *Client) TailInstanceLogs(ctx context.Context, stack *Stack, workload *Workload, instance *Instance, tailLines int) (string, error) {
+	if tailLines <= 0 {
+		return "", fmt.Errorf("tailLines must be positive, got %d", tailLines)
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodGet,
+		fmt.Sprintf(
+			c.baseURL+"/workload/v1/stacks/%s/workloads/%s/instances/%s/logs?timestamps=true&tail_lines=%d",
+			stack.Slug,
+			workload.Slug,
+			instance.Name,
+			tailLines,
+		),
+		nil,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := c.Do(req)
+	if err != nil {
+		return "", err
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	err = res.Body.Close()
+	if err != nil {
+		return "", err
+	}
+
+	return string(body), nil
+}
+
+// StreamInstanceLogs follows an instance's console logs from now on, sending
+// each line on the returned channel as StackPath emits it. Lines keep their
+// leading RFC3339 timestamp. The stream isn't subject to the client's timeout.
+// If it drops it's reopened from the last line received, skipping lines that
+// were already sent. The channel is closed when ctx is cancelled or the
+// instance goes away.
+//
+// See: https://stackpath.dev/reference/instance-logs#getlogs
+func (c *Client) StreamInstanceLogs(ctx context.Context, stack *Stack, workload *Workload, instance *Instance) (<-chan string, error) {
+	since := c.ServerNow()
+	body, err := c.openInstanceLogStream(ctx, stack, workload, instance, since)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+
+		for {
+			scanner := bufio.NewScanner(body)
+			for scanner.Scan() {
+				line := scanner.Text()
+				timestamp, _, ok := parseLogLine(line)
+
+				// since_time has one second resolution, so a reopened stream
+				// repeats lines that were already sent.
+				if ok {
+					if !timestamp.After(since) {
+						continue
+					}
+					since = timestamp
+				}
+
+				select {
+				case lines <- line:
+				case <-ctx.Done():
+					_ = body.Close()
+					return
+				}
+			}
+			_ = body.Close()
+
+			// The stream dropped. Wait a moment and reopen it from the last
+			// line received.
+			for {
+				select {
+				case <-time.After(time.Second):
+				case <-ctx.Done():
+					return
+				}
+
+				body, err = c.openInstanceLogStream(ctx, stack, workload, instance, since)
+				if IsNotFound(err) {
+					return
+				}
+				if err == nil {
+					break
+				}
+			}
+		}
+	}()
+
+	return lines, nil
+}
+
+// openInstanceLogStream opens the follow variant of an instance's logs
+// endpoint from `since` on. The caller must close the returned body.
+func (c *Client) openInstanceLogStream(ctx context.Context, stack *Stack, workload *Workload, instance *Instance, since time.Time) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodGet,
+		fmt.Sprintf(
+			c.baseURL+"/workload/v1/stacks/%s/workloads/%s/instances/%s/logs?timestamps=true&follow=true&since_time=%s",
+			stack.Slug,
+			workload.Slug,
+			instance.Name,
+			url.QueryEscape(since.UTC().Format(time.RFC3339)),
+		),
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.stream(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Body, nil
+}
+
+// StreamAllInstanceLogs follows the console logs of every instance in a
+// workload with StreamInstanceLogs() and merges them into a single channel,
+// tagging each line with its instance and city. Lines are sent as each
+// instance emits them, so the stream is ordered by timestamp on a best-effort
+// basis across the whole workload. The workload's instances are polled every
+// five seconds so instances that appear during the stream are followed too,
+// and an instance's stream ends when it goes away. The channel is closed once
+// ctx is cancelled and every instance's stream is done.
+func (c *Client) StreamAllInstanceLogs(ctx context.Context, stack *Stack, workload *Workload) (<-chan InstanceLogLine, error) {
+	instances, err := c.GetInstances(ctx, stack, workload)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make(chan InstanceLogLine)
+	go func() {
+		var wg sync.WaitGroup
+		defer close(lines)
+		defer wg.Wait()
+
+		// following is the set of instance names whose logs are being
+		// streamed. Only this goroutine adds to it, and each instance's
+		// goroutine removes its instance once its stream ends.
+		following := make(map[string]bool)
+		var followingMu sync.Mutex
+
+		for {
+			for i := range instances {
+				instance := instances[i]
+
+				followingMu.Lock()
+				followed := following[instance.Name]
+				followingMu.Unlock()
+				if followed {
+					continue
+				}
+
+				// Failing to open a stream is retried on the next poll.
+				instanceLines, err := c.StreamInstanceLogs(ctx, stack, workload, &instance)
+				if err != nil {
+					continue
+				}
+
+				followingMu.Lock()
+				following[instance.Name] = true
+				followingMu.Unlock()
+
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer func() {
+						followingMu.Lock()
+						delete(following, instance.Name)
+						followingMu.Unlock()
+					}()
+
+					for line := range instanceLines {
+						timestamp, text, _ := parseLogLine(line)
+						select {
+						case lines <- InstanceLogLine{
+							Instance:  instance.Name,
+							CityCode:  instance.Location.CityCode,
+							Timestamp: timestamp,
+							Text:      text,
+						}:
+						case <-ctx.Done():
+							return
+						}
+					}
+				}()
+			}
+
+			select {
+			case <-time.After(5 * time.Second):
+			case <-ctx.Done():
+				return
+			}
+
+			// Ignore errors while polling and try again on the next tick.
+			polled, err := c.GetInstances(ctx, stack, workload)
+			if err == nil {
+				instances = polled
+			}
+		}
+	}()
+
+	return lines, nil
+}
+
+// StreamScalingEvents polls a workload's targets every five seconds and sends a
+// ScalingEvent whenever a target's desired replica count changes. Replica
+// counts when the stream starts are taken as the baseline and aren't sent. The
+// channel is closed when ctx is cancelled.
+func (c *Client) StreamScalingEvents(ctx context.Context, stack *Stack, workload *Workload) (<-chan ScalingEvent, error) {
+	targets, err := c.GetWorkloadTargets(ctx, stack, workload)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan ScalingEvent)
+	go func() {
+		defer close(events)
+
+		// replicas is a mapping of target name -> its most recently seen
+		// desired replica count.
+		replicas := make(map[string]int, len(targets))
+		for _, target := range targets {
+			replicas[target.Name] = target.DesiredReplicas
+		}
+
+		for {
+			select {
+			case <-time.After(5 * time.Second):
+			case <-ctx.Done():
+				return
+			}
+
+			targets, err := c.GetWorkloadTargets(ctx, stack, workload)
+
+			// Ignore errors while polling and try again on the next tick.
+			if err != nil {
+				continue
+			}
+
+			for _, target := range targets {
+				previous, found := replicas[target.Name]
+				replicas[target.Name] = target.DesiredReplicas
+				if !found || previous == target.DesiredReplicas {
+					continue
+				}
+
+				select {
+				case events <- ScalingEvent{
+					Target:    target.Name,
+					CityCodes: target.CityCodes,
+					From:      previous,
+					To:        target.DesiredReplicas,
+					Time:      time.Now(),
+				}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+// parseLogLine splits a log line requested with timestamps=true into its
+// leading RFC3339 timestamp and the rest of the line. ok is false if the line
+// doesn't start with a timestamp.
+func parseLogLine(line string) (timestamp time.Time, text string, ok bool) {
+	parts := strings.SplitN(line, " ", 2)
+	timestamp, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return time.Time{}, line, false
+	}
+
+	if len(parts) == 2 {
+		text = parts[1]
+	}
+
+	return timestamp, text, true
+}
+
+// GetLocations lists the StackPath POPs that Edge Compute workloads can deploy
+// to.
+//
+// See: https://stackpath.dev/reference/locations#getlocations
+func (c *Client) GetLocations(ctx context.Context) ([]Location, error) {
+	var locations []Location
+	err := c.paginate(ctx, c.baseURL+"/workload/v1/locations", defaultMaxPages, func(body []byte) error {
+		page := struct {
+			Results []Location `json:"results"`
+		}{}
+		err := json.Unmarshal(body, &page)
+		if err != nil {
+			return err
+		}
+
+		locations = append(locations, page.Results...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return locations, nil
+}
+
+// SuggestNearbyTargets builds a single workload target from the three
+// StackPath POPs closest to the machine running the demo, so latency demos
+// feel local to the audience. The demo machine is located by geolocating its
+// public IP address with ipinfo.io. DefaultTargets() is returned if the POPs or
+// the demo machine can't be located.
+func (c *Client) SuggestNearbyTargets(ctx context.Context) []Target {
+	locations, err := c.GetLocations(ctx)
+	if err != nil || len(locations) == 0 {
+		return DefaultTargets()
+	}
+
+	latitude, longitude, err := locatePublicIP(ctx)
+	if err != nil {
+		return DefaultTargets()
+	}
+
+	sort.SliceStable(locations, func(i, j int) bool {
+		return distance(latitude, longitude, locations[i].Latitude, locations[i].Longitude) <
+			distance(latitude, longitude, locations[j].Latitude, locations[j].Longitude)
+	})
+
+	var cityCodes []string
+	for i := 0; i < len(locations) && i < 3; i++ {
+		cityCodes = append(cityCodes, locations[i].CityCode)
+	}
+
+	return []Target{
+		{
+			Name:           "nearby",
+			CityCodes:      cityCodes,
+			MinReplicas:    1,
+			MaxReplicas:    2,
+			ScaleMetric:    ScaleMetricCPU,
+			ScaleThreshold: 50,
+		},
+	}
+}
+
+// geolocationClient calls ipinfo.io. Its timeout keeps an unreachable service
+// from holding up the demo's startup.
+var geolocationClient = &http.Client{Timeout: 5 * time.Second}
+
+// locatePublicIP looks up the latitude and longitude of the demo machine's
+// public IP address. This calls ipinfo.io directly rather than through Do() so
+// the StackPath bearer token isn't sent to a third party.
+func locatePublicIP(ctx context.Context) (float64, float64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://ipinfo.io/json", nil)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	res, err := geolocationClient.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return 0, 0, err
+	}
+	err = res.Body.Close()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if res.StatusCode >= 300 {
+		return 0, 0, fmt.Errorf("%s: %s", res.Status, body)
+	}
+
+	// ipinfo.io reports coordinates as a "latitude,longitude" string.
+	ipInfo := struct {
+		Loc string `json:"loc"`
+	}{}
+	err = json.Unmarshal(body, &ipInfo)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	parts := strings.Split(ipInfo.Loc, ",")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("unable to parse location %q", ipInfo.Loc)
+	}
+
+	latitude, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	longitude, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return latitude, longitude, nil
+}
+
+// distance calculates the great-circle distance in kilometers between two
+// points with the haversine formula.
+func distance(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadius = 6371
+
+	dLat := (lat2 - lat1) * math.Pi / 180
+	dLon := (lon2 - lon1) * math.Pi / 180
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*math.Pi/180)*math.Cos(lat2*math.Pi/180)*math.Sin(dLon/2)*math.Sin(dLon/2)
+
+	return earthRadius * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+// GetInstanceStartupTiming derives the timestamps of an instance's startup
+// phases from the instance's metadata and container statuses.
+//
+// See: https://stackpath.dev/reference/instances#getworkloadinstance
+func (c *Client) GetInstanceStartupTiming(ctx context.Context, stack *Stack, workload *Workload, instance *Instance) (*InstanceStartupTiming, error) {
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodGet,
+		fmt.Sprintf(
+			c.baseURL+"/workload/v1/stacks/%s/workloads/%s/instances/%s",
+			stack.Slug,
+			workload.Slug,
+			instance.Name,
+		),
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	err = res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	instanceRes := struct {
+		Instance struct {
+			Metadata struct {
+				CreatedAt time.Time `json:"createdAt"`
+			} `json:"metadata"`
+			StartedAt         time.Time `json:"startedAt"`
+			ContainerStatuses []struct {
+				Running struct {
+					StartedAt time.Time `json:"startedAt"`
+				} `json:"running"`
+			} `json:"containerStatuses"`
+		} `json:"instance"`
+	}{}
+	err = json.Unmarshal(body, &instanceRes)
+	if err != nil {
+		return nil, err
+	}
+
+	timing := &InstanceStartupTiming{
+		Scheduled:        instanceRes.Instance.Metadata.CreatedAt,
+		ContainerStarted: instanceRes.Instance.StartedAt,
+	}
+
+	// The instance is running once its last container is.
+	for _, status := range instanceRes.Instance.ContainerStatuses {
+		if status.Running.StartedAt.IsZero() {
+			return timing, nil
+		}
+
+		if status.Running.StartedAt.After(timing.Running) {
+			timing.Running = status.Running.StartedAt
+		}
+	}
+
+	return timing, nil
+}
+
+// GetInstanceMetrics gets an instance's CPU and memory utilization samples from
+// `since` until now at the given step between samples. A zero step uses one
+// minute.
+//
+// See: https://stackpath.dev/reference/metrics-1#getmetrics
+func (c *Client) GetInstanceMetrics(ctx context.Context, stack *Stack, workload *Workload, instanceName string, since time.Time, step time.Duration) (*InstanceMetrics, error) {
+	if step <= 0 {
+		step = time.Minute
+	}
+
+	cpu, err := c.getInstanceMetricSamples(ctx, stack, workload, instanceName, "CPU", since, step)
+	if err != nil {
+		return nil, err
+	}
+
+	memory, err := c.getInstanceMetricSamples(ctx, stack, workload, instanceName, "MEMORY", since, step)
+	if err != nil {
+		return nil, err
+	}
+
+	return &InstanceMetrics{CPU: cpu, Memory: memory}, nil
+}
+
+// getInstanceMetricSamples gets one type of an instance's metric samples,
+// ordered oldest to newest.
+func (c *Client) getInstanceMetricSamples(ctx context.Context, stack *Stack, workload *Workload, instanceName, metricType string, since time.Time, step time.Duration) ([]MetricSample, error) {
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodGet,
+		fmt.Sprintf(
+			c.baseURL+"/workload/v1/stacks/%s/metrics?workload_id=%s&instance_name=%s&type=%s&start_date=%s&end_date=%s&granularity=PT%dS",
+			stack.Slug,
+			workload.ID,
+			url.QueryEscape(instanceName),
+			metricType,
+			since.UTC().Format(time.RFC3339),
+			c.ServerNow().UTC().Format(time.RFC3339),
+			int(step.Seconds()),
+		),
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	err = res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// Samples come back as Prometheus style matrix results, with the sample
+	// time and value both encoded as strings.
+	results := struct {
+		Data struct {
+			Matrix struct {
+				Results []struct {
+					Values []struct {
+						UnixTime string `json:"unixTime"`
+						Value    string `json:"value"`
+					} `json:"values"`
+				} `json:"results"`
+			} `json:"matrix"`
+		} `json:"data"`
+	}{}
+	err = json.Unmarshal(body, &results)
+	if err != nil {
+		return nil, err
+	}
+
+	var samples []MetricSample
+	for _, result := range results.Data.Matrix.Results {
+		for _, value := range result.Values {
+			unixTime, err := strconv.ParseInt(value.UnixTime, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s sample time %q: %w", strings.ToLower(metricType), value.UnixTime, err)
+			}
+
+			v, err := strconv.ParseFloat(value.Value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s sample value %q: %w", strings.ToLower(metricType), value.Value, err)
+			}
+
+			samples = append(samples, MetricSample{Time: time.Unix(unixTime, 0), Value: v})
+		}
+	}
+
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i].Time.Before(samples[j].Time)
+	})
+
+	return samples, nil
 }
@@ -0,0 +1,67 @@
+package stackpath
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestValidateTargetsResourceOverrides(t *testing.T) {
+	tests := []struct {
+		name    string
+		cpu     string
+		memory  string
+		wantErr string
+	}{
+		{name: "no overrides"},
+		{name: "whole cores", cpu: "2", memory: "4Gi"},
+		{name: "millicores", cpu: "500m", memory: "512Mi"},
+		{name: "decimal units", cpu: "1.5", memory: "2G"},
+		{name: "invalid CPU", cpu: "two", wantErr: `target "demo": invalid CPU quantity "two"`},
+		{name: "zero CPU", cpu: "0", wantErr: `target "demo": CPU quantity "0" must be greater than zero`},
+		{name: "invalid memory", memory: "2GB", wantErr: `target "demo": invalid memory quantity "2GB"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			target := DefaultTargets()[0]
+			target.Name = "demo"
+			target.CPU = test.cpu
+			target.Memory = test.memory
+
+			err := validateTargets([]Target{target})
+			if test.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("expected an error containing %q, got %v", test.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestDemoVersionRoundTrip(t *testing.T) {
+	spec := DefaultWorkloadSpec()
+	spec.SetDemoVersion("1.2.3")
+
+	// Read the request body's container back as the API would return it.
+	body, err := json.Marshal(map[string]interface{}{"spec": buildWorkload(spec)["spec"]})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var res workloadResponse
+	err = json.Unmarshal(body, &res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := res.toWorkload().Env[DemoVersionEnv]
+	if got != "1.2.3" {
+		t.Fatalf("expected %s 1.2.3, got %q", DemoVersionEnv, got)
+	}
+}
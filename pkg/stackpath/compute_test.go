@@ -0,0 +1,451 @@
+package stackpath_test
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/url"
+	"stackpath-demonstration-app/pkg/stackpath"
+	"stackpath-demonstration-app/pkg/stackpath/stackpathtest"
+	"testing"
+	"time"
+)
+
+// The API paths of the default fixtures' workload, by ID and by slug.
+const (
+	workloadsPath      = "/workload/v1/stacks/" + stackpathtest.StackSlug + "/workloads"
+	workloadIDPath     = workloadsPath + "/" + stackpathtest.WorkloadID
+	workloadSlugPath   = workloadsPath + "/" + stackpathtest.WorkloadSlug
+	instancePath       = workloadSlugPath + "/instances/" + stackpathtest.InstanceName
+	pausedWorkloadJSON = `{"workload": {
+  "id": "` + stackpathtest.WorkloadID + `",
+  "slug": "` + stackpathtest.WorkloadSlug + `",
+  "name": "` + stackpathtest.WorkloadName + `",
+  "metadata": {"annotations": {"demo.stackpath.dev/paused-replicas": "{\"north-america\":{\"minReplicas\":1,\"maxReplicas\":2}}"}},
+  "targets": {
+    "north-america": {
+      "spec": {
+        "deploymentScope": "cityCode",
+        "deployments": {
+          "minReplicas": 0,
+          "maxReplicas": 0,
+          "selectors": [{"key": "cityCode", "operator": "in", "values": ["DFW"]}]
+        }
+      }
+    }
+  }
+}}`
+)
+
+func TestComputeRequests(t *testing.T) {
+	since := time.Date(2021, 3, 2, 15, 4, 5, 0, time.UTC)
+
+	runRequestTests(t, []requestTest{
+		{
+			name: "CreateWorkload",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.CreateWorkload(ctx, testStack, stackpath.DefaultWorkloadSpec())
+				return err
+			},
+			want: wantRequest{
+				method: http.MethodPost,
+				path:   workloadsPath,
+				body: `{"workload": {
+  "name": "My compute origin",
+  "spec": {"containers": {"my-app": {
+    "image": "kennethreitz/httpbin:latest",
+    "resources": {"requests": {"cpu": "1", "memory": "2Gi"}}
+  }}},
+  "targets": {
+    "north-america": {"spec": {"deploymentScope": "cityCode", "deployments": {"minReplicas": 1, "maxReplicas": 2}}},
+    "europe": {"spec": {"deploymentScope": "cityCode", "deployments": {"minReplicas": 1, "maxReplicas": 2}}}
+  }
+}}`,
+			},
+		},
+		{
+			name: "FindWorkloadByName",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.FindWorkloadByName(ctx, testStack, stackpathtest.WorkloadName)
+				return err
+			},
+			want: wantRequest{
+				method: http.MethodGet,
+				path:   workloadsPath,
+				query:  url.Values{"page_request.filter": {`name="` + stackpathtest.WorkloadName + `"`}},
+			},
+		},
+		{
+			name: "GetWorkload",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.GetWorkload(ctx, testStack, stackpathtest.WorkloadSlug)
+				return err
+			},
+			want: wantRequest{method: http.MethodGet, path: workloadSlugPath},
+		},
+		{
+			name: "ListWorkloads",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.ListWorkloads(ctx, testStack)
+				return err
+			},
+			want: wantRequest{method: http.MethodGet, path: workloadsPath},
+		},
+		{
+			name: "GetWorkloadTargets",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.GetWorkloadTargets(ctx, testStack, testWorkload)
+				return err
+			},
+			want: wantRequest{method: http.MethodGet, path: workloadIDPath},
+		},
+		{
+			name: "PauseWorkload",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				return client.PauseWorkload(ctx, testStack, testWorkload)
+			},
+			want: wantRequest{
+				method: http.MethodPatch,
+				path:   workloadIDPath,
+				body: `{"workload": {
+  "metadata": {"annotations": {"demo.stackpath.dev/paused-replicas": "{\"north-america\":{\"minReplicas\":1,\"maxReplicas\":2}}"}},
+  "targets": {"north-america": {"spec": {"deployments": {"minReplicas": 0, "maxReplicas": 0}}}}
+}}`,
+			},
+		},
+		{
+			name: "ResumeWorkload",
+			setup: func(server *stackpathtest.Server) {
+				server.HandleJSON(http.MethodGet, workloadIDPath, http.StatusOK, pausedWorkloadJSON)
+			},
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				return client.ResumeWorkload(ctx, testStack, testWorkload)
+			},
+			want: wantRequest{
+				method: http.MethodPatch,
+				path:   workloadIDPath,
+				body: `{"workload": {
+  "metadata": {"annotations": {"demo.stackpath.dev/paused-replicas": null}},
+  "targets": {"north-america": {"spec": {"deployments": {"minReplicas": 1, "maxReplicas": 2}}}}
+}}`,
+			},
+		},
+		{
+			name: "DeleteWorkload",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				return client.DeleteWorkload(ctx, testStack, testWorkload)
+			},
+			want: wantRequest{method: http.MethodDelete, path: workloadIDPath},
+		},
+		{
+			name: "GetInstances",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.GetInstances(ctx, testStack, testWorkload)
+				return err
+			},
+			want: wantRequest{method: http.MethodGet, path: workloadSlugPath + "/instances"},
+		},
+		{
+			name: "GetWorkloadStatus",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.GetWorkloadStatus(ctx, testStack, testWorkload)
+				return err
+			},
+			want: wantRequest{method: http.MethodGet, path: workloadSlugPath + "/instances"},
+		},
+		{
+			name: "GetInstance",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.GetInstance(ctx, testStack, testWorkload, stackpathtest.InstanceName)
+				return err
+			},
+			want: wantRequest{method: http.MethodGet, path: instancePath},
+		},
+		{
+			name: "RestartInstance",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				return client.RestartInstance(ctx, testStack, testWorkload, stackpathtest.InstanceName)
+			},
+			want: wantRequest{method: http.MethodPost, path: instancePath + "/power/restart"},
+		},
+		{
+			name: "GetInstanceLogs",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.GetInstanceLogs(ctx, testStack, testWorkload, testInstance, since, 10)
+				return err
+			},
+			want: wantRequest{
+				method: http.MethodGet,
+				path:   instancePath + "/logs",
+				query: url.Values{
+					"timestamps": {"true"},
+					"since_time": {"2021-03-02T15:04:05Z"},
+					"tail_lines": {"10"},
+				},
+			},
+		},
+		{
+			name: "GetWorkloadLogs",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.GetWorkloadLogs(ctx, testStack, testWorkload, since, 0)
+				return err
+			},
+			want: wantRequest{
+				method: http.MethodGet,
+				path:   workloadSlugPath + "/logs",
+				query:  url.Values{"timestamps": {"true"}, "since_time": {"2021-03-02T15:04:05Z"}, "tail_lines": nil},
+			},
+		},
+		{
+			name: "GetWorkloadLogs since a local time",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.GetWorkloadLogs(ctx, testStack, testWorkload, since.In(time.FixedZone("CET", 60*60)), 0)
+				return err
+			},
+			want: wantRequest{
+				method: http.MethodGet,
+				path:   workloadSlugPath + "/logs",
+				query:  url.Values{"since_time": {"2021-03-02T15:04:05Z"}},
+			},
+		},
+		{
+			name: "GetWorkloadLogs falls back to instance logs",
+			setup: func(server *stackpathtest.Server) {
+				server.HandleJSON(http.MethodGet, workloadSlugPath+"/logs", http.StatusNotImplemented, `{"code": 12, "message": "not implemented"}`)
+			},
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.GetWorkloadLogs(ctx, testStack, testWorkload, since, 0)
+				return err
+			},
+			want: wantRequest{
+				method: http.MethodGet,
+				path:   instancePath + "/logs",
+				query:  url.Values{"since_time": {"2021-03-02T15:04:05Z"}},
+			},
+		},
+		{
+			name: "GetInstanceJSONLogs",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.GetInstanceJSONLogs(ctx, testStack, testWorkload, testInstance, since)
+				return err
+			},
+			want: wantRequest{
+				method: http.MethodGet,
+				path:   instancePath + "/logs",
+				query:  url.Values{"since_time": {"2021-03-02T15:04:05Z"}},
+			},
+		},
+		{
+			name: "TailInstanceLogs",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.TailInstanceLogs(ctx, testStack, testWorkload, testInstance, 5)
+				return err
+			},
+			want: wantRequest{
+				method: http.MethodGet,
+				path:   instancePath + "/logs",
+				query:  url.Values{"timestamps": {"true"}, "tail_lines": {"5"}},
+			},
+		},
+		{
+			name: "StreamInstanceLogs",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				ctx, cancel := context.WithCancel(ctx)
+				defer cancel()
+
+				_, err := client.StreamInstanceLogs(ctx, testStack, testWorkload, testInstance)
+				return err
+			},
+			want: wantRequest{
+				method: http.MethodGet,
+				path:   instancePath + "/logs",
+				query:  url.Values{"timestamps": {"true"}, "follow": {"true"}},
+			},
+		},
+		{
+			name: "StreamAllInstanceLogs",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				ctx, cancel := context.WithCancel(ctx)
+				defer cancel()
+
+				_, err := client.StreamAllInstanceLogs(ctx, testStack, testWorkload)
+				return err
+			},
+			want: wantRequest{method: http.MethodGet, path: workloadSlugPath + "/instances"},
+		},
+		{
+			name: "StreamScalingEvents",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				ctx, cancel := context.WithCancel(ctx)
+				defer cancel()
+
+				_, err := client.StreamScalingEvents(ctx, testStack, testWorkload)
+				return err
+			},
+			want: wantRequest{method: http.MethodGet, path: workloadIDPath},
+		},
+		{
+			name: "GetLocations",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.GetLocations(ctx)
+				return err
+			},
+			want: wantRequest{method: http.MethodGet, path: "/workload/v1/locations"},
+		},
+		{
+			name: "GetInstanceStartupTiming",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.GetInstanceStartupTiming(ctx, testStack, testWorkload, testInstance)
+				return err
+			},
+			want: wantRequest{method: http.MethodGet, path: instancePath},
+		},
+		{
+			name: "GetInstanceMetrics",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.GetInstanceMetrics(ctx, testStack, testWorkload, stackpathtest.InstanceName, since, 5*time.Minute)
+				return err
+			},
+			want: wantRequest{
+				method: http.MethodGet,
+				path:   "/workload/v1/stacks/" + stackpathtest.StackSlug + "/metrics",
+				query: url.Values{
+					"workload_id":   {stackpathtest.WorkloadID},
+					"instance_name": {stackpathtest.InstanceName},
+					"type":          {"MEMORY"},
+					"start_date":    {"2021-03-02T15:04:05Z"},
+					"granularity":   {"PT300S"},
+				},
+			},
+		},
+	})
+}
+
+func TestPauseWorkloadAlreadyPaused(t *testing.T) {
+	server, client := newTestClient(t)
+	server.HandleJSON(http.MethodGet, workloadIDPath, http.StatusOK, pausedWorkloadJSON)
+
+	err := client.PauseWorkload(context.Background(), testStack, testWorkload)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// Pausing again would overwrite the saved replica counts with zeros.
+	if requests := server.RequestsTo(http.MethodPatch, workloadIDPath); len(requests) != 0 {
+		t.Fatalf("expected no update, got %d", len(requests))
+	}
+}
+
+func TestResumeWorkloadNotPaused(t *testing.T) {
+	_, client := newTestClient(t)
+
+	err := client.ResumeWorkload(context.Background(), testStack, testWorkload)
+	if err == nil {
+		t.Fatal("expected an error resuming a workload that isn't paused")
+	}
+}
+
+func TestCreateWorkloadEnv(t *testing.T) {
+	server, client := newTestClient(t)
+
+	spec := stackpath.DefaultWorkloadSpec()
+	spec.Env = map[string]string{"LOG_LEVEL": "debug", "APP_MODE": "demo"}
+	spec.SecretEnv = map[string]string{"API_KEY": "hunter2"}
+	_, err := client.CreateWorkload(context.Background(), testStack, spec)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// Variables are sent sorted by name, with secrets as secretValue.
+	assertRequest(t, server, wantRequest{
+		method: http.MethodPost,
+		path:   workloadsPath,
+		body: `{"workload": {"spec": {"containers": {"my-app": {"env": [
+  {"key": "API_KEY", "secretValue": "hunter2"},
+  {"key": "APP_MODE", "value": "demo"},
+  {"key": "LOG_LEVEL", "value": "debug"}
+]}}}}}`,
+	})
+}
+
+func TestEstimateWorkloadCost(t *testing.T) {
+	estimate, err := stackpath.EstimateWorkloadCost(stackpath.DefaultWorkloadSpec(), time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// One to two instances in each of DFW, FRA, and AMS.
+	if estimate.MinInstances != 3 || estimate.MaxInstances != 6 {
+		t.Errorf("expected 3-6 instances, got %d-%d", estimate.MinInstances, estimate.MaxInstances)
+	}
+	if estimate.Max != 2*estimate.Min || estimate.Currency != "USD" {
+		t.Errorf("unexpected estimate %+v", estimate)
+	}
+}
+
+func TestEstimateWorkloadCostPricesResources(t *testing.T) {
+	spec := stackpath.DefaultWorkloadSpec()
+	baseline, err := stackpath.EstimateWorkloadCost(spec, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// Halving every instance's resources halves the cost.
+	spec.Resources.Requests = stackpath.ResourceList{CPU: "500m", Memory: "1Gi"}
+	estimate, err := stackpath.EstimateWorkloadCost(spec, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if estimate.Min*2 != baseline.Min {
+		t.Errorf("expected half of %.4f, got %.4f", baseline.Min, estimate.Min)
+	}
+
+	// Overriding one target's resources only changes that target's share.
+	spec = stackpath.DefaultWorkloadSpec()
+	spec.Targets[0].CPU = "2"
+	spec.Targets[0].Memory = "4Gi"
+	estimate, err = stackpath.EstimateWorkloadCost(spec, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if want := baseline.Min * 4 / 3; math.Abs(estimate.Min-want) > 1e-9 {
+		t.Errorf("expected %.4f, got %.4f", want, estimate.Min)
+	}
+
+	// Targets that aren't scoped by city code run MinReplicas in total.
+	spec = stackpath.DefaultWorkloadSpec()
+	spec.Targets = []stackpath.Target{{Name: "global", DeploymentScope: "region", CityCodes: []string{"DFW", "FRA"}, MinReplicas: 1, MaxReplicas: 3}}
+	estimate, err = stackpath.EstimateWorkloadCost(spec, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if estimate.MinInstances != 1 || estimate.MaxInstances != 3 {
+		t.Errorf("expected 1-3 instances, got %d-%d", estimate.MinInstances, estimate.MaxInstances)
+	}
+
+	spec.Targets[0].CPU = "lots"
+	if _, err := stackpath.EstimateWorkloadCost(spec, time.Hour); err == nil {
+		t.Error("expected an error for an invalid CPU override")
+	}
+}
+
+func TestParseAccessLog(t *testing.T) {
+	_, client := newTestClient(t)
+
+	entries, unparsed := client.ParseAccessLog(
+		"2021-03-02T15:04:05.000000000Z 10.0.0.1 - - [02/Mar/2021:15:04:05 +0000] \"GET /get HTTP/1.1\" 200 612\n" +
+			"2021-03-02T15:04:06.000000000Z [INFO] Booting worker with pid: 9\n",
+	)
+
+	if len(entries) != 1 || len(unparsed) != 1 {
+		t.Fatalf("expected 1 entry and 1 unparsed line, got %+v and %q", entries, unparsed)
+	}
+
+	entry := entries[0]
+	if entry.ClientIP != "10.0.0.1" || entry.Method != http.MethodGet || entry.Path != "/get" || entry.Status != 200 || entry.Bytes != 612 {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+	if !entry.Timestamp.Equal(time.Date(2021, 3, 2, 15, 4, 5, 0, time.UTC)) {
+		t.Errorf("expected the log line's timestamp, got %s", entry.Timestamp)
+	}
+}
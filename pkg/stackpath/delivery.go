@@ -2,22 +2,31 @@ package stackpath
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
 
-// Site models a StackPath CDN delivery site.
+// Site models a StackPath CDN delivery site. Domain is the domain name the site
+// was created for and Features are the services enabled on it, like "CDN" and
+// "WAF".
 type Site struct {
-	ID string `json:"id"`
+	ID       string   `json:"id"`
+	Domain   string   `json:"label"`
+	Features []string `json:"features"`
 }
 
 // WAFRequest models an individual request captured by the StackPath WAF.
 // Requests have key aspects of the client's HTTP request against the site and
-// the action the WAF took.
+// the action the WAF took. Requests matching a rule in log-only mode have the
+// WAFActionMonitor action.
 type WAFRequest struct {
 	ID          string    `json:"id"`
 	Action      string    `json:"action"`
@@ -30,11 +39,131 @@ type WAFRequest struct {
 	RequestTime time.Time `json:"requestTime"`
 }
 
+// Certificate models an SSL certificate on a StackPath stack.
+type Certificate struct {
+	ID                      string    `json:"id"`
+	CommonName              string    `json:"commonName"`
+	SubjectAlternativeNames []string  `json:"subjectAlternativeNames"`
+	ExpirationDate          time.Time `json:"expirationDate"`
+	Status                  string    `json:"status"`
+}
+
+// Covers determines if a certificate is valid for a hostname, either directly
+// or through a wildcard name.
+func (cert Certificate) Covers(hostname string) bool {
+	hostname = strings.ToLower(hostname)
+	for _, name := range append([]string{cert.CommonName}, cert.SubjectAlternativeNames...) {
+		name = strings.ToLower(name)
+		if name == hostname {
+			return true
+		}
+
+		if strings.HasPrefix(name, "*.") {
+			i := strings.Index(hostname, ".")
+			if i != -1 && hostname[i+1:] == name[2:] {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// The states an SSL certificate passes through while it's provisioned.
+const (
+	SSLCertStatusPendingValidation = "PENDING_VALIDATION"
+	SSLCertStatusIssued            = "ISSUED"
+	SSLCertStatusError             = "ERROR"
+)
+
+// SSLCertificate models the provisioning state of the SSL certificate on a
+// site. Certificates verified over DNS are issued once StackPath sees the
+// ValidationRecords.
+type SSLCertificate struct {
+	ID                string                `json:"id"`
+	Status            string                `json:"status"`
+	ExpirationDate    time.Time             `json:"expirationDate"`
+	ValidationRecords []SSLValidationRecord `json:"validationRecords"`
+}
+
+// SSLValidationRecord models a DNS record that proves control of a domain to
+// the certificate authority.
+type SSLValidationRecord struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// OriginTimeouts models how long the CDN waits on a site's origin. Connect is
+// how long to wait for a connection and Read is how long to wait for a
+// response once connected. Zero values use the platform defaults.
+type OriginTimeouts struct {
+	Connect time.Duration
+	Read    time.Duration
+}
+
+// OriginStatusDistribution models how many of a site's origin responses fell in
+// each HTTP status class.
+type OriginStatusDistribution struct {
+	Status2xx int
+	Status3xx int
+	Status4xx int
+	Status5xx int
+}
+
+// Granularities of the buckets GetSiteAnalytics() can return.
+const (
+	SiteMetricGranularity5Minutes = "PT5M"
+	SiteMetricGranularityHour     = "PT1H"
+	SiteMetricGranularityDay      = "P1D"
+	SiteMetricGranularityMonth    = "P1M"
+)
+
+// SiteMetric models a site's CDN traffic over one time bucket starting at Time.
+// CacheHitRatio is the share of requests served from the CDN's cache without
+// going to the origin, from 0 to 1.
+type SiteMetric struct {
+	Time           time.Time
+	BandwidthBytes int64
+	Requests       int64
+	CacheHitRatio  float64
+}
+
 // CreateSiteDelivery creates a delivery site on the StackPath CDN with WAF
-// service enabled.
+// service enabled. The CDN gives up on the origin after the given timeouts,
+// returning a 504 Gateway Timeout to the client. Timeouts are sent in whole
+// seconds. A *QuotaExceededError is returned if the account can't have any
+// more sites.
 //
 // See: https://stackpath.dev/reference/sites#createsite-1
-func (c *Client) CreateSiteDelivery(stack *Stack, originIP, domainName string) (*Site, error) {
+func (c *Client) CreateSiteDelivery(ctx context.Context, stack *Stack, originIP, domainName string, timeouts OriginTimeouts) (*Site, error) {
+	if timeouts.Connect < 0 || timeouts.Read < 0 {
+		return nil, fmt.Errorf("origin timeouts must not be negative")
+	}
+	if timeouts.Connect%time.Second != 0 || timeouts.Read%time.Second != 0 {
+		return nil, fmt.Errorf("origin timeouts must be a whole number of seconds, got %s and %s", timeouts.Connect, timeouts.Read)
+	}
+
+	// Only send the timeouts that were set.
+	originTimeouts := make(map[string]int)
+	if timeouts.Connect > 0 {
+		originTimeouts["connectTimeout"] = int(timeouts.Connect.Seconds())
+	}
+	if timeouts.Read > 0 {
+		originTimeouts["readTimeout"] = int(timeouts.Read.Seconds())
+	}
+
+	originTimeoutsJSON := ""
+	if len(originTimeouts) > 0 {
+		b, err := json.Marshal(originTimeouts)
+		if err != nil {
+			return nil, err
+		}
+
+		originTimeoutsJSON = `,
+    "originTimeouts": ` + string(b)
+	}
+
 	reqBody := bytes.NewBuffer([]byte(`{
   "domain": "` + domainName + `",
   "origin": {
@@ -46,12 +175,13 @@ func (c *Client) CreateSiteDelivery(stack *Stack, originIP, domainName string) (
   "configuration": {
     "originPullProtocol": {
       "protocol": "http"
-    }
+    }` + originTimeoutsJSON + `
   }
 }`))
-	req, err := http.NewRequest(
+	req, err := http.NewRequestWithContext(
+		ctx,
 		http.MethodPost,
-		fmt.Sprintf(baseURL+"/delivery/v1/stacks/%s/sites", stack.Slug),
+		fmt.Sprintf(c.baseURL+"/delivery/v1/stacks/%s/sites", stack.Slug),
 		reqBody,
 	)
 	if err != nil {
@@ -60,7 +190,7 @@ func (c *Client) CreateSiteDelivery(stack *Stack, originIP, domainName string) (
 
 	res, err := c.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, withQuotaResource(err, "site")
 	}
 
 	body, err := ioutil.ReadAll(res.Body)
@@ -83,15 +213,95 @@ func (c *Client) CreateSiteDelivery(stack *Stack, originIP, domainName string) (
 	return &newSite.Site, nil
 }
 
+// FindSiteByDomain searches a stack for the CDN delivery site serving a domain
+// name. A return value of nil means the site was not found. If more than one
+// site serves the domain name an *AmbiguousMatchError is returned rather than
+// picking one.
+//
+// See: https://stackpath.dev/reference/sites#getsites-1
+func (c *Client) FindSiteByDomain(ctx context.Context, stack *Stack, domainName string) (*Site, error) {
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodGet,
+		fmt.Sprintf(
+			c.baseURL+"/delivery/v1/stacks/%s/sites?page_request.filter=%s",
+			stack.Slug,
+			url.QueryEscape("label=\""+domainName+"\""),
+		),
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	err = res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	searchRes := struct {
+		Results []Site `json:"results"`
+	}{}
+	err = json.Unmarshal(body, &searchRes)
+	if err != nil {
+		return nil, err
+	}
+
+	// If results is empty then the site wasn't found.
+	if len(searchRes.Results) == 0 {
+		return nil, nil
+	}
+	if len(searchRes.Results) > 1 {
+		return nil, &AmbiguousMatchError{Resource: "site", Name: domainName, Count: len(searchRes.Results)}
+	}
+
+	return &searchRes.Results[0], nil
+}
+
+// ListSites lists every CDN delivery site on a stack, following every page of
+// results.
+//
+// See: https://stackpath.dev/reference/sites#getsites-1
+func (c *Client) ListSites(ctx context.Context, stack *Stack) ([]Site, error) {
+	var sites []Site
+	err := c.paginate(ctx, fmt.Sprintf(c.baseURL+"/delivery/v1/stacks/%s/sites", stack.Slug), defaultMaxPages, func(body []byte) error {
+		page := struct {
+			Results []Site `json:"results"`
+		}{}
+		err := json.Unmarshal(body, &page)
+		if err != nil {
+			return err
+		}
+
+		sites = append(sites, page.Results...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return sites, nil
+}
+
 // FindSiteDeliveryDomain retrieves a site's delivery domain, a hostname at
 // StackPath that fronts a site's CDN service. An empty string return value
 // means no delivery domains were found.
 //
 // See: https://stackpath.dev/reference/delivery-domains#getsitedeliverydomains2
-func (c *Client) FindSiteDeliveryDomain(stack *Stack, site *Site) (string, error) {
-	req, err := http.NewRequest(
+func (c *Client) FindSiteDeliveryDomain(ctx context.Context, stack *Stack, site *Site) (string, error) {
+	req, err := http.NewRequestWithContext(
+		ctx,
 		http.MethodGet,
-		fmt.Sprintf(baseURL+"/delivery/v1/stacks/%s/sites/%s/delivery_domains", stack.Slug, site.ID),
+		fmt.Sprintf(c.baseURL+"/delivery/v1/stacks/%s/sites/%s/delivery_domains", stack.Slug, site.ID),
 		nil,
 	)
 	if err != nil {
@@ -133,17 +343,109 @@ func (c *Client) FindSiteDeliveryDomain(stack *Stack, site *Site) (string, error
 	return "", nil
 }
 
+// DeleteSite deletes a CDN delivery site along with its WAF and SSL
+// configuration. Deleting a site that's already gone isn't an error. Other
+// failures are returned as an *APIError.
+//
+// See: https://stackpath.dev/reference/sites#deletesite-1
+func (c *Client) DeleteSite(ctx context.Context, stack *Stack, site *Site) error {
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodDelete,
+		fmt.Sprintf(c.baseURL+"/delivery/v1/stacks/%s/sites/%s", stack.Slug, site.ID),
+		nil,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Do(req)
+	if IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// PurgeCache invalidates content cached on the CDN for a site. Paths are
+// relative to the site's domain, e.g. "/images/logo.png". An empty paths slice
+// purges everything cached for the site. The returned purge request ID can be
+// used to check on the purge's progress.
+//
+// See: https://stackpath.dev/reference/purge-content#purgecontent
+func (c *Client) PurgeCache(ctx context.Context, stack *Stack, site *Site, paths []string) (string, error) {
+	if site.Domain == "" {
+		return "", fmt.Errorf("site %s has no domain to purge", site.ID)
+	}
+
+	type purgeItem struct {
+		URL       string `json:"url"`
+		Recursive bool   `json:"recursive"`
+	}
+
+	items := make([]purgeItem, 0, len(paths))
+	for _, path := range paths {
+		items = append(items, purgeItem{URL: "https://" + site.Domain + "/" + strings.TrimPrefix(path, "/")})
+	}
+	if len(items) == 0 {
+		items = append(items, purgeItem{URL: "https://" + site.Domain + "/", Recursive: true})
+	}
+
+	reqBody, err := json.Marshal(map[string]interface{}{"items": items})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		fmt.Sprintf(c.baseURL+"/cdn/v1/stacks/%s/purge", stack.Slug),
+		bytes.NewBuffer(reqBody),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := c.Do(req)
+	if err != nil {
+		return "", err
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	err = res.Body.Close()
+	if err != nil {
+		return "", err
+	}
+
+	purgeRes := struct {
+		ID string `json:"id"`
+	}{}
+	err = json.Unmarshal(body, &purgeRes)
+	if err != nil {
+		return "", err
+	}
+
+	return purgeRes.ID, nil
+}
+
 // RequestFreeSSLCert provisions an auto-renewing free SSL certificate on the
 // given site. Verification is done automatically over DNS.
 //
 // See: https://stackpath.dev/reference/ssl-1#requestcertificate
-func (c *Client) RequestFreeSSLCert(stack *Stack, site *Site) error {
+func (c *Client) RequestFreeSSLCert(ctx context.Context, stack *Stack, site *Site) error {
 	reqBody := bytes.NewBuffer([]byte(`{
   "verificationMethod": "DNS"
 }`))
-	req, err := http.NewRequest(
+	req, err := http.NewRequestWithContext(
+		ctx,
 		http.MethodPost,
-		fmt.Sprintf(baseURL+"/cdn/v1/stacks/%s/sites/%s/certificates/request", stack.Slug, site.ID),
+		fmt.Sprintf(c.baseURL+"/cdn/v1/stacks/%s/sites/%s/certificates/request", stack.Slug, site.ID),
 		reqBody,
 	)
 	if err != nil {
@@ -157,3 +459,348 @@ func (c *Client) RequestFreeSSLCert(stack *Stack, site *Site) error {
 
 	return nil
 }
+
+// ListCertificates retrieves the SSL certificates on a stack.
+//
+// See: https://stackpath.dev/reference/ssl-1#getcertificates
+func (c *Client) ListCertificates(ctx context.Context, stack *Stack) ([]Certificate, error) {
+	var certs []Certificate
+	err := c.paginate(ctx, fmt.Sprintf(c.baseURL+"/cdn/v1/stacks/%s/certificates", stack.Slug), defaultMaxPages, func(body []byte) error {
+		page := struct {
+			Results []Certificate `json:"results"`
+		}{}
+		err := json.Unmarshal(body, &page)
+		if err != nil {
+			return err
+		}
+
+		certs = append(certs, page.Results...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return certs, nil
+}
+
+// EnsureSSLCert makes sure a site has an SSL certificate for a hostname. An
+// issued, unexpired certificate already attached to the site that covers the
+// hostname is reused so repeated runs don't hit certificate issuance rate
+// limits. Otherwise a free certificate is requested. The returned bool is true
+// if an existing certificate was reused.
+func (c *Client) EnsureSSLCert(ctx context.Context, stack *Stack, site *Site, hostname string) (bool, error) {
+	certs, err := c.getSiteCertificates(ctx, stack, site)
+	if err != nil {
+		return false, err
+	}
+
+	for _, cert := range certs {
+		if cert.Certificate.Status == SSLCertStatusIssued &&
+			cert.Certificate.ExpirationDate.After(time.Now()) &&
+			cert.Certificate.Covers(hostname) {
+			return true, nil
+		}
+	}
+
+	err = c.RequestFreeSSLCert(ctx, stack, site)
+	if err != nil {
+		return false, err
+	}
+
+	return false, nil
+}
+
+// GetOriginStatusDistribution counts the responses a site's origin returned to
+// the CDN from `since` until now by HTTP status class, based on the CDN's
+// delivery metrics.
+//
+// See: https://stackpath.dev/reference/metrics#getmetrics
+func (c *Client) GetOriginStatusDistribution(ctx context.Context, stack *Stack, site *Site, since time.Time) (*OriginStatusDistribution, error) {
+	totals, err := c.getSiteMetricTotals(ctx, stack, site, since, c.ServerNow())
+	if err != nil {
+		return nil, err
+	}
+
+	return &OriginStatusDistribution{
+		Status2xx: int(totals["originStatus2xx"]),
+		Status3xx: int(totals["originStatus3xx"]),
+		Status4xx: int(totals["originStatus4xx"]),
+		Status5xx: int(totals["originStatus5xx"]),
+	}, nil
+}
+
+// GetSiteAnalytics returns a site's CDN bandwidth, request count, and cache
+// hit ratio from `since` until `until` in time buckets of the given
+// granularity, oldest first. granularity must be one of the
+// SiteMetricGranularity* constants.
+//
+// See: https://stackpath.dev/reference/metrics#getmetrics
+func (c *Client) GetSiteAnalytics(ctx context.Context, stack *Stack, site *Site, since, until time.Time, granularity string) ([]SiteMetric, error) {
+	switch granularity {
+	case SiteMetricGranularity5Minutes, SiteMetricGranularityHour, SiteMetricGranularityDay, SiteMetricGranularityMonth:
+	default:
+		return nil, fmt.Errorf("unsupported granularity %q: must be one of %s, %s, %s, or %s", granularity, SiteMetricGranularity5Minutes, SiteMetricGranularityHour, SiteMetricGranularityDay, SiteMetricGranularityMonth)
+	}
+
+	samples, err := c.getSiteMetrics(ctx, stack, site, since, until, granularity)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := make([]SiteMetric, 0, len(samples))
+	for _, sample := range samples {
+		metric := SiteMetric{
+			Time:           sample.time,
+			BandwidthBytes: int64(sample.values["xferUsedTotalMB"] * 1000 * 1000),
+			Requests:       int64(sample.values["requestsCountTotal"]),
+		}
+
+		if metric.Requests > 0 {
+			metric.CacheHitRatio = 1 - sample.values["requestsCountOrigin"]/float64(metric.Requests)
+			if metric.CacheHitRatio < 0 {
+				metric.CacheHitRatio = 0
+			}
+		}
+
+		metrics = append(metrics, metric)
+	}
+
+	return metrics, nil
+}
+
+// getSiteMetricTotals sums each of a site's CDN delivery metrics over a time
+// window, keyed by metric name.
+func (c *Client) getSiteMetricTotals(ctx context.Context, stack *Stack, site *Site, since, until time.Time) (map[string]float64, error) {
+	samples, err := c.getSiteMetrics(ctx, stack, site, since, until, "")
+	if err != nil {
+		return nil, err
+	}
+
+	totals := make(map[string]float64)
+	for _, sample := range samples {
+		for metric, value := range sample.values {
+			totals[metric] += value
+		}
+	}
+
+	return totals, nil
+}
+
+// siteMetricSample is one time bucket of a site's CDN delivery metrics, keyed
+// by metric name.
+type siteMetricSample struct {
+	time   time.Time
+	values map[string]float64
+}
+
+// getSiteMetrics retrieves a site's CDN delivery metrics over a time window,
+// oldest first. Samples for the same time bucket from different series are
+// added together. An empty granularity leaves it up to the API.
+//
+// See: https://stackpath.dev/reference/metrics#getmetrics
+func (c *Client) getSiteMetrics(ctx context.Context, stack *Stack, site *Site, since, until time.Time, granularity string) ([]siteMetricSample, error) {
+	granularityQuery := ""
+	if granularity != "" {
+		granularityQuery = "&granularity=" + granularity
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodGet,
+		fmt.Sprintf(
+			c.baseURL+"/cdn/v1/stacks/%s/metrics?sites=%s&start_date=%s&end_date=%s%s",
+			stack.Slug,
+			site.ID,
+			url.QueryEscape(since.UTC().Format(time.RFC3339)),
+			url.QueryEscape(until.UTC().Format(time.RFC3339)),
+			granularityQuery,
+		),
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	err = res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// Metrics come back as series of samples. Each sample's values line up
+	// with the series' metric names. Timestamps are Unix seconds, sometimes
+	// quoted.
+	results := struct {
+		Series []struct {
+			Metrics []string `json:"metrics"`
+			Samples []struct {
+				Timestamp json.RawMessage `json:"timestamp"`
+				Values    []float64       `json:"values"`
+			} `json:"samples"`
+		} `json:"series"`
+	}{}
+	err = json.Unmarshal(body, &results)
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := make(map[int64]*siteMetricSample)
+	var samples []*siteMetricSample
+	for _, series := range results.Series {
+		for _, sample := range series.Samples {
+			var timestamp int64
+			if len(sample.Timestamp) > 0 {
+				timestamp, err = strconv.ParseInt(strings.Trim(string(sample.Timestamp), `"`), 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("parsing metric timestamp %s: %w", sample.Timestamp, err)
+				}
+			}
+
+			bucket, found := buckets[timestamp]
+			if !found {
+				bucket = &siteMetricSample{
+					time:   time.Unix(timestamp, 0),
+					values: make(map[string]float64),
+				}
+				buckets[timestamp] = bucket
+				samples = append(samples, bucket)
+			}
+
+			for i, value := range sample.Values {
+				if i < len(series.Metrics) {
+					bucket.values[series.Metrics[i]] += value
+				}
+			}
+		}
+	}
+
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i].time.Before(samples[j].time)
+	})
+
+	sorted := make([]siteMetricSample, 0, len(samples))
+	for _, sample := range samples {
+		sorted = append(sorted, *sample)
+	}
+
+	return sorted, nil
+}
+
+// GetSSLCertStatus gets the provisioning state of the SSL certificate on a
+// site. If the site has more than one certificate the most recently requested
+// one is returned. A nil certificate result means none has been requested yet.
+//
+// See: https://stackpath.dev/reference/ssl-1#getsitecertificates
+func (c *Client) GetSSLCertStatus(ctx context.Context, stack *Stack, site *Site) (*SSLCertificate, error) {
+	certs, err := c.getSiteCertificates(ctx, stack, site)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(certs) == 0 {
+		return nil, nil
+	}
+
+	latest := certs[0]
+	for _, cert := range certs[1:] {
+		if cert.CreatedAt.After(latest.CreatedAt) {
+			latest = cert
+		}
+	}
+
+	return &SSLCertificate{
+		ID:                latest.Certificate.ID,
+		Status:            latest.Certificate.Status,
+		ExpirationDate:    latest.Certificate.ExpirationDate,
+		ValidationRecords: latest.ValidationRecords,
+	}, nil
+}
+
+// siteCertificate is a certificate attached to a site.
+type siteCertificate struct {
+	Certificate       Certificate
+	ValidationRecords []SSLValidationRecord
+	CreatedAt         time.Time
+}
+
+// getSiteCertificates retrieves the SSL certificates attached to a site.
+//
+// See: https://stackpath.dev/reference/ssl-1#getsitecertificates
+func (c *Client) getSiteCertificates(ctx context.Context, stack *Stack, site *Site) ([]siteCertificate, error) {
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodGet,
+		fmt.Sprintf(c.baseURL+"/cdn/v1/stacks/%s/sites/%s/certificates", stack.Slug, site.ID),
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	err = res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	results := struct {
+		Results []struct {
+			Certificate struct {
+				Certificate
+				ValidationRecords []SSLValidationRecord `json:"validationRecords"`
+			} `json:"certificate"`
+			CreatedAt time.Time `json:"createdAt"`
+		} `json:"results"`
+	}{}
+	err = json.Unmarshal(body, &results)
+	if err != nil {
+		return nil, err
+	}
+
+	certs := make([]siteCertificate, len(results.Results))
+	for i, result := range results.Results {
+		certs[i] = siteCertificate{
+			Certificate:       result.Certificate.Certificate,
+			ValidationRecords: result.Certificate.ValidationRecords,
+			CreatedAt:         result.CreatedAt,
+		}
+	}
+
+	return certs, nil
+}
+
+// CertificateDaysUntilExpiry returns how many whole days remain until the SSL
+// certificate on a site expires, as reported by GetSSLCertStatus().
+// Auto-renewing certificates are renewed before then. An error is returned if
+// the site doesn't have a certificate yet.
+//
+// See: https://stackpath.dev/reference/ssl-1#getsitecertificates
+func (c *Client) CertificateDaysUntilExpiry(ctx context.Context, stack *Stack, site *Site) (int, error) {
+	cert, err := c.GetSSLCertStatus(ctx, stack, site)
+	if err != nil {
+		return 0, err
+	}
+
+	if cert == nil || cert.ExpirationDate.IsZero() {
+		return 0, fmt.Errorf("site %s has no SSL certificate yet", site.ID)
+	}
+
+	return int(time.Until(cert.ExpirationDate).Hours() / 24), nil
+}
@@ -0,0 +1,246 @@
+package stackpath_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"stackpath-demonstration-app/pkg/stackpath"
+	"stackpath-demonstration-app/pkg/stackpath/stackpathtest"
+	"testing"
+	"time"
+)
+
+// The API paths of the default fixtures' site.
+const (
+	sitesPath    = "/delivery/v1/stacks/" + stackpathtest.StackSlug + "/sites"
+	sitePath     = sitesPath + "/" + stackpathtest.SiteID
+	cdnSitesPath = "/cdn/v1/stacks/" + stackpathtest.StackSlug + "/sites/" + stackpathtest.SiteID
+)
+
+func TestDeliveryRequests(t *testing.T) {
+	since := time.Date(2021, 3, 2, 15, 0, 0, 0, time.UTC)
+	until := since.Add(time.Hour)
+
+	runRequestTests(t, []requestTest{
+		{
+			name: "CreateSiteDelivery",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.CreateSiteDelivery(ctx, testStack, stackpathtest.AnycastIP, "demo.example.com", stackpath.OriginTimeouts{
+					Connect: 5 * time.Second,
+					Read:    30 * time.Second,
+				})
+				return err
+			},
+			want: wantRequest{
+				method: http.MethodPost,
+				path:   sitesPath,
+				body: `{
+  "domain": "demo.example.com",
+  "origin": {"path": "/", "hostname": "` + stackpathtest.AnycastIP + `", "port": 80},
+  "features": ["CDN", "WAF"],
+  "configuration": {
+    "originPullProtocol": {"protocol": "http"},
+    "originTimeouts": {"connectTimeout": 5, "readTimeout": 30}
+  }
+}`,
+			},
+		},
+		{
+			name: "FindSiteByDomain",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.FindSiteByDomain(ctx, testStack, "demo.example.com")
+				return err
+			},
+			want: wantRequest{
+				method: http.MethodGet,
+				path:   sitesPath,
+				query:  url.Values{"page_request.filter": {`label="demo.example.com"`}},
+			},
+		},
+		{
+			name: "ListSites",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.ListSites(ctx, testStack)
+				return err
+			},
+			want: wantRequest{method: http.MethodGet, path: sitesPath},
+		},
+		{
+			name: "FindSiteDeliveryDomain",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.FindSiteDeliveryDomain(ctx, testStack, testSite)
+				return err
+			},
+			want: wantRequest{method: http.MethodGet, path: sitePath + "/delivery_domains"},
+		},
+		{
+			name: "DeleteSite",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				return client.DeleteSite(ctx, testStack, testSite)
+			},
+			want: wantRequest{method: http.MethodDelete, path: sitePath},
+		},
+		{
+			name: "PurgeCache",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.PurgeCache(ctx, testStack, testSite, []string{"/images/logo.png"})
+				return err
+			},
+			want: wantRequest{
+				method: http.MethodPost,
+				path:   "/cdn/v1/stacks/" + stackpathtest.StackSlug + "/purge",
+				body:   `{"items": [{"url": "https://demo.example.com/images/logo.png", "recursive": false}]}`,
+			},
+		},
+		{
+			name: "PurgeCache everything",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.PurgeCache(ctx, testStack, testSite, nil)
+				return err
+			},
+			want: wantRequest{
+				method: http.MethodPost,
+				path:   "/cdn/v1/stacks/" + stackpathtest.StackSlug + "/purge",
+				body:   `{"items": [{"url": "https://demo.example.com/", "recursive": true}]}`,
+			},
+		},
+		{
+			name: "RequestFreeSSLCert",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				return client.RequestFreeSSLCert(ctx, testStack, testSite)
+			},
+			want: wantRequest{
+				method: http.MethodPost,
+				path:   cdnSitesPath + "/certificates/request",
+				body:   `{"verificationMethod": "DNS"}`,
+			},
+		},
+		{
+			name: "ListCertificates",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.ListCertificates(ctx, testStack)
+				return err
+			},
+			want: wantRequest{method: http.MethodGet, path: "/cdn/v1/stacks/" + stackpathtest.StackSlug + "/certificates"},
+		},
+		{
+			name: "EnsureSSLCert",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.EnsureSSLCert(ctx, testStack, testSite, "demo.example.com")
+				return err
+			},
+			want: wantRequest{method: http.MethodGet, path: cdnSitesPath + "/certificates"},
+		},
+		{
+			name: "EnsureSSLCert requests a certificate for another hostname",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.EnsureSSLCert(ctx, testStack, testSite, "other.example.com")
+				return err
+			},
+			want: wantRequest{method: http.MethodPost, path: cdnSitesPath + "/certificates/request"},
+		},
+		{
+			name: "GetOriginStatusDistribution",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.GetOriginStatusDistribution(ctx, testStack, testSite, since)
+				return err
+			},
+			want: wantRequest{
+				method: http.MethodGet,
+				path:   "/cdn/v1/stacks/" + stackpathtest.StackSlug + "/metrics",
+				query:  url.Values{"sites": {stackpathtest.SiteID}, "start_date": {"2021-03-02T15:00:00Z"}, "granularity": nil},
+			},
+		},
+		{
+			name: "GetSiteAnalytics",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.GetSiteAnalytics(ctx, testStack, testSite, since, until, stackpath.SiteMetricGranularityHour)
+				return err
+			},
+			want: wantRequest{
+				method: http.MethodGet,
+				path:   "/cdn/v1/stacks/" + stackpathtest.StackSlug + "/metrics",
+				query: url.Values{
+					"sites":       {stackpathtest.SiteID},
+					"start_date":  {"2021-03-02T15:00:00Z"},
+					"end_date":    {"2021-03-02T16:00:00Z"},
+					"granularity": {stackpath.SiteMetricGranularityHour},
+				},
+			},
+		},
+		{
+			name: "GetSSLCertStatus",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.GetSSLCertStatus(ctx, testStack, testSite)
+				return err
+			},
+			want: wantRequest{method: http.MethodGet, path: cdnSitesPath + "/certificates"},
+		},
+		{
+			name: "CertificateDaysUntilExpiry",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.CertificateDaysUntilExpiry(ctx, testStack, testSite)
+				return err
+			},
+			want: wantRequest{method: http.MethodGet, path: cdnSitesPath + "/certificates"},
+		},
+	})
+}
+
+func TestEnsureSSLCertReusesIssuedCertificate(t *testing.T) {
+	server, client := newTestClient(t)
+
+	reused, err := client.EnsureSSLCert(context.Background(), testStack, testSite, "demo.example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reused {
+		t.Error("expected the issued certificate to be reused")
+	}
+	if requests := server.RequestsTo(http.MethodPost, cdnSitesPath+"/certificates/request"); len(requests) != 0 {
+		t.Errorf("expected no certificate request, got %d", len(requests))
+	}
+}
+
+func TestCreateSiteDeliveryRejectsInvalidTimeouts(t *testing.T) {
+	tests := []struct {
+		name     string
+		timeouts stackpath.OriginTimeouts
+	}{
+		{name: "negative", timeouts: stackpath.OriginTimeouts{Connect: -time.Second}},
+		{name: "sub-second", timeouts: stackpath.OriginTimeouts{Read: 500 * time.Millisecond}},
+		{name: "fractional seconds", timeouts: stackpath.OriginTimeouts{Connect: 1500 * time.Millisecond}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, client := newTestClient(t)
+
+			_, err := client.CreateSiteDelivery(context.Background(), testStack, stackpathtest.AnycastIP, "demo.example.com", test.timeouts)
+			if err == nil {
+				t.Fatal("expected an error for invalid origin timeouts")
+			}
+			if len(server.RequestsTo(http.MethodPost, sitesPath)) != 0 {
+				t.Error("expected no site to be created")
+			}
+		})
+	}
+}
+
+func TestGetSiteAnalyticsSendsUTCTimes(t *testing.T) {
+	server, client := newTestClient(t)
+
+	// A local time's "+" offset would be decoded as a space.
+	zone := time.FixedZone("CET", 60*60)
+	since := time.Date(2021, 3, 2, 16, 0, 0, 0, zone)
+	_, err := client.GetSiteAnalytics(context.Background(), testStack, testSite, since, since.Add(time.Hour), stackpath.SiteMetricGranularityHour)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	assertRequest(t, server, wantRequest{
+		method: http.MethodGet,
+		path:   "/cdn/v1/stacks/" + stackpathtest.StackSlug + "/metrics",
+		query:  url.Values{"start_date": {"2021-03-02T15:00:00Z"}, "end_date": {"2021-03-02T16:00:00Z"}},
+	})
+}
@@ -0,0 +1,289 @@
+package stackpath
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The steps Deploy() runs, in order. They're passed to DeployOptions'
+// OnStepStart and OnStepDone callbacks.
+const (
+	DeployStepWorkload        = "workload"
+	DeployStepSite            = "site"
+	DeployStepWaitForWorkload = "wait-for-workload"
+	DeployStepDeliveryDomain  = "delivery-domain"
+	DeployStepDNSRecord       = "dns-record"
+	DeployStepSSLCert         = "ssl-cert"
+	DeployStepWAFMode         = "waf-mode"
+	DeployStepWAFRules        = "waf-rules"
+)
+
+// workloadPollInterval and sslCertPollInterval are how often Deploy() checks
+// on the workload's instances and on a requested SSL certificate.
+const (
+	workloadPollInterval = time.Second
+	sslCertPollInterval  = 5 * time.Second
+)
+
+// DeployOptions configures Deploy(). Workload is the spec of the compute
+// workload to create. It's named after the deployment's WorkloadName rather
+// than the spec's Name. OriginTimeouts and DNSRecordTTL are passed on to the
+// site and the project's CNAME record. Deploy() gives up on an SSL certificate
+// that isn't issued within SSLCertTimeout, or waits until ctx is cancelled if
+// it's zero.
+type DeployOptions struct {
+	Workload       WorkloadSpec
+	OriginTimeouts OriginTimeouts
+	DNSRecordTTL   int
+	SSLCertTimeout time.Duration
+
+	// OnStepStart and OnStepDone, if set, are called as each DeployStep* step
+	// starts and once it's done. OnStepDone is passed a short summary of what
+	// the step did, e.g. `reused existing site "..."`, or an empty string if
+	// there's nothing more to say.
+	OnStepStart func(step string)
+	OnStepDone  func(step, summary string)
+
+	// OnInstancePhase, if set, is called while waiting for the workload each
+	// time one of its instances shows up or changes phase.
+	OnInstancePhase func(instance Instance)
+}
+
+// deployStep is one step of Deploy(). It provisions a part of the deployment,
+// populates it on d, and returns a summary for DeployOptions.OnStepDone.
+type deployStep struct {
+	name string
+	run  func(ctx context.Context, d *Deployment, opts DeployOptions) (string, error)
+}
+
+// Deploy provisions the demo project on the deployment's stack and DNS zone:
+// a compute workload, a CDN and WAF site in front of it, a CNAME record
+// pointing the project's hostname at the site, an SSL certificate, and the demo
+// WAF rules. A site or certificate left over for the project's hostname from a
+// previous run is reused. The deployment is populated as each step completes.
+// Deploy checks ctx between and within steps. If ctx is cancelled it stops at
+// the current step and returns the partially populated deployment with ctx's
+// error, so the caller can decide whether to tear down what was provisioned.
+// The deployment is returned the same way when a step fails.
+func (c *Client) Deploy(ctx context.Context, d *Deployment, opts DeployOptions) (*Deployment, error) {
+	if d.Stack == nil || d.Domain == nil {
+		return d, errors.New("the deployment has no stack or DNS zone to deploy to")
+	}
+
+	steps := []deployStep{
+		{DeployStepWorkload, c.deployWorkload},
+		{DeployStepSite, c.deploySite},
+		{DeployStepWaitForWorkload, c.waitForWorkload},
+		{DeployStepDeliveryDomain, c.deployDeliveryDomain},
+		{DeployStepDNSRecord, c.deployDNSRecord},
+		{DeployStepSSLCert, c.deploySSLCert},
+		{DeployStepWAFMode, c.deployWAFMode},
+		{DeployStepWAFRules, c.deployWAFRules},
+	}
+
+	for _, step := range steps {
+		if ctx.Err() != nil {
+			return d, ctx.Err()
+		}
+
+		if opts.OnStepStart != nil {
+			opts.OnStepStart(step.name)
+		}
+
+		summary, err := step.run(ctx, d, opts)
+		if ctx.Err() != nil {
+			return d, ctx.Err()
+		}
+		if err != nil {
+			return d, err
+		}
+
+		if opts.OnStepDone != nil {
+			opts.OnStepDone(step.name, summary)
+		}
+	}
+
+	return d, nil
+}
+
+// deployWorkload creates the deployment's compute workload.
+func (c *Client) deployWorkload(ctx context.Context, d *Deployment, opts DeployOptions) (string, error) {
+	spec := opts.Workload
+	if d.WorkloadName != "" {
+		spec.Name = d.WorkloadName
+	}
+
+	workload, err := c.CreateWorkload(ctx, d.Stack, spec)
+	if err != nil {
+		return "", fmt.Errorf("creating the compute workload: %w", err)
+	}
+
+	d.Workload = workload
+	d.Targets = spec.Targets
+
+	return fmt.Sprintf("workload \"%s\" created, anycast IP: %s", workload.Name, workload.AnycastIP), nil
+}
+
+// deploySite creates a CDN and WAF site using the workload's anycast IP as the
+// origin, or reuses a site left over for the project's hostname.
+func (c *Client) deploySite(ctx context.Context, d *Deployment, opts DeployOptions) (string, error) {
+	sites, err := c.ListSites(ctx, d.Stack)
+	if err != nil {
+		return "", fmt.Errorf("listing CDN sites: %w", err)
+	}
+	for i := range sites {
+		if strings.EqualFold(sites[i].Domain, d.Hostname()) {
+			d.Site = &sites[i]
+			return fmt.Sprintf("reused existing site \"%s\"", d.Site.ID), nil
+		}
+	}
+
+	site, err := c.CreateSiteDelivery(ctx, d.Stack, d.Workload.AnycastIP, d.Hostname(), opts.OriginTimeouts)
+	if err != nil {
+		return "", fmt.Errorf("creating the CDN and WAF site: %w", err)
+	}
+
+	d.Site = site
+	return fmt.Sprintf("site \"%s\" created", site.ID), nil
+}
+
+// waitForWorkload polls the workload's instances until it's ready, calling
+// opts.OnInstancePhase as instances show up and change phase.
+func (c *Client) waitForWorkload(ctx context.Context, d *Deployment, opts DeployOptions) (string, error) {
+	// phases maps instance names to the last phase reported for them.
+	phases := make(map[string]string)
+
+	for {
+		status, err := c.GetWorkloadStatus(ctx, d.Stack, d.Workload)
+		if err != nil {
+			return "", fmt.Errorf("querying instance status: %w", err)
+		}
+
+		for _, instance := range status.Instances {
+			if phases[instance.Name] == instance.Phase {
+				continue
+			}
+
+			phases[instance.Name] = instance.Phase
+			if opts.OnInstancePhase != nil {
+				opts.OnInstancePhase(instance)
+			}
+		}
+		if status.Ready {
+			return "", nil
+		}
+
+		select {
+		case <-time.After(workloadPollInterval):
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+}
+
+// deployDeliveryDomain finds the site's delivery domain, the CNAME target for
+// the project's hostname.
+func (c *Client) deployDeliveryDomain(ctx context.Context, d *Deployment, _ DeployOptions) (string, error) {
+	deliveryDomain, err := c.FindSiteDeliveryDomain(ctx, d.Stack, d.Site)
+	if err != nil {
+		return "", fmt.Errorf("locating the site's delivery domain: %w", err)
+	}
+
+	d.DeliveryDomain = deliveryDomain
+	return fmt.Sprintf("found the delivery domain \"%s\"", deliveryDomain), nil
+}
+
+// deployDNSRecord points the project's CNAME record at the site's delivery
+// domain, updating the record left over from a previous run if there is one.
+func (c *Client) deployDNSRecord(ctx context.Context, d *Deployment, opts DeployOptions) (string, error) {
+	err := ValidateCNAMETarget(ctx, d.Domain, d.SubDomain, d.DeliveryDomain)
+	if err != nil {
+		return "", fmt.Errorf("validating the project's CNAME: %w", err)
+	}
+
+	duplicates, err := c.UpsertDNSCNAME(ctx, d.Stack, d.Domain, d.SubDomain, d.DeliveryDomain, opts.DNSRecordTTL)
+	if err != nil {
+		return "", fmt.Errorf("creating the project's CNAME: %w", err)
+	}
+
+	if len(duplicates) > 0 {
+		return fmt.Sprintf("warning: %d more CNAME records for \"%s\" were left untouched", len(duplicates), d.Hostname()), nil
+	}
+
+	return "", nil
+}
+
+// deploySSLCert requests an SSL certificate for the project's hostname, unless
+// one from a prior run already covers it, then waits for a requested
+// certificate to be issued.
+func (c *Client) deploySSLCert(ctx context.Context, d *Deployment, opts DeployOptions) (string, error) {
+	reused, err := c.EnsureSSLCert(ctx, d.Stack, d.Site, d.Hostname())
+	if err != nil {
+		return "", fmt.Errorf("requesting an SSL certificate: %w", err)
+	}
+	if reused {
+		return "reused an existing certificate", nil
+	}
+
+	// Poll until the certificate is verified over DNS and issued.
+	var deadline time.Time
+	if opts.SSLCertTimeout > 0 {
+		deadline = time.Now().Add(opts.SSLCertTimeout)
+	}
+	for {
+		cert, err := c.GetSSLCertStatus(ctx, d.Stack, d.Site)
+		if err != nil {
+			return "", fmt.Errorf("checking the SSL certificate status: %w", err)
+		}
+
+		if cert != nil && cert.Status == SSLCertStatusIssued {
+			return "", nil
+		}
+		if cert != nil && cert.Status == SSLCertStatusError {
+			return "", errors.New("the SSL certificate could not be issued")
+		}
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return "", fmt.Errorf("the SSL certificate wasn't issued within %s", opts.SSLCertTimeout)
+		}
+
+		select {
+		case <-time.After(sslCertPollInterval):
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+}
+
+// deployWAFMode switches the site's WAF out of monitoring mode so the demo
+// block rule actually blocks requests.
+func (c *Client) deployWAFMode(ctx context.Context, d *Deployment, _ DeployOptions) (string, error) {
+	mode, err := c.GetWAFMode(ctx, d.Stack, d.Site)
+	if err != nil {
+		return "", fmt.Errorf("checking the WAF mode: %w", err)
+	}
+	if mode == WAFModeBlocking {
+		return "", nil
+	}
+
+	err = c.SetWAFMode(ctx, d.Stack, d.Site, WAFModeBlocking)
+	if err != nil {
+		return "", fmt.Errorf("switching the WAF to blocking mode: %w", err)
+	}
+
+	return "switched from monitoring to blocking", nil
+}
+
+// deployWAFRules creates the demo block and allow rules on the site.
+func (c *Client) deployWAFRules(ctx context.Context, d *Deployment, _ DeployOptions) (string, error) {
+	// The rules created before a failure are kept on the deployment.
+	var err error
+	d.WAFRuleIDs, err = c.CreateDemoWAFRules(ctx, d.Stack, d.Site)
+	if err != nil {
+		return "", fmt.Errorf("creating the demo WAF rules: %w", err)
+	}
+
+	return "", nil
+}
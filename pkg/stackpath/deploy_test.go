@@ -0,0 +1,169 @@
+package stackpath_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"stackpath-demonstration-app/pkg/stackpath"
+	"stackpath-demonstration-app/pkg/stackpath/stackpathtest"
+	"testing"
+)
+
+// newDeployment returns a deployment of the "demo" project that's ready for
+// Deploy(), with names resolving to themselves so its CNAME passes
+// validation.
+func newDeployment(t *testing.T) *stackpath.Deployment {
+	t.Helper()
+
+	stackpath.StubLookupCNAME(t, func(ctx context.Context, host string) (string, error) {
+		return host + ".", nil
+	})
+
+	d := stackpath.NewDeployment("demo")
+	d.Stack = testStack
+	d.Domain = testDomain
+
+	return d
+}
+
+// deploySpec returns the demo's workload spec deployed to DFW only, so a
+// workload with the default fixtures' single instance is ready.
+func deploySpec() stackpath.WorkloadSpec {
+	spec := stackpath.DefaultWorkloadSpec()
+	spec.Targets = stackpath.CityTargets([]string{"DFW"})
+
+	return spec
+}
+
+func TestDeploy(t *testing.T) {
+	server, client := newTestClient(t)
+
+	var steps []string
+	d, err := client.Deploy(context.Background(), newDeployment(t), stackpath.DeployOptions{
+		Workload:    deploySpec(),
+		OnStepStart: func(step string) { steps = append(steps, step) },
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := []string{
+		stackpath.DeployStepWorkload,
+		stackpath.DeployStepSite,
+		stackpath.DeployStepWaitForWorkload,
+		stackpath.DeployStepDeliveryDomain,
+		stackpath.DeployStepDNSRecord,
+		stackpath.DeployStepSSLCert,
+		stackpath.DeployStepWAFMode,
+		stackpath.DeployStepWAFRules,
+	}
+	if !reflect.DeepEqual(steps, want) {
+		t.Errorf("expected steps %v, got %v", want, steps)
+	}
+
+	if d.Workload == nil || d.Workload.ID != stackpathtest.WorkloadID {
+		t.Errorf("expected the created workload, got %+v", d.Workload)
+	}
+	if d.Site == nil || d.Site.ID != stackpathtest.SiteID {
+		t.Errorf("expected the existing site to be reused, got %+v", d.Site)
+	}
+	if d.DeliveryDomain != "a1b2c3d4.stackpathcdn.com" || len(d.WAFRuleIDs) != 2 {
+		t.Errorf("unexpected deployment %+v", d)
+	}
+
+	assertRequest(t, server, wantRequest{method: http.MethodPost, path: workloadsPath})
+	assertRequest(t, server, wantRequest{
+		method: http.MethodPut,
+		path:   recordsPath + "/" + stackpathtest.RecordID,
+		body:   `{"type": "CNAME", "name": "demo", "data": "a1b2c3d4.stackpathcdn.com"}`,
+	})
+	if requests := server.RequestsTo(http.MethodPost, sitesPath); len(requests) != 0 {
+		t.Errorf("expected no site to be created, got %d", len(requests))
+	}
+}
+
+func TestDeployStopsBetweenSteps(t *testing.T) {
+	server, client := newTestClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d, err := client.Deploy(ctx, newDeployment(t), stackpath.DeployOptions{
+		Workload: deploySpec(),
+		OnStepDone: func(step, summary string) {
+			if step == stackpath.DeployStepSite {
+				cancel()
+			}
+		},
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	// The partial deployment is returned for the caller to tear down.
+	if d.Workload == nil || d.Site == nil {
+		t.Errorf("expected the workload and site provisioned so far, got %+v", d)
+	}
+	if requests := server.RequestsTo(http.MethodGet, workloadSlugPath+"/instances"); len(requests) != 0 {
+		t.Errorf("expected no more steps to run, got %d instance requests", len(requests))
+	}
+}
+
+func TestDeployStopsWithinSteps(t *testing.T) {
+	server, client := newTestClient(t)
+	server.HandleJSON(http.MethodGet, workloadSlugPath+"/instances", http.StatusOK, `{
+  "pageInfo": {"hasNextPage": false},
+  "results": [{"name": "`+stackpathtest.InstanceName+`", "phase": "STARTING"}]
+}`)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The workload never becomes ready, so Deploy() waits until it's
+	// cancelled.
+	d, err := client.Deploy(ctx, newDeployment(t), stackpath.DeployOptions{
+		Workload:        deploySpec(),
+		OnInstancePhase: func(instance stackpath.Instance) { cancel() },
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if d.Workload == nil || d.Site == nil || d.DeliveryDomain != "" {
+		t.Errorf("expected the deployment to stop while waiting for the workload, got %+v", d)
+	}
+}
+
+func TestDeployTwoProjectsOnOneStack(t *testing.T) {
+	server, client := newTestClient(t)
+
+	demo := newDeployment(t)
+	staging := stackpath.NewDeployment("staging")
+	staging.Stack = testStack
+	staging.Domain = testDomain
+
+	for _, d := range []*stackpath.Deployment{demo, staging} {
+		_, err := client.Deploy(context.Background(), d, stackpath.DeployOptions{Workload: deploySpec()})
+		if err != nil {
+			t.Fatalf("unexpected error deploying %s: %s", d.SubDomain, err)
+		}
+	}
+
+	// Each project's workload is named after it, so they can be told apart.
+	if demo.WorkloadName == staging.WorkloadName {
+		t.Fatalf("expected distinct workload names, got %q twice", demo.WorkloadName)
+	}
+
+	requests := server.RequestsTo(http.MethodPost, workloadsPath)
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 workloads to be created, got %d", len(requests))
+	}
+	for i, d := range []*stackpath.Deployment{demo, staging} {
+		want := decodeJSON(t, []byte(`{"workload": {"name": "`+d.WorkloadName+`"}}`))
+		if got := decodeJSON(t, requests[i].Body); !containsJSON(got, want) {
+			t.Errorf("expected workload %q to be created, got %s", d.WorkloadName, requests[i].Body)
+		}
+	}
+
+	// The staging project gets its own site and CNAME.
+	assertRequest(t, server, wantRequest{method: http.MethodPost, path: sitesPath, body: `{"domain": "staging.` + stackpathtest.DomainName + `"}`})
+	assertRequest(t, server, wantRequest{method: http.MethodPost, path: recordsPath, body: `{"name": "staging"}`})
+}
@@ -0,0 +1,197 @@
+package stackpath
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// Deployment models everything provisioned for a single demo project: the
+// stack and DNS zone it lives in, its Edge Compute workload, the CDN and WAF
+// site in front of the workload with its custom WAF rules, and the DNS record
+// pointing at the site.
+// Deployments are built up as each provisioning step completes, so more than
+// one project can be deployed side by side on the same stack. WorkloadName is
+// the name of the project's workload, which tells it apart from other
+// projects' workloads on the stack.
+type Deployment struct {
+	Stack          *Stack
+	Domain         *Domain
+	SubDomain      string
+	WorkloadName   string
+	Targets        []Target
+	Workload       *Workload
+	Site           *Site
+	WAFRuleIDs     []string
+	DeliveryDomain string
+}
+
+// NewDeployment starts a deployment for a project served from a sub-domain of
+// the deployment's DNS zone. The project's workload is named after the
+// sub-domain.
+func NewDeployment(subDomain string) *Deployment {
+	return &Deployment{
+		SubDomain:    subDomain,
+		WorkloadName: workloadName + " for " + subDomain,
+	}
+}
+
+// Hostname returns the project's fully-qualified domain name.
+func (d *Deployment) Hostname() string {
+	return d.SubDomain + "." + d.Domain.Name
+}
+
+// FindDeployment discovers an existing project deployment by name without any
+// saved state: the stack by slug, the DNS zone by domain name, the workload by
+// the name NewDeployment() gives it, and the site by the project's hostname.
+// Only lookups are made. Resources that weren't found are left nil on the
+// returned deployment. The workload and site are looked up even if the DNS zone
+// wasn't found, so a deployment whose zone was deleted can still be found. If
+// more than one workload or site matches the project an *AmbiguousMatchError
+// is returned, and the caller shouldn't act on the deployment.
+func (c *Client) FindDeployment(ctx context.Context, stackSlug, domainName, subDomain string) (*Deployment, error) {
+	var err error
+	d := NewDeployment(subDomain)
+
+	d.Stack, err = c.FindStackBySlug(ctx, stackSlug)
+	if err != nil || d.Stack == nil {
+		return d, err
+	}
+
+	d.Domain, err = c.FindDomainByName(ctx, d.Stack, domainName)
+	if err != nil {
+		return d, err
+	}
+
+	d.Workload, err = c.FindWorkloadByName(ctx, d.Stack, d.WorkloadName)
+	if err != nil {
+		return d, err
+	}
+	if d.Workload != nil {
+		d.Targets = d.Workload.Targets
+	}
+
+	// d.Hostname() needs the DNS zone, which may not have been found.
+	d.Site, err = c.FindSiteByDomain(ctx, d.Stack, subDomain+"."+domainName)
+	if err != nil || d.Site == nil {
+		return d, err
+	}
+
+	d.DeliveryDomain, err = c.FindSiteDeliveryDomain(ctx, d.Stack, d.Site)
+	return d, err
+}
+
+// Cutover switches a project from the deployment from to the deployment to,
+// e.g. from a "blue" workload and site to a "green" one, by pointing from's DNS
+// CNAME at to's delivery domain. Traffic moves over as resolvers pick up the
+// change, so from keeps serving in the meantime.
+// If teardownOld is set, Cutover then waits for delay, giving cached DNS
+// answers time to expire, and deletes from's site and workload, setting them
+// to nil on from. The wait stops early if ctx is cancelled, leaving the old
+// deployment in place.
+func (c *Client) Cutover(ctx context.Context, from, to *Deployment, teardownOld bool, delay time.Duration) error {
+	if from.Stack == nil || from.Domain == nil {
+		return errors.New("the old deployment has no DNS zone to update")
+	}
+	if to.DeliveryDomain == "" {
+		return errors.New("the new deployment has no delivery domain to point at")
+	}
+
+	_, err := c.UpsertDNSCNAME(ctx, from.Stack, from.Domain, from.SubDomain, to.DeliveryDomain, 0)
+	if err != nil {
+		return fmt.Errorf("updating the CNAME: %w", err)
+	}
+
+	if !teardownOld {
+		return nil
+	}
+
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if from.Site != nil {
+		err = c.DeleteSite(ctx, from.Stack, from.Site)
+		if err != nil {
+			return fmt.Errorf("deleting the old site: %w", err)
+		}
+		from.Site = nil
+	}
+
+	if from.Workload != nil {
+		err = c.DeleteWorkload(ctx, from.Stack, from.Workload)
+		if err != nil {
+			return fmt.Errorf("deleting the old workload: %w", err)
+		}
+		from.Workload = nil
+	}
+
+	return nil
+}
+
+// SmokeTest checks that a deployment is serving the expected version of the
+// demo. httpbin can't echo its container's environment, so the workload is
+// read back to check its DemoVersionEnv environment variable, then the
+// project's /get endpoint is requested through the CDN to check that httpbin
+// answers for the project's hostname.
+func (c *Client) SmokeTest(ctx context.Context, d *Deployment, demoVersion string) error {
+	if d.Workload == nil || d.Domain == nil {
+		return errors.New("the deployment has no workload or DNS zone to test")
+	}
+
+	workload, err := c.GetWorkload(ctx, d.Stack, d.Workload.ID)
+	if err != nil {
+		return err
+	}
+	if workload == nil {
+		return fmt.Errorf("workload %q not found", d.Workload.Name)
+	}
+	if workload.Env[DemoVersionEnv] != demoVersion {
+		return fmt.Errorf("expected %s %q, got %q", DemoVersionEnv, demoVersion, workload.Env[DemoVersionEnv])
+	}
+
+	// Call the project directly rather than through Do() so the StackPath
+	// bearer token isn't sent to the project.
+	httpClient := http.Client{Timeout: 10 * time.Second}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+d.Hostname()+"/get", nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	err = res.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("expected a 200 from /get, got %d", res.StatusCode)
+	}
+
+	echo := struct {
+		Headers map[string]string `json:"headers"`
+	}{}
+	err = json.Unmarshal(body, &echo)
+	if err != nil {
+		return fmt.Errorf("reading the /get response: %w", err)
+	}
+	if echo.Headers["Host"] != d.Hostname() {
+		return fmt.Errorf("expected /get to echo the host %q, got %q", d.Hostname(), echo.Headers["Host"])
+	}
+
+	return nil
+}
@@ -0,0 +1,151 @@
+package stackpath_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"stackpath-demonstration-app/pkg/stackpath"
+	"stackpath-demonstration-app/pkg/stackpath/stackpathtest"
+	"strings"
+	"testing"
+)
+
+// newTestDeployment returns the deployment described by the default fixtures.
+func newTestDeployment() *stackpath.Deployment {
+	d := stackpath.NewDeployment("demo")
+	d.Stack = testStack
+	d.Domain = testDomain
+	d.Workload = testWorkload
+	d.Site = testSite
+	d.DeliveryDomain = "a1b2c3d4.stackpathcdn.com"
+
+	return d
+}
+
+func TestDeploymentRequests(t *testing.T) {
+	runRequestTests(t, []requestTest{
+		{
+			name: "FindDeployment finds the workload",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.FindDeployment(ctx, stackpathtest.StackSlug, stackpathtest.DomainName, "demo")
+				return err
+			},
+			want: wantRequest{
+				method: http.MethodGet,
+				path:   workloadsPath,
+				query:  url.Values{"page_request.filter": {`name="` + stackpath.NewDeployment("demo").WorkloadName + `"`}},
+			},
+		},
+		{
+			name: "FindDeployment finds the site",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.FindDeployment(ctx, stackpathtest.StackSlug, stackpathtest.DomainName, "demo")
+				return err
+			},
+			want: wantRequest{
+				method: http.MethodGet,
+				path:   sitesPath,
+				query:  url.Values{"page_request.filter": {`label="demo.` + stackpathtest.DomainName + `"`}},
+			},
+		},
+		{
+			name: "FindDeployment without a DNS zone",
+			setup: func(server *stackpathtest.Server) {
+				server.HandleJSON(http.MethodGet, zonesPath, http.StatusOK, `{"pageInfo": {"hasNextPage": false}, "zones": []}`)
+			},
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.FindDeployment(ctx, stackpathtest.StackSlug, stackpathtest.DomainName, "demo")
+				return err
+			},
+			want: wantRequest{method: http.MethodGet, path: sitePath + "/delivery_domains"},
+		},
+		{
+			name: "Cutover",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				green := stackpath.NewDeployment("demo")
+				green.DeliveryDomain = "e5f6a7b8.stackpathcdn.com"
+
+				return client.Cutover(ctx, newTestDeployment(), green, false, 0)
+			},
+			want: wantRequest{
+				method: http.MethodPut,
+				path:   recordsPath + "/" + stackpathtest.RecordID,
+				body:   `{"type": "CNAME", "name": "demo", "data": "e5f6a7b8.stackpathcdn.com"}`,
+			},
+		},
+	})
+}
+
+func TestFindDeploymentRefusesAmbiguousMatches(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		results string
+	}{
+		{
+			name: "two workloads",
+			path: workloadsPath,
+			results: `{"pageInfo": {"hasNextPage": false}, "results": [
+  {"id": "workload-1", "slug": "demo-1", "name": "My compute origin for demo"},
+  {"id": "workload-2", "slug": "demo-2", "name": "My compute origin for demo"}
+]}`,
+		},
+		{
+			name: "two sites",
+			path: sitesPath,
+			results: `{"pageInfo": {"hasNextPage": false}, "results": [
+  {"id": "site-1", "label": "demo.` + stackpathtest.DomainName + `"},
+  {"id": "site-2", "label": "demo.` + stackpathtest.DomainName + `"}
+]}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, client := newTestClient(t)
+			server.HandleJSON(http.MethodGet, test.path, http.StatusOK, test.results)
+
+			_, err := client.FindDeployment(context.Background(), stackpathtest.StackSlug, stackpathtest.DomainName, "demo")
+			var ambiguous *stackpath.AmbiguousMatchError
+			if !errors.As(err, &ambiguous) || !errors.Is(err, stackpath.ErrAmbiguousMatch) || ambiguous.Count != 2 {
+				t.Fatalf("expected an *AmbiguousMatchError for 2 matches, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCutoverTearsDownTheOldDeployment(t *testing.T) {
+	server, client := newTestClient(t)
+
+	blue := newTestDeployment()
+	green := stackpath.NewDeployment("demo")
+	green.DeliveryDomain = "e5f6a7b8.stackpathcdn.com"
+
+	err := client.Cutover(context.Background(), blue, green, true, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	assertRequest(t, server, wantRequest{method: http.MethodPut, path: recordsPath + "/" + stackpathtest.RecordID})
+	assertRequest(t, server, wantRequest{method: http.MethodDelete, path: sitePath})
+	assertRequest(t, server, wantRequest{method: http.MethodDelete, path: workloadIDPath})
+	if blue.Site != nil || blue.Workload != nil {
+		t.Errorf("expected the old site and workload to be cleared, got %+v", blue)
+	}
+}
+
+func TestSmokeTestChecksTheDemoVersion(t *testing.T) {
+	server, client := newTestClient(t)
+	server.HandleJSON(http.MethodGet, workloadIDPath, http.StatusOK, `{"workload": {
+  "id": "`+stackpathtest.WorkloadID+`",
+  "name": "`+stackpathtest.WorkloadName+`",
+  "spec": {"containers": {"my-app": {"env": [{"key": "DEMO_VERSION", "value": "1.2.3"}]}}}
+}}`)
+
+	// The version is checked before the project is requested.
+	err := client.SmokeTest(context.Background(), newTestDeployment(), "2.0.0")
+	if err == nil || !strings.Contains(err.Error(), `expected DEMO_VERSION "2.0.0", got "1.2.3"`) {
+		t.Fatalf("expected a version mismatch, got %v", err)
+	}
+}
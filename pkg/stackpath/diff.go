@@ -0,0 +1,243 @@
+package stackpath
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DesiredDeployment describes a project deployment as it should be: the
+// workload's spec, the site serving the project's hostname, the CNAME pointing
+// the hostname at the site, and the site's custom WAF rules.
+type DesiredDeployment struct {
+	StackSlug  string
+	DomainName string
+	SubDomain  string
+	Workload   WorkloadSpec
+	WAFRules   []WAFRule
+}
+
+// NewDesiredDeployment returns the deployment the demo makes for a project
+// served from a sub-domain: DefaultWorkloadSpec() and the demo's WAF rules.
+func NewDesiredDeployment(stackSlug, domainName, subDomain string) DesiredDeployment {
+	return DesiredDeployment{
+		StackSlug:  stackSlug,
+		DomainName: domainName,
+		SubDomain:  subDomain,
+		Workload:   DefaultWorkloadSpec(),
+		WAFRules:   demoWAFRules(),
+	}
+}
+
+// FieldDiff is a field whose live value differs from its desired value. Live
+// is empty if the resource or field doesn't exist yet, and Desired is empty if
+// it shouldn't exist.
+type FieldDiff struct {
+	Field   string
+	Live    string
+	Desired string
+}
+
+// DeploymentDiff lists the fields that differ between a live deployment and
+// the desired one, by resource.
+type DeploymentDiff struct {
+	Workload []FieldDiff
+	Site     []FieldDiff
+	DNS      []FieldDiff
+	WAF      []FieldDiff
+}
+
+// Empty determines if the live deployment matches the desired one.
+func (d *DeploymentDiff) Empty() bool {
+	return len(d.Workload) == 0 && len(d.Site) == 0 && len(d.DNS) == 0 && len(d.WAF) == 0
+}
+
+// DiffDeployment compares the live deployment of a project, found with
+// FindDeployment(), with the desired one. It only makes lookups, so the diff
+// can be reviewed before deploying.
+// Workload targets are compared by name. The workload's container settings
+// aren't compared because the API doesn't return them. The CNAME is expected
+// to point at the site's delivery domain, and WAF rules are compared by name.
+func (c *Client) DiffDeployment(ctx context.Context, desired DesiredDeployment) (*DeploymentDiff, error) {
+	live, err := c.FindDeployment(ctx, desired.StackSlug, desired.DomainName, desired.SubDomain)
+	if err != nil {
+		return nil, err
+	}
+	if live.Stack == nil {
+		return nil, fmt.Errorf("stack %q not found", desired.StackSlug)
+	}
+
+	diff := &DeploymentDiff{}
+
+	if live.Workload == nil {
+		diff.Workload = append(diff.Workload, FieldDiff{Field: "workload", Desired: desired.Workload.Name})
+	} else {
+		diff.Workload = diffTargets(live.Workload.Targets, desired.Workload.Targets)
+	}
+
+	hostname := desired.SubDomain + "." + desired.DomainName
+	if live.Site == nil {
+		diff.Site = append(diff.Site, FieldDiff{Field: "site", Desired: hostname})
+	}
+
+	diff.DNS, err = c.diffDNS(ctx, live, desired)
+	if err != nil {
+		return nil, err
+	}
+
+	diff.WAF, err = c.diffWAFRules(ctx, live, desired.WAFRules)
+	if err != nil {
+		return nil, err
+	}
+
+	return diff, nil
+}
+
+// diffTargets compares a live workload's targets with the desired targets by
+// name.
+func diffTargets(live, desired []Target) []FieldDiff {
+	liveTargets := make(map[string]Target, len(live))
+	for _, target := range live {
+		liveTargets[target.Name] = target
+	}
+
+	var diffs []FieldDiff
+	for _, want := range desired {
+		got, found := liveTargets[want.Name]
+		delete(liveTargets, want.Name)
+		if !found {
+			diffs = append(diffs, FieldDiff{Field: "targets." + want.Name, Desired: describeTarget(want)})
+			continue
+		}
+
+		fields := []struct {
+			name          string
+			live, desired string
+		}{
+			{"deploymentScope", deploymentScope(got), deploymentScope(want)},
+			{"cityCodes", strings.Join(got.CityCodes, ","), strings.Join(want.CityCodes, ",")},
+			{"minReplicas", strconv.Itoa(got.MinReplicas), strconv.Itoa(want.MinReplicas)},
+			{"maxReplicas", strconv.Itoa(got.MaxReplicas), strconv.Itoa(want.MaxReplicas)},
+			{"scaleMetric", got.ScaleMetric, want.ScaleMetric},
+			{"scaleThreshold", strconv.Itoa(got.ScaleThreshold), strconv.Itoa(want.ScaleThreshold)},
+			{"cpu", got.CPU, want.CPU},
+			{"memory", got.Memory, want.Memory},
+		}
+		for _, field := range fields {
+			if field.live != field.desired {
+				diffs = append(diffs, FieldDiff{
+					Field:   "targets." + want.Name + "." + field.name,
+					Live:    field.live,
+					Desired: field.desired,
+				})
+			}
+		}
+	}
+
+	// Whatever's left is only on the live workload.
+	var extra []string
+	for name := range liveTargets {
+		extra = append(extra, name)
+	}
+	sort.Strings(extra)
+	for _, name := range extra {
+		diffs = append(diffs, FieldDiff{Field: "targets." + name, Live: describeTarget(liveTargets[name])})
+	}
+
+	return diffs
+}
+
+// deploymentScope returns a target's deployment scope, which defaults to
+// "cityCode".
+func deploymentScope(target Target) string {
+	if target.DeploymentScope == "" {
+		return "cityCode"
+	}
+
+	return target.DeploymentScope
+}
+
+// describeTarget summarizes a target's cities and replicas, like
+// "DFW,FRA (1-2 replicas)".
+func describeTarget(target Target) string {
+	return fmt.Sprintf("%s (%d-%d replicas)", strings.Join(target.CityCodes, ","), target.MinReplicas, target.MaxReplicas)
+}
+
+// diffDNS compares the project's live CNAME with one pointing at the site's
+// delivery domain. If there's no site yet the desired target is a placeholder
+// for the delivery domain the new site will get.
+func (c *Client) diffDNS(ctx context.Context, live *Deployment, desired DesiredDeployment) ([]FieldDiff, error) {
+	if live.Domain == nil {
+		return []FieldDiff{{Field: "zone", Desired: desired.DomainName}}, nil
+	}
+
+	target := live.DeliveryDomain
+	if target == "" {
+		target = "(the site's delivery domain)"
+	}
+
+	records, err := c.ListDNSRecords(ctx, live.Stack, live.Domain)
+	if err != nil {
+		return nil, err
+	}
+
+	field := "records." + desired.SubDomain + ".CNAME"
+	for _, record := range records {
+		if record.Type != DNSRecordTypeCNAME || !strings.EqualFold(record.Name, desired.SubDomain) {
+			continue
+		}
+
+		data := strings.TrimSuffix(record.Data, ".")
+		if data == target {
+			return nil, nil
+		}
+
+		return []FieldDiff{{Field: field, Live: data, Desired: target}}, nil
+	}
+
+	return []FieldDiff{{Field: field, Desired: target}}, nil
+}
+
+// diffWAFRules compares the live site's WAF rules with the desired ones by
+// name. Rules that aren't desired are left out, since sites can have rules the
+// demo didn't make.
+func (c *Client) diffWAFRules(ctx context.Context, live *Deployment, desired []WAFRule) ([]FieldDiff, error) {
+	var rules []WAFRule
+	if live.Site != nil {
+		var err error
+		rules, err = c.ListWAFRules(ctx, live.Stack, live.Site)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	liveRules := make(map[string]WAFRule, len(rules))
+	for _, rule := range rules {
+		liveRules[rule.Name] = rule
+	}
+
+	var diffs []FieldDiff
+	for _, want := range desired {
+		field := "rules." + want.Name
+		got, found := liveRules[want.Name]
+		if !found {
+			diffs = append(diffs, FieldDiff{Field: field, Desired: want.Action})
+			continue
+		}
+
+		if got.Action != want.Action {
+			diffs = append(diffs, FieldDiff{Field: field + ".action", Live: got.Action, Desired: want.Action})
+		}
+		if got.Enabled != want.Enabled {
+			diffs = append(diffs, FieldDiff{
+				Field:   field + ".enabled",
+				Live:    strconv.FormatBool(got.Enabled),
+				Desired: strconv.FormatBool(want.Enabled),
+			})
+		}
+	}
+
+	return diffs, nil
+}
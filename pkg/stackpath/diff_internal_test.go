@@ -0,0 +1,49 @@
+package stackpath
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffTargets(t *testing.T) {
+	desired := []Target{
+		{Name: "north-america", CityCodes: []string{"DFW"}, MinReplicas: 1, MaxReplicas: 2, ScaleMetric: ScaleMetricCPU, ScaleThreshold: 50},
+		{Name: "europe", CityCodes: []string{"FRA", "AMS"}, MinReplicas: 1, MaxReplicas: 2, ScaleMetric: ScaleMetricCPU, ScaleThreshold: 50},
+	}
+
+	tests := []struct {
+		name string
+		live []Target
+		want []FieldDiff
+	}{
+		{
+			name: "matching",
+			live: []Target{
+				{Name: "europe", DeploymentScope: "cityCode", CityCodes: []string{"FRA", "AMS"}, MinReplicas: 1, MaxReplicas: 2, ScaleMetric: ScaleMetricCPU, ScaleThreshold: 50},
+				{Name: "north-america", DeploymentScope: "cityCode", CityCodes: []string{"DFW"}, MinReplicas: 1, MaxReplicas: 2, ScaleMetric: ScaleMetricCPU, ScaleThreshold: 50},
+			},
+		},
+		{
+			name: "changed, missing, and extra targets",
+			live: []Target{
+				{Name: "north-america", CityCodes: []string{"LAX"}, MinReplicas: 1, MaxReplicas: 4, ScaleMetric: ScaleMetricCPU, ScaleThreshold: 50},
+				{Name: "asia", CityCodes: []string{"NRT"}, MinReplicas: 1, MaxReplicas: 2, ScaleMetric: ScaleMetricCPU, ScaleThreshold: 50},
+			},
+			want: []FieldDiff{
+				{Field: "targets.north-america.cityCodes", Live: "LAX", Desired: "DFW"},
+				{Field: "targets.north-america.maxReplicas", Live: "4", Desired: "2"},
+				{Field: "targets.europe", Desired: "FRA,AMS (1-2 replicas)"},
+				{Field: "targets.asia", Live: "NRT (1-2 replicas)"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := diffTargets(test.live, desired)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("expected %+v, got %+v", test.want, got)
+			}
+		})
+	}
+}
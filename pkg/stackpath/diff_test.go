@@ -0,0 +1,74 @@
+package stackpath_test
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"stackpath-demonstration-app/pkg/stackpath"
+	"stackpath-demonstration-app/pkg/stackpath/stackpathtest"
+	"testing"
+)
+
+func TestDiffDeployment(t *testing.T) {
+	server, client := newTestClient(t)
+
+	// The live site only has one of the demo's rules, and it's disabled.
+	server.HandleJSON(http.MethodGet, wafSitePath+"/rules", http.StatusOK, `{
+  "pageInfo": {"hasNextPage": false},
+  "rules": [{"id": "`+stackpathtest.WAFRuleID+`", "name": "block access to blockme", "action": "BLOCK", "enabled": false}]
+}`)
+	server.HandleJSON(http.MethodGet, recordsPath, http.StatusOK, `{
+  "pageInfo": {"hasNextPage": false},
+  "records": [{"id": "`+stackpathtest.RecordID+`", "type": "CNAME", "name": "demo", "data": "old.stackpathcdn.com.", "ttl": 60}]
+}`)
+
+	desired := stackpath.NewDesiredDeployment(stackpathtest.StackSlug, stackpathtest.DomainName, "demo")
+	desired.Workload.Targets = []stackpath.Target{
+		{Name: "north-america", CityCodes: []string{"DFW"}, MinReplicas: 1, MaxReplicas: 2, ScaleMetric: stackpath.ScaleMetricCPU, ScaleThreshold: 50},
+	}
+
+	diff, err := client.DiffDeployment(context.Background(), desired)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := &stackpath.DeploymentDiff{
+		DNS: []stackpath.FieldDiff{
+			{Field: "records.demo.CNAME", Live: "old.stackpathcdn.com", Desired: "a1b2c3d4.stackpathcdn.com"},
+		},
+		WAF: []stackpath.FieldDiff{
+			{Field: "rules.block access to blockme.enabled", Live: "false", Desired: "true"},
+			{Field: "rules.allow access to anything", Desired: stackpath.WAFActionAllow},
+		},
+	}
+	if !reflect.DeepEqual(diff, want) {
+		t.Fatalf("expected %+v, got %+v", want, diff)
+	}
+
+	// Diffing only reads.
+	for _, req := range server.Requests() {
+		if req.Method != http.MethodGet {
+			t.Errorf("unexpected %s %s request", req.Method, req.Path)
+		}
+	}
+}
+
+func TestDiffDeploymentNothingDeployed(t *testing.T) {
+	server, client := newTestClient(t)
+	server.HandleJSON(http.MethodGet, workloadsPath, http.StatusOK, `{"pageInfo": {"hasNextPage": false}, "results": []}`)
+	server.HandleJSON(http.MethodGet, sitesPath, http.StatusOK, `{"pageInfo": {"hasNextPage": false}, "results": []}`)
+	server.HandleJSON(http.MethodGet, recordsPath, http.StatusOK, `{"pageInfo": {"hasNextPage": false}, "records": []}`)
+
+	desired := stackpath.NewDesiredDeployment(stackpathtest.StackSlug, stackpathtest.DomainName, "demo")
+	diff, err := client.DiffDeployment(context.Background(), desired)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(diff.Workload) != 1 || len(diff.Site) != 1 || len(diff.DNS) != 1 || len(diff.WAF) != 2 {
+		t.Fatalf("expected everything to be missing, got %+v", diff)
+	}
+	if diff.DNS[0].Desired != "(the site's delivery domain)" {
+		t.Errorf("expected the CNAME to wait on the new site, got %+v", diff.DNS[0])
+	}
+}
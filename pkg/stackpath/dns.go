@@ -2,11 +2,16 @@ package stackpath
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
+	"strings"
+	"unicode/utf8"
 )
 
 // Domain models a StackPath DNS zone.
@@ -15,15 +20,114 @@ type Domain struct {
 	Name string `json:"domain"`
 }
 
+// The DNS resource record types SetDNSRecord() can create.
+const (
+	DNSRecordTypeA     = "A"
+	DNSRecordTypeAAAA  = "AAAA"
+	DNSRecordTypeCNAME = "CNAME"
+	DNSRecordTypeTXT   = "TXT"
+	DNSRecordTypeMX    = "MX"
+)
+
+// maxTXTStringLength is the longest a single character-string in a TXT
+// record's data can be.
+const maxTXTStringLength = 255
+
+// defaultDNSTTL is the TTL of DNS records created without one.
+const defaultDNSTTL = 60
+
+// DNSRecord models a DNS resource record in a zone. Name is relative to the
+// zone, e.g. "www" for www.example.com. Weight and Priority are optional and
+// omitted when zero, apart from MX records which use Priority as their
+// preference. TXT record Data is the plain, unquoted text. Comment is an
+// optional note about the record, like who created it, to help identify
+// records in a shared zone.
+type DNSRecord struct {
+	ID       string `json:"id,omitempty"`
+	Type     string `json:"type"`
+	Name     string `json:"name"`
+	Data     string `json:"data"`
+	TTL      int    `json:"ttl"`
+	Weight   int    `json:"weight,omitempty"`
+	Priority int    `json:"priority,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// validate checks that the record is a supported type with data that makes
+// sense for it.
+func (rec DNSRecord) validate() error {
+	switch rec.Type {
+	case DNSRecordTypeA:
+		ip := net.ParseIP(rec.Data)
+		if ip == nil || ip.To4() == nil {
+			return fmt.Errorf("A record data %q isn't an IPv4 address", rec.Data)
+		}
+	case DNSRecordTypeAAAA:
+		ip := net.ParseIP(rec.Data)
+		if ip == nil || ip.To4() != nil {
+			return fmt.Errorf("AAAA record data %q isn't an IPv6 address", rec.Data)
+		}
+	case DNSRecordTypeCNAME, DNSRecordTypeTXT:
+		if rec.Data == "" {
+			return fmt.Errorf("%s record data can't be empty", rec.Type)
+		}
+	case DNSRecordTypeMX:
+		if rec.Data == "" {
+			return fmt.Errorf("MX record data can't be empty")
+		}
+		if rec.Priority < 0 || rec.Priority > 65535 {
+			return fmt.Errorf("MX record priority must be between 0 and 65535, got %d", rec.Priority)
+		}
+	default:
+		return fmt.Errorf("unsupported DNS record type %q", rec.Type)
+	}
+
+	if rec.TTL < 0 {
+		return fmt.Errorf("DNS record TTL must be positive, got %d", rec.TTL)
+	}
+
+	return nil
+}
+
+// quoteTXT formats TXT record data as DNS character-strings: quoted, with
+// quotes and backslashes escaped, and split into as many strings as needed to
+// keep each under the 255 byte limit without splitting a UTF-8 character.
+func quoteTXT(data string) string {
+	var quoted []string
+	for len(data) > 0 {
+		n := len(data)
+		if n > maxTXTStringLength {
+			n = maxTXTStringLength
+
+			// Move the split back to the start of a UTF-8 character so
+			// multi-byte characters aren't cut in two. Invalid UTF-8 is split
+			// at the byte limit.
+			for n > 0 && !utf8.RuneStart(data[n]) {
+				n--
+			}
+			if n == 0 {
+				n = maxTXTStringLength
+			}
+		}
+
+		chunk := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(data[:n])
+		quoted = append(quoted, `"`+chunk+`"`)
+		data = data[n:]
+	}
+
+	return strings.Join(quoted, " ")
+}
+
 // FindDomainByName searches for a DNS zone on a stack with the given name. A
 // nil domain result means the domain was not found.
 //
 // See: https://stackpath.dev/reference/zones#getzones
-func (c *Client) FindDomainByName(stack *Stack, domain string) (*Domain, error) {
-	req, err := http.NewRequest(
+func (c *Client) FindDomainByName(ctx context.Context, stack *Stack, domain string) (*Domain, error) {
+	req, err := http.NewRequestWithContext(
+		ctx,
 		http.MethodGet,
 		fmt.Sprintf(
-			baseURL+"/dns/v1/stacks/%s/zones?page_request.filter=%s",
+			c.baseURL+"/dns/v1/stacks/%s/zones?page_request.filter=%s",
 			stack.Slug,
 			url.QueryEscape("domain=\""+domain+"\""),
 		),
@@ -63,21 +167,80 @@ func (c *Client) FindDomainByName(stack *Stack, domain string) (*Domain, error)
 	return &searchRes.Zones[0], nil
 }
 
-// SetDNSCNAME creates a DNS CNAME resource record. The record's TTL is 60s.
+// CreateZone creates a DNS zone for a domain on a stack. The domain's
+// registrar must be pointed at StackPath's nameservers for the zone to serve
+// records.
 //
-// See: https://stackpath.dev/reference/resource-records#createzonerecord
-func (c *Client) SetDNSCNAME(stack *Stack, domain *Domain, record, target string) error {
+// See: https://stackpath.dev/reference/zones#createzone
+func (c *Client) CreateZone(ctx context.Context, stack *Stack, domain string) (*Domain, error) {
 	reqBody := bytes.NewBuffer([]byte(`{
-  "type": "CNAME",
-  "name": "` + record + `",
-  "data": "` + target + `",
-  "ttl": 60
+  "domain": "` + domain + `"
 }`))
-	req, err := http.NewRequest(
+	req, err := http.NewRequestWithContext(
+		ctx,
 		http.MethodPost,
-		fmt.Sprintf(baseURL+"/dns/v1/stacks/%s/zones/%s/records", stack.Slug, domain.ID),
+		fmt.Sprintf(c.baseURL+"/dns/v1/stacks/%s/zones", stack.Slug),
 		reqBody,
 	)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	err = res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	newZone := struct {
+		Zone Domain `json:"zone"`
+	}{}
+	err = json.Unmarshal(body, &newZone)
+	if err != nil {
+		return nil, err
+	}
+
+	return &newZone.Zone, nil
+}
+
+// SetDNSRecord creates a DNS resource record in a zone. A, AAAA, CNAME, TXT,
+// and MX records are supported. Records without a TTL get a 60s TTL. TXT data
+// is quoted and split into 255 byte strings.
+//
+// See: https://stackpath.dev/reference/resource-records#createzonerecord
+func (c *Client) SetDNSRecord(ctx context.Context, stack *Stack, domain *Domain, rec DNSRecord) error {
+	err := rec.validate()
+	if err != nil {
+		return err
+	}
+
+	if rec.TTL == 0 {
+		rec.TTL = defaultDNSTTL
+	}
+	if rec.Type == DNSRecordTypeTXT {
+		rec.Data = quoteTXT(rec.Data)
+	}
+	rec.ID = ""
+
+	reqBody, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		fmt.Sprintf(c.baseURL+"/dns/v1/stacks/%s/zones/%s/records", stack.Slug, domain.ID),
+		bytes.NewBuffer(reqBody),
+	)
 	if err != nil {
 		return err
 	}
@@ -90,3 +253,176 @@ func (c *Client) SetDNSCNAME(stack *Stack, domain *Domain, record, target string
 
 	return nil
 }
+
+// ListDNSRecords lists every resource record in a zone, following every page
+// of results.
+//
+// See: https://stackpath.dev/reference/resource-records#getzonerecords
+func (c *Client) ListDNSRecords(ctx context.Context, stack *Stack, domain *Domain) ([]DNSRecord, error) {
+	var records []DNSRecord
+	err := c.paginate(ctx, fmt.Sprintf(c.baseURL+"/dns/v1/stacks/%s/zones/%s/records", stack.Slug, domain.ID), defaultMaxPages, func(body []byte) error {
+		page := struct {
+			Records []DNSRecord `json:"records"`
+		}{}
+		err := json.Unmarshal(body, &page)
+		if err != nil {
+			return err
+		}
+
+		records = append(records, page.Records...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// DeleteDNSRecord deletes a resource record from a zone. Deleting a record
+// that's already gone isn't an error.
+//
+// See: https://stackpath.dev/reference/resource-records#deletezonerecord
+func (c *Client) DeleteDNSRecord(ctx context.Context, stack *Stack, domain *Domain, recordID string) error {
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodDelete,
+		fmt.Sprintf(c.baseURL+"/dns/v1/stacks/%s/zones/%s/records/%s", stack.Slug, domain.ID, recordID),
+		nil,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Do(req)
+	if IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SetDNSCNAME creates a DNS CNAME resource record. The record's TTL is 60s.
+//
+// See: https://stackpath.dev/reference/resource-records#createzonerecord
+func (c *Client) SetDNSCNAME(ctx context.Context, stack *Stack, domain *Domain, record, target string) error {
+	return c.SetDNSRecord(ctx, stack, domain, DNSRecord{
+		Type: DNSRecordTypeCNAME,
+		Name: record,
+		Data: target,
+		TTL:  defaultDNSTTL,
+	})
+}
+
+// UpsertDNSCNAME points a DNS CNAME resource record at a target, updating the
+// existing CNAME record with the same name or creating one if there isn't one.
+// A ttl of 0 uses a 60s TTL. If more than one CNAME record has the name, the
+// first is updated and the rest are returned untouched so callers can warn
+// about them.
+//
+// See: https://stackpath.dev/reference/resource-records#updatezonerecord
+func (c *Client) UpsertDNSCNAME(ctx context.Context, stack *Stack, domain *Domain, record, target string, ttl int) ([]DNSRecord, error) {
+	rec := DNSRecord{
+		Type: DNSRecordTypeCNAME,
+		Name: record,
+		Data: target,
+		TTL:  ttl,
+	}
+	err := rec.validate()
+	if err != nil {
+		return nil, err
+	}
+	if rec.TTL == 0 {
+		rec.TTL = defaultDNSTTL
+	}
+
+	records, err := c.ListDNSRecords(ctx, stack, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	var existing []DNSRecord
+	for _, r := range records {
+		if r.Type == DNSRecordTypeCNAME && strings.EqualFold(r.Name, record) {
+			existing = append(existing, r)
+		}
+	}
+
+	if len(existing) == 0 {
+		return nil, c.SetDNSRecord(ctx, stack, domain, rec)
+	}
+
+	reqBody, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPut,
+		fmt.Sprintf(c.baseURL+"/dns/v1/stacks/%s/zones/%s/records/%s", stack.Slug, domain.ID, existing[0].ID),
+		bytes.NewBuffer(reqBody),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// There's no need to save or interpret the API call response.
+	_, err = c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return existing[1:], nil
+}
+
+// maxCNAMEHops is how many CNAMEs ValidateCNAMETarget() follows before giving
+// up on a chain.
+const maxCNAMEHops = 10
+
+// lookupCNAME resolves a name's CNAME. It's a variable so tests can swap in a
+// fake resolver.
+var lookupCNAME = net.DefaultResolver.LookupCNAME
+
+// ValidateCNAMETarget checks that pointing a CNAME record on a domain at a
+// target won't create a CNAME loop, by following the target's CNAME chain and
+// failing if it leads back to the record or repeats a name. Chains longer than
+// maxCNAMEHops are rejected too. A target that doesn't exist yet (NXDOMAIN)
+// can't loop and is considered valid, but any other resolution error is
+// returned since the chain couldn't be checked.
+func ValidateCNAMETarget(ctx context.Context, domain *Domain, record, target string) error {
+	fqdn := strings.ToLower(strings.TrimSuffix(record+"."+domain.Name, "."))
+	name := strings.ToLower(strings.TrimSuffix(target, "."))
+	chain := []string{fqdn}
+	seen := map[string]bool{fqdn: true}
+
+	for hop := 0; hop < maxCNAMEHops; hop++ {
+		if seen[name] {
+			return fmt.Errorf("CNAME loop detected: %s -> %s", strings.Join(chain, " -> "), name)
+		}
+		seen[name] = true
+		chain = append(chain, name)
+
+		canonicalName, err := lookupCNAME(ctx, name)
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("resolving CNAME %s: %w", name, err)
+		}
+
+		// A name that resolves to itself is the end of the chain.
+		canonicalName = strings.ToLower(strings.TrimSuffix(canonicalName, "."))
+		if canonicalName == name {
+			return nil
+		}
+
+		name = canonicalName
+	}
+
+	return fmt.Errorf("CNAME chain %s is longer than %d hops", strings.Join(chain, " -> "), maxCNAMEHops)
+}
@@ -0,0 +1,164 @@
+package stackpath
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestValidateCNAMETarget(t *testing.T) {
+	domain := &Domain{ID: "zone-id", Name: "example.com"}
+
+	tests := []struct {
+		name    string
+		target  string
+		cnames  map[string]string
+		wantErr string
+	}{
+		{
+			name:   "target resolves to itself",
+			target: "site.edge.example.net",
+			cnames: map[string]string{"site.edge.example.net": "site.edge.example.net."},
+		},
+		{
+			name:   "chain ends",
+			target: "site.edge.example.net",
+			cnames: map[string]string{
+				"site.edge.example.net": "edge.example.net.",
+				"edge.example.net":      "edge.example.net.",
+			},
+		},
+		{
+			name:   "target doesn't exist yet",
+			target: "new.edge.example.net",
+		},
+		{
+			name:    "record points at itself",
+			target:  "demo.example.com.",
+			wantErr: "CNAME loop detected: demo.example.com -> demo.example.com",
+		},
+		{
+			name:   "chain leads back to the record",
+			target: "site.edge.example.net",
+			cnames: map[string]string{
+				"site.edge.example.net": "demo.example.com.",
+			},
+			wantErr: "CNAME loop detected: demo.example.com -> site.edge.example.net -> demo.example.com",
+		},
+		{
+			name:   "chain loops without the record",
+			target: "a.example.net",
+			cnames: map[string]string{
+				"a.example.net": "b.example.net.",
+				"b.example.net": "a.example.net.",
+			},
+			wantErr: "CNAME loop detected: demo.example.com -> a.example.net -> b.example.net -> a.example.net",
+		},
+		{
+			name:    "resolution failure",
+			target:  "servfail.example.net",
+			wantErr: "resolving CNAME servfail.example.net",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer func(lookup func(context.Context, string) (string, error)) {
+				lookupCNAME = lookup
+			}(lookupCNAME)
+
+			lookupCNAME = func(ctx context.Context, host string) (string, error) {
+				if host == "servfail.example.net" {
+					return "", &net.DNSError{Err: "server misbehaving", Name: host, IsTemporary: true}
+				}
+
+				cname, found := test.cnames[host]
+				if !found {
+					return "", &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+				}
+
+				return cname, nil
+			}
+
+			err := ValidateCNAMETarget(context.Background(), domain, "demo", test.target)
+			if test.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("expected an error containing %q, got %v", test.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateCNAMETargetHopLimit(t *testing.T) {
+	defer func(lookup func(context.Context, string) (string, error)) {
+		lookupCNAME = lookup
+	}(lookupCNAME)
+
+	// Every name points at a new, longer one.
+	lookupCNAME = func(ctx context.Context, host string) (string, error) {
+		return "x." + host, nil
+	}
+
+	err := ValidateCNAMETarget(context.Background(), &Domain{Name: "example.com"}, "demo", "edge.example.net")
+	if err == nil || !strings.Contains(err.Error(), "longer than") {
+		t.Fatalf("expected a hop limit error, got %v", err)
+	}
+}
+
+func TestQuoteTXT(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{
+			name: "short",
+			data: "v=spf1 -all",
+			want: `"v=spf1 -all"`,
+		},
+		{
+			name: "escapes quotes and backslashes",
+			data: `say "hi" \o/`,
+			want: `"say \"hi\" \\o/"`,
+		},
+		{
+			name: "exactly the limit",
+			data: strings.Repeat("a", 255),
+			want: `"` + strings.Repeat("a", 255) + `"`,
+		},
+		{
+			name: "split at the limit",
+			data: strings.Repeat("a", 300),
+			want: `"` + strings.Repeat("a", 255) + `" "` + strings.Repeat("a", 45) + `"`,
+		},
+		{
+			// The 255 byte limit falls in the middle of the two byte "é".
+			name: "split before a multi-byte character",
+			data: strings.Repeat("a", 254) + "é" + "b",
+			want: `"` + strings.Repeat("a", 254) + `" "éb"`,
+		},
+		{
+			// The 255 byte limit falls after the second byte of the four byte
+			// emoji.
+			name: "split before a four byte character",
+			data: strings.Repeat("a", 253) + "😀",
+			want: `"` + strings.Repeat("a", 253) + `" "😀"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := quoteTXT(test.data)
+			if got != test.want {
+				t.Fatalf("expected %s, got %s", test.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package stackpath_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"stackpath-demonstration-app/pkg/stackpath"
+	"stackpath-demonstration-app/pkg/stackpath/stackpathtest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// The API paths of the default fixtures' DNS zone.
+const (
+	zonesPath   = "/dns/v1/stacks/" + stackpathtest.StackSlug + "/zones"
+	recordsPath = zonesPath + "/" + stackpathtest.ZoneID + "/records"
+)
+
+func TestDNSRequests(t *testing.T) {
+	runRequestTests(t, []requestTest{
+		{
+			name: "FindDomainByName",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.FindDomainByName(ctx, testStack, stackpathtest.DomainName)
+				return err
+			},
+			want: wantRequest{
+				method: http.MethodGet,
+				path:   zonesPath,
+				query:  url.Values{"page_request.filter": {`domain="` + stackpathtest.DomainName + `"`}},
+			},
+		},
+		{
+			name: "CreateZone",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.CreateZone(ctx, testStack, stackpathtest.DomainName)
+				return err
+			},
+			want: wantRequest{
+				method: http.MethodPost,
+				path:   zonesPath,
+				body:   `{"domain": "` + stackpathtest.DomainName + `"}`,
+			},
+		},
+		{
+			name: "SetDNSRecord",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				return client.SetDNSRecord(ctx, testStack, testDomain, stackpath.DNSRecord{
+					Type:     stackpath.DNSRecordTypeMX,
+					Name:     "@",
+					Data:     "mail.example.com",
+					Priority: 10,
+					Comment:  "created by the demo",
+				})
+			},
+			want: wantRequest{
+				method: http.MethodPost,
+				path:   recordsPath,
+				body:   `{"type": "MX", "name": "@", "data": "mail.example.com", "ttl": 60, "priority": 10, "comment": "created by the demo"}`,
+			},
+		},
+		{
+			name: "SetDNSRecord with long TXT data",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				return client.SetDNSRecord(ctx, testStack, testDomain, stackpath.DNSRecord{
+					Type: stackpath.DNSRecordTypeTXT,
+					Name: "@",
+					Data: strings.Repeat("a", 300),
+				})
+			},
+			want: wantRequest{
+				method: http.MethodPost,
+				path:   recordsPath,
+				// TXT strings are limited to 255 bytes, so the data is split
+				// in two.
+				body: `{"type": "TXT", "name": "@", "data": ` +
+					strconv.Quote(`"`+strings.Repeat("a", 255)+`" "`+strings.Repeat("a", 45)+`"`) + `}`,
+			},
+		},
+		{
+			name: "ListDNSRecords",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.ListDNSRecords(ctx, testStack, testDomain)
+				return err
+			},
+			want: wantRequest{method: http.MethodGet, path: recordsPath},
+		},
+		{
+			name: "DeleteDNSRecord",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				return client.DeleteDNSRecord(ctx, testStack, testDomain, stackpathtest.RecordID)
+			},
+			want: wantRequest{method: http.MethodDelete, path: recordsPath + "/" + stackpathtest.RecordID},
+		},
+		{
+			name: "SetDNSCNAME",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				return client.SetDNSCNAME(ctx, testStack, testDomain, "demo", "a1b2c3d4.stackpathcdn.com")
+			},
+			want: wantRequest{
+				method: http.MethodPost,
+				path:   recordsPath,
+				body:   `{"type": "CNAME", "name": "demo", "data": "a1b2c3d4.stackpathcdn.com", "ttl": 60}`,
+			},
+		},
+		{
+			name: "UpsertDNSCNAME",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.UpsertDNSCNAME(ctx, testStack, testDomain, "demo", "e5f6a7b8.stackpathcdn.com", 300)
+				return err
+			},
+			want: wantRequest{
+				method: http.MethodPut,
+				path:   recordsPath + "/" + stackpathtest.RecordID,
+				body:   `{"type": "CNAME", "name": "demo", "data": "e5f6a7b8.stackpathcdn.com", "ttl": 300}`,
+			},
+		},
+		{
+			name: "UpsertDNSCNAME without a record",
+			setup: func(server *stackpathtest.Server) {
+				server.HandleJSON(http.MethodGet, recordsPath, http.StatusOK, `{"pageInfo": {"hasNextPage": false}, "records": []}`)
+			},
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.UpsertDNSCNAME(ctx, testStack, testDomain, "demo", "e5f6a7b8.stackpathcdn.com", 0)
+				return err
+			},
+			want: wantRequest{
+				method: http.MethodPost,
+				path:   recordsPath,
+				body:   `{"type": "CNAME", "name": "demo", "data": "e5f6a7b8.stackpathcdn.com", "ttl": 60}`,
+			},
+		},
+	})
+}
+
+func TestUpsertDNSCNAMEReturnsDuplicates(t *testing.T) {
+	server, client := newTestClient(t)
+	server.HandleJSON(http.MethodGet, recordsPath, http.StatusOK, `{
+  "pageInfo": {"hasNextPage": false},
+  "records": [
+    {"id": "record-1", "name": "demo", "type": "CNAME", "data": "a1b2c3d4.stackpathcdn.com", "ttl": 60},
+    {"id": "record-2", "name": "DEMO", "type": "CNAME", "data": "old.stackpathcdn.com", "ttl": 60}
+  ]
+}`)
+
+	duplicates, err := client.UpsertDNSCNAME(context.Background(), testStack, testDomain, "demo", "e5f6a7b8.stackpathcdn.com", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	assertRequest(t, server, wantRequest{method: http.MethodPut, path: recordsPath + "/record-1"})
+	if len(server.RequestsTo(http.MethodPost, recordsPath)) != 0 {
+		t.Error("expected the existing record to be updated instead of a new one created")
+	}
+	if len(duplicates) != 1 || duplicates[0].ID != "record-2" {
+		t.Errorf("expected record-2 to be returned as a duplicate, got %+v", duplicates)
+	}
+}
@@ -0,0 +1,64 @@
+package stackpath
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// sensitiveFields matches JSON string fields holding credentials so they can
+// be redacted from dumped responses.
+var sensitiveFields = regexp.MustCompile(`"(access_token|refresh_token|id_token|client_secret)"(\s*):(\s*)"[^"]*"`)
+
+// unsafeFileNameChars matches characters that aren't kept when a request path
+// is turned into a file name.
+var unsafeFileNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// WithResponseDump writes every API response body to a timestamped file in dir
+// as it's received, for debugging and for capturing test fixtures. Credentials
+// in response bodies are redacted. Responses aren't dumped by default.
+func WithResponseDump(dir string) Option {
+	return func(c *Client) {
+		c.dumpDir = dir
+	}
+}
+
+// dumpResponse writes a response's body to a file in the client's dump
+// directory and replaces the body so it can still be read by the caller.
+func (c *Client) dumpResponse(req *http.Request, res *http.Response) error {
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	err = res.Body.Close()
+	if err != nil {
+		return err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	err = os.MkdirAll(c.dumpDir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf(
+		"%s-%s-%s-%d.json",
+		time.Now().UTC().Format("20060102T150405.000000000"),
+		req.Method,
+		strings.Trim(unsafeFileNameChars.ReplaceAllString(req.URL.Path, "_"), "_"),
+		res.StatusCode,
+	)
+
+	return ioutil.WriteFile(
+		filepath.Join(c.dumpDir, name),
+		sensitiveFields.ReplaceAll(body, []byte(`"$1"$2:$3"REDACTED"`)),
+		0o600,
+	)
+}
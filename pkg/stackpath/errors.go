@@ -0,0 +1,210 @@
+package stackpath
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// APIError is returned by Do() for StackPath API responses with a non-2xx
+// status code. Code and Message are parsed from StackPath's standard error
+// envelope and are empty if the response body isn't one.
+type APIError struct {
+	StatusCode int
+	Code       string
+	Message    string
+	RequestID  string
+	RawBody    []byte
+}
+
+// Error implements the error interface.
+func (e *APIError) Error() string {
+	message := string(e.RawBody)
+	if e.Message != "" {
+		message = e.Message
+		if e.Code != "" {
+			message += " (code " + e.Code + ")"
+		}
+	}
+
+	return fmt.Sprintf("%d %s (request ID: %s): %s", e.StatusCode, http.StatusText(e.StatusCode), e.RequestID, message)
+}
+
+// newAPIError builds an APIError from an error response, parsing the
+// {"code": ..., "message": ..., "details": [...]} error envelope if the body is
+// one.
+func newAPIError(statusCode int, requestID string, body []byte) *APIError {
+	apiErr := &APIError{
+		StatusCode: statusCode,
+		RequestID:  requestID,
+		RawBody:    body,
+	}
+
+	envelope := struct {
+		Code    json.RawMessage `json:"code"`
+		Message string          `json:"message"`
+	}{}
+	if json.Unmarshal(body, &envelope) == nil {
+		// The code is numeric on most endpoints and a string on others.
+		apiErr.Code = strings.Trim(string(envelope.Code), `"`)
+		apiErr.Message = envelope.Message
+	}
+
+	return apiErr
+}
+
+// IsNotFound determines if an error is a 404 Not Found API response.
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// IsUnauthorized determines if an error is a 401 Unauthorized or 403 Forbidden
+// API response, meaning the API credentials are invalid or can't access the
+// resource.
+func IsUnauthorized(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) &&
+		(apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden)
+}
+
+// isConflict determines if an error response means the resource being created
+// already exists. StackPath answers some duplicates with a 409 Conflict and
+// others with a 400 Bad Request explaining the conflict.
+func isConflict(apiErr *APIError) bool {
+	if apiErr.StatusCode == http.StatusConflict {
+		return true
+	}
+
+	message := strings.ToLower(string(apiErr.RawBody))
+	return apiErr.StatusCode == http.StatusBadRequest &&
+		(strings.Contains(message, "already exists") || strings.Contains(message, "already in use"))
+}
+
+// ErrStackExists is matched by errors.Is() when a stack can't be created
+// because its slug is taken.
+var ErrStackExists = errors.New("stack already exists")
+
+// StackExistsError is returned when creating a stack whose slug is already
+// taken, either by a stack the credentials can see or one on another account.
+type StackExistsError struct {
+	Slug string
+
+	// Err is the API error response StackPath refused the request with.
+	Err *APIError
+}
+
+// Error implements the error interface.
+func (e *StackExistsError) Error() string {
+	return fmt.Sprintf("stack %s already exists: %s", e.Slug, e.Err)
+}
+
+// Unwrap lets errors.As() reach the underlying APIError.
+func (e *StackExistsError) Unwrap() error {
+	return e.Err
+}
+
+// Is lets errors.Is() match a StackExistsError with ErrStackExists.
+func (e *StackExistsError) Is(target error) bool {
+	return target == ErrStackExists
+}
+
+// InstanceNotRunningError is returned when an operation requires a running
+// workload instance but the instance is in another phase, like SCHEDULING or
+// STARTING.
+type InstanceNotRunningError struct {
+	Instance string
+	Phase    string
+}
+
+// Error implements the error interface.
+func (e *InstanceNotRunningError) Error() string {
+	return fmt.Sprintf("instance %s is %s, not running", e.Instance, strings.ToLower(e.Phase))
+}
+
+// ErrQuotaExceeded is matched by errors.Is() when StackPath refuses to create a
+// resource because the account reached its quota for that resource type.
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// QuotaExceededError is returned when the account has reached its quota for a
+// resource type, like the maximum number of workloads or sites.
+type QuotaExceededError struct {
+	// Resource is the type of resource that couldn't be created, e.g.
+	// "workload" or "site". It's empty if the resource type isn't known.
+	Resource string
+	Message  string
+
+	// Err is the API error response StackPath refused the request with.
+	Err *APIError
+}
+
+// Error implements the error interface.
+func (e *QuotaExceededError) Error() string {
+	if e.Resource == "" {
+		return "quota exceeded: " + e.Message
+	}
+
+	return e.Resource + " quota exceeded: " + e.Message
+}
+
+// Unwrap lets errors.As() reach the underlying APIError.
+func (e *QuotaExceededError) Unwrap() error {
+	return e.Err
+}
+
+// Is lets errors.Is() match a QuotaExceededError with ErrQuotaExceeded.
+func (e *QuotaExceededError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
+
+// isQuotaExceeded determines if an error response means the account reached a
+// resource quota. StackPath doesn't use a dedicated status code for this, so
+// look for quota wording in the response body. 429 responses are rate limits,
+// not quotas.
+func isQuotaExceeded(statusCode int, body []byte) bool {
+	if statusCode < 400 || statusCode >= 500 || statusCode == http.StatusTooManyRequests {
+		return false
+	}
+
+	message := strings.ToLower(string(body))
+	return strings.Contains(message, "quota") ||
+		strings.Contains(message, "limit exceeded") ||
+		strings.Contains(message, "maximum number")
+}
+
+// withQuotaResource sets the resource type on a QuotaExceededError, passing
+// any other error through untouched.
+func withQuotaResource(err error, resource string) error {
+	var quotaErr *QuotaExceededError
+	if errors.As(err, &quotaErr) {
+		quotaErr.Resource = resource
+	}
+
+	return err
+}
+
+// ErrAmbiguousMatch is matched by errors.Is() when a lookup by name finds more
+// than one resource, so acting on any of them could affect another project.
+var ErrAmbiguousMatch = errors.New("ambiguous match")
+
+// AmbiguousMatchError is returned when a lookup by name finds more than one
+// resource, e.g. two workloads with a project's workload name.
+type AmbiguousMatchError struct {
+	// Resource is the type of resource that was looked up, e.g. "workload" or
+	// "site".
+	Resource string
+	Name     string
+	Count    int
+}
+
+// Error implements the error interface.
+func (e *AmbiguousMatchError) Error() string {
+	return fmt.Sprintf("found %d %ss named %q, expected at most one", e.Count, e.Resource, e.Name)
+}
+
+// Is lets errors.Is() match an AmbiguousMatchError with ErrAmbiguousMatch.
+func (e *AmbiguousMatchError) Is(target error) bool {
+	return target == ErrAmbiguousMatch
+}
@@ -0,0 +1,19 @@
+package stackpath
+
+import (
+	"context"
+	"testing"
+)
+
+// StubLookupCNAME makes ValidateCNAMETarget() resolve CNAMEs with lookup for
+// the rest of the test, so the stackpath_test package's tests don't depend on
+// live DNS.
+func StubLookupCNAME(t *testing.T, lookup func(ctx context.Context, host string) (string, error)) {
+	t.Helper()
+
+	original := lookupCNAME
+	t.Cleanup(func() {
+		lookupCNAME = original
+	})
+	lookupCNAME = lookup
+}
@@ -0,0 +1,35 @@
+package stackpath
+
+import (
+	"net/http"
+)
+
+// Interceptor wraps the requests Do() makes, like HTTP middleware. It's called
+// with the request and next, which makes the request and returns its response.
+// An interceptor can change the request before calling next, inspect or
+// replace the response, or call next more than once. The client's User-Agent
+// and Authorization headers are set after every interceptor runs, so they
+// can't be overridden.
+type Interceptor func(req *http.Request, next func(*http.Request) (*http.Response, error)) (*http.Response, error)
+
+// WithInterceptors wraps every request the client makes in the given
+// interceptors, for instance to propagate tracing headers or record
+// per-request metrics. The first interceptor is outermost. Multiple
+// WithInterceptors() options add to each other.
+func WithInterceptors(interceptors ...Interceptor) Option {
+	return func(c *Client) {
+		c.interceptors = append(c.interceptors, interceptors...)
+	}
+}
+
+// intercept runs a request through the client's interceptors from the i'th
+// one, then makes it.
+func (c *Client) intercept(req *http.Request, i int) (*http.Response, error) {
+	if i == len(c.interceptors) {
+		return c.do(req)
+	}
+
+	return c.interceptors[i](req, func(req *http.Request) (*http.Response, error) {
+		return c.intercept(req, i+1)
+	})
+}
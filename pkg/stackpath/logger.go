@@ -0,0 +1,65 @@
+package stackpath
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// RequestLog describes a request made by Do() once it's finished.
+type RequestLog struct {
+	Method    string
+	URL       string
+	RequestID string
+
+	// Header holds the request headers as sent, with the Authorization header
+	// redacted.
+	Header http.Header
+
+	// StatusCode is the final response's status code, including for
+	// responses returned as an *APIError. It's 0 if no response was received.
+	StatusCode int
+
+	// Duration is how long the request took, including retries.
+	Duration time.Duration
+	Err      error
+}
+
+// Logger is called with every request the client makes.
+type Logger func(entry RequestLog)
+
+// WithLogger calls logger after every request Do() makes, for tracing which
+// StackPath endpoints were called and how long they took. Requests aren't
+// logged by default.
+func WithLogger(logger Logger) Option {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
+// logRequest passes a finished request to the client's logger.
+func (c *Client) logRequest(req *http.Request, res *http.Response, err error, duration time.Duration) {
+	header := req.Header.Clone()
+	if header.Get("Authorization") != "" {
+		header.Set("Authorization", "REDACTED")
+	}
+
+	entry := RequestLog{
+		Method:    req.Method,
+		URL:       req.URL.String(),
+		RequestID: req.Header.Get(c.requestIDHeader),
+		Header:    header,
+		Duration:  duration,
+		Err:       err,
+	}
+
+	var apiErr *APIError
+	switch {
+	case res != nil:
+		entry.StatusCode = res.StatusCode
+	case errors.As(err, &apiErr):
+		entry.StatusCode = apiErr.StatusCode
+	}
+
+	c.logger(entry)
+}
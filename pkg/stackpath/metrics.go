@@ -0,0 +1,146 @@
+package stackpath
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// metricsWAFWindow is how far back WAF requests are counted in a metrics
+// snapshot.
+const metricsWAFWindow = time.Hour
+
+// WriteMetricsSnapshot writes a deployment's current metrics to w in the
+// Prometheus text exposition format: its instance counts by phase, the share of
+// WAF requests blocked over the last hour, and how many days remain until its
+// SSL certificate expires. Instance metrics are left out if the deployment has
+// no workload, and WAF and certificate metrics if it has no site. The
+// certificate metric is also left out if the site doesn't have a certificate
+// yet.
+//
+// See: https://prometheus.io/docs/instrumenting/exposition_formats/
+func (c *Client) WriteMetricsSnapshot(ctx context.Context, w io.Writer, d *Deployment) error {
+	if d.Workload == nil && d.Site == nil {
+		return fmt.Errorf("deployment has no workload or site to report metrics for")
+	}
+
+	workloadSlug, siteID := "", ""
+	if d.Workload != nil {
+		workloadSlug = d.Workload.Slug
+	}
+	if d.Site != nil {
+		siteID = d.Site.ID
+	}
+	labels := fmt.Sprintf(`stack=%q,workload=%q,site=%q`, d.Stack.Slug, workloadSlug, siteID)
+
+	if d.Workload != nil {
+		err := c.writeInstanceMetrics(ctx, w, d, labels)
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.Site == nil {
+		return nil
+	}
+
+	err := c.writeWAFMetrics(ctx, w, d, labels)
+	if err != nil {
+		return err
+	}
+
+	cert, err := c.GetSSLCertStatus(ctx, d.Stack, d.Site)
+	if err != nil {
+		return fmt.Errorf("reading the SSL certificate: %w", err)
+	}
+	if cert == nil || cert.ExpirationDate.IsZero() {
+		return nil
+	}
+
+	_, err = fmt.Fprintf(
+		w,
+		"# HELP stackpath_certificate_expiry_days Days until the site's SSL certificate expires.\n"+
+			"# TYPE stackpath_certificate_expiry_days gauge\n"+
+			"stackpath_certificate_expiry_days{%s} %d\n",
+		labels,
+		int(time.Until(cert.ExpirationDate).Hours()/24),
+	)
+
+	return err
+}
+
+// writeInstanceMetrics writes the deployment workload's instance counts by
+// phase for WriteMetricsSnapshot().
+func (c *Client) writeInstanceMetrics(ctx context.Context, w io.Writer, d *Deployment, labels string) error {
+	instances, err := c.GetInstances(ctx, d.Stack, d.Workload)
+	if err != nil {
+		return err
+	}
+
+	phases := make(map[string]int)
+	for _, instance := range instances {
+		phases[instance.Phase]++
+	}
+
+	var phaseNames []string
+	for phase := range phases {
+		phaseNames = append(phaseNames, phase)
+	}
+	sort.Strings(phaseNames)
+
+	_, err = fmt.Fprintf(
+		w,
+		"# HELP stackpath_workload_instances Edge Compute instances in the workload by phase.\n"+
+			"# TYPE stackpath_workload_instances gauge\n",
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, phase := range phaseNames {
+		_, err = fmt.Fprintf(w, "stackpath_workload_instances{%s,phase=%q} %d\n", labels, phase, phases[phase])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeWAFMetrics writes the deployment site's WAF request count and block rate
+// over the last hour for WriteMetricsSnapshot().
+func (c *Client) writeWAFMetrics(ctx context.Context, w io.Writer, d *Deployment, labels string) error {
+	requests, err := c.GetWAFRequests(ctx, d.Stack, d.Site, c.ServerNow().Add(-metricsWAFWindow), time.Time{})
+	if err != nil {
+		return err
+	}
+
+	blocked := 0
+	for _, request := range requests {
+		if request.Action == WAFActionBlock {
+			blocked++
+		}
+	}
+
+	blockRate := 0.0
+	if len(requests) > 0 {
+		blockRate = float64(blocked) / float64(len(requests))
+	}
+
+	_, err = fmt.Fprintf(
+		w,
+		"# HELP stackpath_waf_requests WAF requests to the site over the last hour.\n"+
+			"# TYPE stackpath_waf_requests gauge\n"+
+			"stackpath_waf_requests{%[1]s} %[2]d\n"+
+			"# HELP stackpath_waf_block_rate Share of the site's WAF requests over the last hour that were blocked.\n"+
+			"# TYPE stackpath_waf_block_rate gauge\n"+
+			"stackpath_waf_block_rate{%[1]s} %[3]g\n",
+		labels,
+		len(requests),
+		blockRate,
+	)
+
+	return err
+}
@@ -0,0 +1,81 @@
+package stackpath_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"stackpath-demonstration-app/pkg/stackpath"
+	"stackpath-demonstration-app/pkg/stackpath/stackpathtest"
+	"strings"
+	"testing"
+)
+
+func TestWriteMetricsSnapshot(t *testing.T) {
+	labels := `stack="` + stackpathtest.StackSlug + `",workload="` + stackpathtest.WorkloadSlug + `",site="` + stackpathtest.SiteID + `"`
+
+	tests := []struct {
+		name     string
+		siteless bool
+		want     []string
+		wantNot  []string
+	}{
+		{
+			name: "workload and site",
+			want: []string{
+				`stackpath_workload_instances{` + labels + `,phase="RUNNING"} 1`,
+				`stackpath_waf_requests{` + labels + `} 1`,
+				`stackpath_waf_block_rate{` + labels + `} 1`,
+				`stackpath_certificate_expiry_days{` + labels + `} `,
+			},
+		},
+		{
+			name:     "workload only",
+			siteless: true,
+			want: []string{
+				`stackpath_workload_instances{stack="` + stackpathtest.StackSlug + `",workload="` + stackpathtest.WorkloadSlug + `",site=""`,
+			},
+			wantNot: []string{"stackpath_waf_requests", "stackpath_certificate_expiry_days"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, client := newTestClient(t)
+
+			d := newTestDeployment()
+			if test.siteless {
+				d.Site = nil
+			}
+
+			var out bytes.Buffer
+			err := client.WriteMetricsSnapshot(context.Background(), &out, d)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			assertRequest(t, server, wantRequest{method: http.MethodGet, path: workloadSlugPath + "/instances"})
+			for _, want := range test.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("expected %q in:\n%s", want, out.String())
+				}
+			}
+			for _, wantNot := range test.wantNot {
+				if strings.Contains(out.String(), wantNot) {
+					t.Errorf("unexpected %q in:\n%s", wantNot, out.String())
+				}
+			}
+		})
+	}
+}
+
+func TestWriteMetricsSnapshotWithoutResources(t *testing.T) {
+	_, client := newTestClient(t)
+
+	d := stackpath.NewDeployment("demo")
+	d.Stack = testStack
+
+	err := client.WriteMetricsSnapshot(context.Background(), &bytes.Buffer{}, d)
+	if err == nil {
+		t.Fatal("expected an error for a deployment without a workload or site")
+	}
+}
@@ -0,0 +1,88 @@
+package stackpath
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// defaultMaxPages is how many pages of results list methods read before
+// giving up, guarding against an endpoint that never stops paginating.
+const defaultMaxPages = 100
+
+// errStopPaginating is returned by a paginate() handler to stop reading pages
+// early without an error.
+var errStopPaginating = errors.New("stop paginating")
+
+// paginate requests every page of a cursor paginated list endpoint and calls
+// handle with each page's response body. Pages are followed by passing the
+// previous page's pageInfo.endCursor as page_request.after until
+// pageInfo.hasNextPage is false, or until handle returns errStopPaginating. An
+// error is returned if there are more than maxPages pages.
+//
+// See: https://stackpath.dev/docs/pagination
+func (c *Client) paginate(ctx context.Context, rawURL string, maxPages int, handle func(body []byte) error) error {
+	cursor := ""
+	for page := 0; page < maxPages; page++ {
+		pageURL := rawURL
+		if cursor != "" {
+			separator := "?"
+			if strings.Contains(rawURL, "?") {
+				separator = "&"
+			}
+
+			pageURL += separator + "page_request.after=" + url.QueryEscape(cursor)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+		if err != nil {
+			return err
+		}
+
+		res, err := c.Do(req)
+		if err != nil {
+			return err
+		}
+
+		body, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			return err
+		}
+		err = res.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		err = handle(body)
+		if err == errStopPaginating {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		pageRes := struct {
+			PageInfo struct {
+				EndCursor   string `json:"endCursor"`
+				HasNextPage bool   `json:"hasNextPage"`
+			} `json:"pageInfo"`
+		}{}
+		err = json.Unmarshal(body, &pageRes)
+		if err != nil {
+			return err
+		}
+
+		if !pageRes.PageInfo.HasNextPage || pageRes.PageInfo.EndCursor == "" {
+			return nil
+		}
+
+		cursor = pageRes.PageInfo.EndCursor
+	}
+
+	return fmt.Errorf("%s returned more than %d pages of results", strings.TrimPrefix(rawURL, c.baseURL), maxPages)
+}
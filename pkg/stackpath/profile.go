@@ -0,0 +1,75 @@
+package stackpath
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// Profile models a named pair of StackPath API credentials, so the demo can run
+// against several StackPath accounts without editing its configuration.
+type Profile struct {
+	ClientID     string `json:"clientId"`
+	ClientSecret string `json:"clientSecret"`
+}
+
+// LoadProfiles reads named credential profiles from a JSON file shaped like:
+//
+//	{
+//	  "profiles": {
+//	    "default": {"clientId": "...", "clientSecret": "..."},
+//	    "acme": {"clientId": "...", "clientSecret": "..."}
+//	  }
+//	}
+func LoadProfiles(path string) (map[string]Profile, error) {
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file := struct {
+		Profiles map[string]Profile `json:"profiles"`
+	}{}
+	err = json.Unmarshal(body, &file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %s", path, err)
+	}
+
+	return file.Profiles, nil
+}
+
+// ListProfiles returns the names of the credential profiles in a profile file
+// in alphabetical order.
+func ListProfiles(path string) ([]string, error) {
+	profiles, err := LoadProfiles(path)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// NewClientFromProfile builds a new StackPath API client like NewClient(),
+// authenticating with the named profile's credentials from a profile file.
+func NewClientFromProfile(path, name string, opts ...Option) (*Client, error) {
+	profiles, err := LoadProfiles(path)
+	if err != nil {
+		return nil, err
+	}
+
+	profile, found := profiles[name]
+	if !found {
+		names, _ := ListProfiles(path)
+		return nil, fmt.Errorf("profile %q not found in %s, available profiles: %s", name, path, strings.Join(names, ", "))
+	}
+
+	return NewClientWithOptions(profile.ClientID, profile.ClientSecret, opts...)
+}
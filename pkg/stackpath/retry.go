@@ -0,0 +1,172 @@
+package stackpath
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy controls how Do() retries requests that fail with a transient
+// 500, 502, 503, or 504 response or a network error. Only GET and HEAD requests
+// are retried unless RetryNonIdempotent is set, since retrying a request that
+// creates a resource could create it twice.
+//
+// Requests of any method that are rate limited with a 429 response are retried
+// after the delay in the response's Retry-After header, for up to
+// MaxRateLimitWait in total or until the request's context deadline, whichever
+// comes first. Rate limited retries don't count towards MaxAttempts.
+type RetryPolicy struct {
+	// MaxAttempts is how many times a request is attempted in total. 1
+	// disables retries.
+	MaxAttempts int
+
+	// BaseDelay is the delay before the first retry. It doubles on each retry
+	// up to MaxDelay, and each delay is randomly shortened by up to half to
+	// spread retries out.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	RetryNonIdempotent bool
+
+	// MaxRateLimitWait is the longest a request waits in total on 429
+	// responses. 0 disables retrying rate limited requests.
+	MaxRateLimitWait time.Duration
+}
+
+// DefaultRetryPolicy returns the retry policy clients use unless configured
+// otherwise: up to 4 attempts of GET and HEAD requests, starting at a 500ms
+// delay, and waiting up to two minutes on rate limits.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:      4,
+		BaseDelay:        500 * time.Millisecond,
+		MaxDelay:         8 * time.Second,
+		MaxRateLimitWait: 2 * time.Minute,
+	}
+}
+
+// WithRetryPolicy sets the client's retry policy. Pass a policy with
+// MaxAttempts of 1 to disable retries.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retryPolicy = policy
+	}
+}
+
+// send makes an HTTP request with the underlying http.Client, retrying it
+// according to the client's retry policy. The response to the last attempt is
+// returned.
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	retryable := c.retryPolicy.RetryNonIdempotent || req.Method == http.MethodGet || req.Method == http.MethodHead
+	delay := c.retryPolicy.BaseDelay
+
+	rateLimitDeadline := time.Now().Add(c.retryPolicy.MaxRateLimitWait)
+	if deadline, ok := req.Context().Deadline(); ok && deadline.Before(rateLimitDeadline) {
+		rateLimitDeadline = deadline
+	}
+
+	for attempt := 1; ; {
+		sent := time.Now()
+		res, err := c.c.Do(req)
+		if err == nil {
+			c.recordClockSkew(res, sent, time.Now())
+			c.recordRateLimit(res)
+		}
+
+		// Stop once the caller gave up on the request. Requests with a body
+		// also need a fresh copy of it to be sent again.
+		if req.Context().Err() != nil || (req.Body != nil && req.GetBody == nil) {
+			return res, err
+		}
+
+		var wait time.Duration
+		switch {
+		case err == nil && res.StatusCode == http.StatusTooManyRequests:
+			// Don't hammer the API if it asks for a retry right away.
+			wait = retryAfter(res.Header.Get("Retry-After"), delay)
+			if wait < c.retryPolicy.BaseDelay {
+				wait = c.retryPolicy.BaseDelay
+			}
+			if time.Now().Add(wait).After(rateLimitDeadline) {
+				return res, nil
+			}
+
+		case retryable && attempt < c.retryPolicy.MaxAttempts && (err != nil || isRetryableStatus(res.StatusCode)):
+			wait = jitter(delay)
+			attempt++
+			delay *= 2
+			if delay > c.retryPolicy.MaxDelay {
+				delay = c.retryPolicy.MaxDelay
+			}
+
+		default:
+			return res, err
+		}
+
+		if err == nil {
+			_ = res.Body.Close()
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+
+		if req.GetBody != nil {
+			req.Body, err = req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// retryAfter parses a Retry-After header in either its delay seconds or HTTP
+// date form into how long to wait. The fallback is used if the header is
+// missing or invalid.
+func retryAfter(header string, fallback time.Duration) time.Duration {
+	header = strings.TrimSpace(header)
+
+	seconds, err := strconv.Atoi(header)
+	if err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	date, err := http.ParseTime(header)
+	if err == nil {
+		wait := time.Until(date)
+		if wait < 0 {
+			wait = 0
+		}
+
+		return wait
+	}
+
+	return fallback
+}
+
+// isRetryableStatus determines if a response status code indicates a
+// transient failure worth retrying.
+func isRetryableStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+
+	return false
+}
+
+// jitter randomly shortens a delay by up to half.
+func jitter(delay time.Duration) time.Duration {
+	if delay <= 0 {
+		return 0
+	}
+
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
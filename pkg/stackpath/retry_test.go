@@ -0,0 +1,154 @@
+package stackpath_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"stackpath-demonstration-app/pkg/stackpath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// failingTransport answers the first failures requests to a path with a
+// canned error response and sends the rest on to the mock server.
+type failingTransport struct {
+	path       string
+	failures   int
+	statusCode int
+	header     http.Header
+
+	// attempts counts the requests made to the path.
+	attempts int
+}
+
+// RoundTrip implements http.RoundTripper.
+func (f *failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Path != f.path {
+		return http.DefaultTransport.RoundTrip(req)
+	}
+
+	f.attempts++
+	if f.attempts > f.failures {
+		return http.DefaultTransport.RoundTrip(req)
+	}
+
+	header := http.Header{"Content-Type": {"application/json"}}
+	for name, values := range f.header {
+		header[name] = values
+	}
+
+	return &http.Response{
+		StatusCode: f.statusCode,
+		Header:     header,
+		Body:       ioutil.NopCloser(strings.NewReader(`{"code": 14, "message": "try again"}`)),
+		Request:    req,
+	}, nil
+}
+
+// fastRetryPolicy retries quickly so tests don't wait on backoff.
+func fastRetryPolicy(maxAttempts int) stackpath.RetryPolicy {
+	return stackpath.RetryPolicy{
+		MaxAttempts:      maxAttempts,
+		BaseDelay:        time.Millisecond,
+		MaxDelay:         10 * time.Millisecond,
+		MaxRateLimitWait: 10 * time.Second,
+	}
+}
+
+func TestDoRetriesTransientFailures(t *testing.T) {
+	transport := &failingTransport{path: "/stack/v1/stacks", failures: 2, statusCode: http.StatusServiceUnavailable}
+	_, client := newTestClient(t,
+		stackpath.WithHTTPClient(&http.Client{Transport: transport}),
+		stackpath.WithRetryPolicy(fastRetryPolicy(3)),
+	)
+
+	_, err := client.ListStacks(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if transport.attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", transport.attempts)
+	}
+}
+
+func TestDoGivesUpAfterMaxAttempts(t *testing.T) {
+	transport := &failingTransport{path: "/stack/v1/stacks", failures: 5, statusCode: http.StatusServiceUnavailable}
+	_, client := newTestClient(t,
+		stackpath.WithHTTPClient(&http.Client{Transport: transport}),
+		stackpath.WithRetryPolicy(fastRetryPolicy(3)),
+	)
+
+	_, err := client.ListStacks(context.Background())
+	var apiErr *stackpath.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected a 503 *APIError, got %v", err)
+	}
+	if transport.attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", transport.attempts)
+	}
+}
+
+func TestDoDoesNotRetryPosts(t *testing.T) {
+	transport := &failingTransport{path: "/stack/v1/stacks", failures: 1, statusCode: http.StatusServiceUnavailable}
+	_, client := newTestClient(t,
+		stackpath.WithHTTPClient(&http.Client{Transport: transport}),
+		stackpath.WithRetryPolicy(fastRetryPolicy(3)),
+	)
+
+	_, err := client.CreateStack(context.Background(), "Demo", "demo-stack", "account-id")
+	if err == nil {
+		t.Fatal("expected the 503 to be returned")
+	}
+	if transport.attempts != 1 {
+		t.Errorf("expected 1 attempt, got %d", transport.attempts)
+	}
+}
+
+func TestDoWaitsOutRateLimits(t *testing.T) {
+	transport := &failingTransport{
+		path:       "/stack/v1/stacks",
+		failures:   1,
+		statusCode: http.StatusTooManyRequests,
+		header:     http.Header{"Retry-After": {"2"}},
+	}
+	_, client := newTestClient(t,
+		stackpath.WithHTTPClient(&http.Client{Transport: transport}),
+		stackpath.WithRetryPolicy(fastRetryPolicy(1)),
+	)
+
+	start := time.Now()
+	_, err := client.CreateStack(context.Background(), "Demo", "demo-stack", "account-id")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if transport.attempts != 2 {
+		t.Errorf("expected 2 attempts, got %d", transport.attempts)
+	}
+	if elapsed := time.Since(start); elapsed < 2*time.Second {
+		t.Errorf("expected to wait out the 2s Retry-After, waited %s", elapsed)
+	}
+}
+
+func TestDoGivesUpOnLongRateLimits(t *testing.T) {
+	transport := &failingTransport{
+		path:       "/stack/v1/stacks",
+		failures:   1,
+		statusCode: http.StatusTooManyRequests,
+		header:     http.Header{"Retry-After": {"60"}},
+	}
+	_, client := newTestClient(t,
+		stackpath.WithHTTPClient(&http.Client{Transport: transport}),
+		stackpath.WithRetryPolicy(fastRetryPolicy(1)),
+	)
+
+	_, err := client.ListStacks(context.Background())
+	var apiErr *stackpath.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected a 429 *APIError, got %v", err)
+	}
+	if transport.attempts != 1 {
+		t.Errorf("expected 1 attempt, got %d", transport.attempts)
+	}
+}
@@ -1,7 +1,10 @@
 package stackpath
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"net/http"
 	"net/url"
@@ -18,11 +21,12 @@ type Stack struct {
 // nil means the stack was not found.
 //
 // See: https://stackpath.dev/reference/stacks#getstacks
-func (c *Client) FindStackBySlug(stackSlug string) (*Stack, error) {
+func (c *Client) FindStackBySlug(ctx context.Context, stackSlug string) (*Stack, error) {
 	// Search for the stack by slug by passing in a page_request.filter for it.
-	req, err := http.NewRequest(
+	req, err := http.NewRequestWithContext(
+		ctx,
 		http.MethodGet,
-		baseURL+"/stack/v1/stacks?page_request.filter="+url.QueryEscape("slug=\""+stackSlug+"\""),
+		c.baseURL+"/stack/v1/stacks?page_request.filter="+url.QueryEscape("slug=\""+stackSlug+"\""),
 		nil,
 	)
 	if err != nil {
@@ -58,3 +62,71 @@ func (c *Client) FindStackBySlug(stackSlug string) (*Stack, error) {
 
 	return &searchRes.Results[0], nil
 }
+
+// ListStacks lists every stack the API credentials can access, following every
+// page of results.
+//
+// See: https://stackpath.dev/reference/stacks#getstacks
+func (c *Client) ListStacks(ctx context.Context) ([]Stack, error) {
+	var stacks []Stack
+	err := c.paginate(ctx, c.baseURL+"/stack/v1/stacks", defaultMaxPages, func(body []byte) error {
+		page := struct {
+			Results []Stack `json:"results"`
+		}{}
+		err := json.Unmarshal(body, &page)
+		if err != nil {
+			return err
+		}
+
+		stacks = append(stacks, page.Results...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return stacks, nil
+}
+
+// CreateStack creates a new StackPath stack on the given account and returns
+// it with its generated ID. A *StackExistsError, which matches ErrStackExists,
+// is returned if a stack with the slug already exists.
+//
+// See: https://stackpath.dev/reference/stacks#createstack
+func (c *Client) CreateStack(ctx context.Context, name, slug, accountID string) (*Stack, error) {
+	reqBody := bytes.NewBuffer([]byte(`{
+  "accountId": "` + accountID + `",
+  "name": "` + name + `",
+  "slug": "` + slug + `"
+}`))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/stack/v1/stacks", reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.Do(req)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && isConflict(apiErr) {
+		return nil, &StackExistsError{Slug: slug, Err: apiErr}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	err = res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	newStack := Stack{}
+	err = json.Unmarshal(body, &newStack)
+	if err != nil {
+		return nil, err
+	}
+
+	return &newStack, nil
+}
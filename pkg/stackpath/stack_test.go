@@ -0,0 +1,47 @@
+package stackpath_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"stackpath-demonstration-app/pkg/stackpath"
+	"stackpath-demonstration-app/pkg/stackpath/stackpathtest"
+	"testing"
+)
+
+func TestStackRequests(t *testing.T) {
+	runRequestTests(t, []requestTest{
+		{
+			name: "FindStackBySlug",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.FindStackBySlug(ctx, stackpathtest.StackSlug)
+				return err
+			},
+			want: wantRequest{
+				method: http.MethodGet,
+				path:   "/stack/v1/stacks",
+				query:  url.Values{"page_request.filter": {`slug="` + stackpathtest.StackSlug + `"`}},
+			},
+		},
+		{
+			name: "ListStacks",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.ListStacks(ctx)
+				return err
+			},
+			want: wantRequest{method: http.MethodGet, path: "/stack/v1/stacks"},
+		},
+		{
+			name: "CreateStack",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.CreateStack(ctx, "Demo", stackpathtest.StackSlug, "account-id")
+				return err
+			},
+			want: wantRequest{
+				method: http.MethodPost,
+				path:   "/stack/v1/stacks",
+				body:   `{"accountId": "account-id", "name": "Demo", "slug": "` + stackpathtest.StackSlug + `"}`,
+			},
+		},
+	})
+}
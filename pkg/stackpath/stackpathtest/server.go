@@ -0,0 +1,193 @@
+// Package stackpathtest provides a mock StackPath API gateway for testing code
+// built on the stackpath package without making calls to StackPath.
+package stackpathtest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"stackpath-demonstration-app/pkg/stackpath"
+	"strings"
+	"sync"
+)
+
+// Request is a request received by a Server.
+type Request struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Header http.Header
+	Body   []byte
+}
+
+// Response is a canned response a Server answers matching requests with. A
+// zero StatusCode means 200 OK.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       string
+}
+
+// route answers requests whose method and path match with a response.
+type route struct {
+	method   string
+	pattern  string
+	response Response
+}
+
+// Server is a mock StackPath API gateway. It records every request it
+// receives and answers them with canned JSON responses. A new Server answers
+// every endpoint the stackpath package calls with the fixtures in
+// DefaultFixtures(). Requests that don't match a route get a 404 response in
+// StackPath's error format.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	routes   []route
+	requests []Request
+}
+
+// NewServer starts a Server with the default fixtures. Callers should Close()
+// it when they're done.
+func NewServer() *Server {
+	s := &Server{}
+	for _, fixture := range DefaultFixtures() {
+		s.Handle(fixture.Method, fixture.Pattern, fixture.Response)
+	}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Handle answers requests with the given method and path with a canned
+// response, replacing any earlier route for them. In the path pattern, "*"
+// matches any one path segment, like "/stack/v1/stacks/*/workloads". The
+// query string isn't matched.
+func (s *Server) Handle(method, pattern string, response Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.routes = append(s.routes, route{
+		method:   method,
+		pattern:  pattern,
+		response: response,
+	})
+}
+
+// HandleJSON answers requests with the given method and path with a status
+// code and JSON body, like Handle().
+func (s *Server) HandleJSON(method, pattern string, statusCode int, body string) {
+	s.Handle(method, pattern, Response{
+		StatusCode: statusCode,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       body,
+	})
+}
+
+// Requests returns every request the server received, oldest first.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Request(nil), s.requests...)
+}
+
+// RequestsTo returns the requests the server received with the given method
+// and a path matching the pattern, oldest first.
+func (s *Server) RequestsTo(method, pattern string) []Request {
+	var matched []Request
+	for _, req := range s.Requests() {
+		if req.Method == method && matchPath(pattern, req.Path) {
+			matched = append(matched, req)
+		}
+	}
+
+	return matched
+}
+
+// Reset forgets the requests the server received.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = nil
+}
+
+// NewClient builds a stackpath.Client that makes its calls to the server.
+// Retries are turned off so failures show up right away. Options are applied
+// after the server's, so they can override them.
+func (s *Server) NewClient(opts ...stackpath.Option) (*stackpath.Client, error) {
+	opts = append([]stackpath.Option{
+		stackpath.WithBaseURL(s.URL),
+		stackpath.WithAuthMaxAttempts(1),
+		stackpath.WithRetryPolicy(stackpath.RetryPolicy{MaxAttempts: 1}),
+	}, opts...)
+
+	return stackpath.NewClientWithOptions("test-client-id", "test-client-secret", opts...)
+}
+
+// serveHTTP records a request and answers it with the most recently added
+// matching route's response.
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Query:  r.URL.Query(),
+		Header: r.Header.Clone(),
+		Body:   body,
+	})
+
+	response := Response{
+		StatusCode: http.StatusNotFound,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       `{"code": 5, "message": "not found"}`,
+	}
+	for i := len(s.routes) - 1; i >= 0; i-- {
+		if s.routes[i].method == r.Method && matchPath(s.routes[i].pattern, r.URL.Path) {
+			response = s.routes[i].response
+			break
+		}
+	}
+	s.mu.Unlock()
+
+	for name, values := range response.Header {
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+
+	statusCode := response.StatusCode
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+
+	w.WriteHeader(statusCode)
+	_, _ = w.Write([]byte(response.Body))
+}
+
+// matchPath determines if a path matches a pattern whose "*" segments match
+// any one path segment.
+func matchPath(pattern, path string) bool {
+	patternSegments := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(patternSegments) != len(pathSegments) {
+		return false
+	}
+
+	for i, segment := range patternSegments {
+		if segment != "*" && segment != pathSegments[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -2,37 +2,487 @@ package stackpath
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/url"
+	"sort"
+	"strings"
 	"time"
 )
 
-// CreateDemoWAFRules creates two demo WAF rules on a site:
+// The actions a custom WAF rule can take on matching requests. Rules with the
+// monitor action only log matching requests, which then show up in
+// GetWAFRequests() with the monitor action. This shows what a rule would block
+// before it's switched to enforce with SetWAFRuleAction().
+const (
+	WAFActionBlock   = "BLOCK"
+	WAFActionAllow   = "ALLOW"
+	WAFActionMonitor = "MONITOR"
+
+	// WAFActionTarpit slows down responses to clients instead of blocking
+	// them. It's only valid on rate limiting rules.
+	WAFActionTarpit = "TARPIT"
+)
+
+// The keys rate limiting WAF rules count requests by. Requests are counted by
+// client IP address or by the value of a request header.
+const (
+	WAFRateLimitKeyClientIP = "IP"
+	WAFRateLimitKeyHeader   = "HEADER"
+)
+
+// The modes a site's WAF can run in. In blocking mode the WAF enforces its
+// rules. In monitoring mode it only logs the requests its rules would have
+// blocked.
+const (
+	WAFModeBlocking   = "BLOCKING"
+	WAFModeMonitoring = "MONITORING"
+)
+
+// WAFRule models a custom WAF rule on a site. The rule's action is taken on
+// requests that match every one of its conditions. Rules with a RateLimit only
+// take their action once a client exceeds the limit. Rules with CaptureBody
+// also record the bodies of the requests they match for later inspection.
+// It's off by default since request bodies can hold private data.
+type WAFRule struct {
+	ID          string         `json:"id"`
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Action      string         `json:"action"`
+	Enabled     bool           `json:"enabled"`
+	Conditions  []WAFCondition `json:"conditions"`
+	RateLimit   *WAFRateLimit  `json:"rateLimit,omitempty"`
+	CaptureBody bool           `json:"captureBody,omitempty"`
+}
+
+// WAFRateLimit models the threshold of a rate limiting WAF rule: more than
+// Requests matching requests within Period from the same key. Key is a
+// WAFRateLimitKey* constant. Header names the header requests are counted by
+// when the key is WAFRateLimitKeyHeader.
+type WAFRateLimit struct {
+	Requests int
+	Period   time.Duration
+	Key      string
+	Header   string
+}
+
+// wafRateLimitJSON is how StackPath represents a WAFRateLimit.
+type wafRateLimitJSON struct {
+	Requests      int    `json:"requests"`
+	PeriodSeconds int    `json:"periodSeconds"`
+	Key           string `json:"key"`
+	Header        string `json:"header,omitempty"`
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (l WAFRateLimit) MarshalJSON() ([]byte, error) {
+	return json.Marshal(wafRateLimitJSON{
+		Requests:      l.Requests,
+		PeriodSeconds: int(l.Period.Seconds()),
+		Key:           l.Key,
+		Header:        l.Header,
+	})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (l *WAFRateLimit) UnmarshalJSON(b []byte) error {
+	var raw wafRateLimitJSON
+	err := json.Unmarshal(b, &raw)
+	if err != nil {
+		return err
+	}
+
+	*l = WAFRateLimit{
+		Requests: raw.Requests,
+		Period:   time.Duration(raw.PeriodSeconds) * time.Second,
+		Key:      raw.Key,
+		Header:   raw.Header,
+	}
+	return nil
+}
+
+// validate checks that the rate limit can be sent to StackPath.
+func (l WAFRateLimit) validate() error {
+	if l.Requests <= 0 {
+		return fmt.Errorf("rate limit requests must be positive, got %d", l.Requests)
+	}
+	if l.Period < time.Second || l.Period%time.Second != 0 {
+		return fmt.Errorf("rate limit period must be a whole number of seconds, got %s", l.Period)
+	}
+
+	switch l.Key {
+	case WAFRateLimitKeyClientIP:
+	case WAFRateLimitKeyHeader:
+		if l.Header == "" {
+			return fmt.Errorf("rate limits keyed by header need a header name")
+		}
+	default:
+		return fmt.Errorf("unknown rate limit key %q", l.Key)
+	}
+
+	return nil
+}
+
+// WAFCondition models a single condition of a custom WAF rule. Only one of its
+// fields is set. Condition types this package doesn't model are left empty.
+// Use the URLExactCondition(), URLPrefixCondition(), URLRegexCondition(),
+// HTTPMethodCondition(), ClientIPCondition(), CountryCondition(), and
+// NotCountryCondition() helpers to build conditions for CreateWAFRule().
+type WAFCondition struct {
+	URL        *WAFURLCondition        `json:"url,omitempty"`
+	HTTPMethod *WAFHTTPMethodCondition `json:"httpMethod,omitempty"`
+	IP         *WAFIPCondition         `json:"ip,omitempty"`
+	IPRange    *WAFIPRangeCondition    `json:"ipRange,omitempty"`
+	Country    *WAFCountryCondition    `json:"country,omitempty"`
+}
+
+// WAFURLCondition matches requests by URL path. Paths match by prefix unless
+// ExactMatch is set. Regex paths are regular expressions.
+type WAFURLCondition struct {
+	URL        string `json:"url"`
+	ExactMatch bool   `json:"exactMatch"`
+	Regex      bool   `json:"regex,omitempty"`
+}
+
+// WAFHTTPMethodCondition matches requests by HTTP method.
+type WAFHTTPMethodCondition struct {
+	HTTPMethod string `json:"httpMethod"`
+}
+
+// WAFIPCondition matches requests by client IP address.
+type WAFIPCondition struct {
+	IPAddress string `json:"ipAddress"`
+}
+
+// WAFIPRangeCondition matches requests from client IP addresses between two
+// bounds, inclusive.
+type WAFIPRangeCondition struct {
+	LowerBound string `json:"lowerBound"`
+	UpperBound string `json:"upperBound"`
+}
+
+// WAFCountryCondition matches requests by the client's ISO 3166 country code,
+// either from any of CountryCodes or, if Exclude is set, from none of them.
+type WAFCountryCondition struct {
+	CountryCodes []string `json:"countryCodes"`
+	Exclude      bool     `json:"exclude,omitempty"`
+}
+
+// URLExactCondition matches requests to exactly the given path.
+func URLExactCondition(path string) WAFCondition {
+	return WAFCondition{URL: &WAFURLCondition{URL: path, ExactMatch: true}}
+}
+
+// URLPrefixCondition matches requests to paths starting with the given prefix.
+func URLPrefixCondition(prefix string) WAFCondition {
+	return WAFCondition{URL: &WAFURLCondition{URL: prefix}}
+}
+
+// URLRegexCondition matches requests to paths matching a regular expression.
+func URLRegexCondition(pattern string) WAFCondition {
+	return WAFCondition{URL: &WAFURLCondition{URL: pattern, Regex: true}}
+}
+
+// HTTPMethodCondition matches requests made with an HTTP method.
+func HTTPMethodCondition(method string) WAFCondition {
+	return WAFCondition{HTTPMethod: &WAFHTTPMethodCondition{HTTPMethod: strings.ToUpper(method)}}
+}
+
+// ClientIPCondition matches requests from a client IP address, or from any
+// address in a CIDR block like "192.0.2.0/24".
+func ClientIPCondition(ipOrCIDR string) (WAFCondition, error) {
+	if !strings.Contains(ipOrCIDR, "/") {
+		ip := net.ParseIP(ipOrCIDR)
+		if ip == nil {
+			return WAFCondition{}, fmt.Errorf("invalid IP address %q", ipOrCIDR)
+		}
+
+		return WAFCondition{IP: &WAFIPCondition{IPAddress: ip.String()}}, nil
+	}
+
+	_, network, err := net.ParseCIDR(ipOrCIDR)
+	if err != nil {
+		return WAFCondition{}, err
+	}
+
+	// The upper bound is the network address with every host bit set.
+	upper := make(net.IP, len(network.IP))
+	for i := range network.IP {
+		upper[i] = network.IP[i] | ^network.Mask[i]
+	}
+
+	return WAFCondition{IPRange: &WAFIPRangeCondition{
+		LowerBound: network.IP.String(),
+		UpperBound: upper.String(),
+	}}, nil
+}
+
+// CountryCondition matches requests from clients in any of the given
+// countries, by ISO 3166 country code.
+func CountryCondition(countryCodes ...string) WAFCondition {
+	return WAFCondition{Country: &WAFCountryCondition{CountryCodes: upperCountryCodes(countryCodes)}}
+}
+
+// NotCountryCondition matches requests from clients outside all of the given
+// countries, by ISO 3166 country code.
+func NotCountryCondition(countryCodes ...string) WAFCondition {
+	return WAFCondition{Country: &WAFCountryCondition{CountryCodes: upperCountryCodes(countryCodes), Exclude: true}}
+}
+
+// upperCountryCodes normalizes country codes to the upper case StackPath uses.
+func upperCountryCodes(countryCodes []string) []string {
+	upper := make([]string, len(countryCodes))
+	for i, countryCode := range countryCodes {
+		upper[i] = strings.ToUpper(strings.TrimSpace(countryCode))
+	}
+
+	return upper
+}
+
+// EffectiveWAFRule models an active rule in a site's effective WAF policy.
+// Custom rules are the site's own WAF rules and managed rules are policies in
+// StackPath's managed policy groups.
+type EffectiveWAFRule struct {
+	Type   string
+	Group  string
+	Name   string
+	Action string
+}
+
+// demoWAFRules returns the WAF rules CreateDemoWAFRules() creates.
+func demoWAFRules() []WAFRule {
+	return []WAFRule{
+		{
+			Name:        "block access to blockme",
+			Description: "A simple path block to demo WAF capabilities",
+			Action:      WAFActionBlock,
+			Enabled:     true,
+			Conditions:  []WAFCondition{URLExactCondition("/blockme")},
+		},
+		{
+			Name:        "allow access to anything",
+			Description: "Allow access to a path, regardless of other rules",
+			Action:      WAFActionAllow,
+			Enabled:     true,
+			Conditions:  []WAFCondition{URLExactCondition("/anything")},
+		},
+	}
+}
+
+// CreateDemoWAFRules creates two demo WAF rules on a site and returns their
+// IDs:
 // * block requests to /blockme
 // * allow requests to /anything
+// Rules left over from a previous run are reused rather than duplicated.
+func (c *Client) CreateDemoWAFRules(ctx context.Context, stack *Stack, site *Site) ([]string, error) {
+	rules, err := c.ListWAFRules(ctx, stack, site)
+	if err != nil {
+		return nil, err
+	}
+
+	// existing is a mapping of rule name -> ID.
+	existing := make(map[string]string, len(rules))
+	for _, rule := range rules {
+		existing[rule.Name] = rule.ID
+	}
+
+	var ids []string
+	for _, rule := range demoWAFRules() {
+		id, found := existing[rule.Name]
+		if !found {
+			id, err = c.CreateWAFRule(ctx, stack, site, rule)
+			if err != nil {
+				return ids, err
+			}
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// DeleteDemoWAFRules deletes the WAF rules CreateDemoWAFRules() made on a site,
+// found by name, and returns how many were deleted. Other rules on the site
+// are left alone.
+func (c *Client) DeleteDemoWAFRules(ctx context.Context, stack *Stack, site *Site) (int, error) {
+	rules, err := c.ListWAFRules(ctx, stack, site)
+	if err != nil {
+		return 0, err
+	}
+
+	demoRules := make(map[string]bool)
+	for _, rule := range demoWAFRules() {
+		demoRules[rule.Name] = true
+	}
+
+	deleted := 0
+	for _, rule := range rules {
+		if !demoRules[rule.Name] {
+			continue
+		}
+
+		err = c.DeleteWAFRule(ctx, stack, site, rule.ID)
+		if err != nil {
+			return deleted, fmt.Errorf("deleting WAF rule %q: %w", rule.Name, err)
+		}
+		deleted++
+	}
+
+	return deleted, nil
+}
+
+// CreateGeoBlockRule creates a WAF rule on a site that blocks requests from
+// clients in any of the given countries, by ISO 3166 country code, and returns
+// the new rule's ID. Blocked requests show up in GetWAFRequests() under the
+// rule's name.
+func (c *Client) CreateGeoBlockRule(ctx context.Context, stack *Stack, site *Site, countries []string) (string, error) {
+	if len(countries) == 0 {
+		return "", fmt.Errorf("no countries to block")
+	}
+
+	condition := CountryCondition(countries...)
+	return c.CreateWAFRule(ctx, stack, site, WAFRule{
+		Name:        "block " + strings.Join(condition.Country.CountryCodes, ", "),
+		Description: "Block requests by client country to demo WAF geo controls",
+		Action:      WAFActionBlock,
+		Enabled:     true,
+		Conditions:  []WAFCondition{condition},
+	})
+}
+
+// CreateWAFRule creates a custom WAF rule on a site and returns the new rule's
+// ID. The rule's ID is ignored. Rules need a name, a WAFAction* action, and at
+// least one condition. Rate limiting rules either block or tarpit clients that
+// exceed the limit.
 //
 // See: https://stackpath.dev/reference/rules#createrule
-func (c *Client) CreateDemoWAFRules(stack *Stack, site *Site) error {
-	// Make the block rule
+func (c *Client) CreateWAFRule(ctx context.Context, stack *Stack, site *Site, rule WAFRule) (string, error) {
+	if rule.Name == "" {
+		return "", fmt.Errorf("WAF rules need a name")
+	}
+	if rule.RateLimit == nil && rule.Action != WAFActionBlock && rule.Action != WAFActionAllow && rule.Action != WAFActionMonitor {
+		return "", fmt.Errorf("unknown WAF rule action %q", rule.Action)
+	}
+	if rule.RateLimit != nil {
+		if rule.Action != WAFActionBlock && rule.Action != WAFActionTarpit {
+			return "", fmt.Errorf("rate limiting WAF rules must block or tarpit, got %q", rule.Action)
+		}
+
+		err := rule.RateLimit.validate()
+		if err != nil {
+			return "", err
+		}
+	}
+	if len(rule.Conditions) == 0 {
+		return "", fmt.Errorf("WAF rule %q needs at least one condition", rule.Name)
+	}
+	for _, condition := range rule.Conditions {
+		if condition.Country != nil && len(condition.Country.CountryCodes) == 0 {
+			return "", fmt.Errorf("WAF rule %q has a country condition without countries", rule.Name)
+		}
+	}
+
+	rawRule := map[string]interface{}{
+		"name":        rule.Name,
+		"description": rule.Description,
+		"action":      rule.Action,
+		"enabled":     rule.Enabled,
+		"conditions":  rule.Conditions,
+	}
+	if rule.RateLimit != nil {
+		rawRule["rateLimit"] = rule.RateLimit
+	}
+	if rule.CaptureBody {
+		rawRule["captureBody"] = true
+	}
+
+	reqBody, err := json.Marshal(rawRule)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		fmt.Sprintf(c.baseURL+"/waf/v1/stacks/%s/sites/%s/rules", stack.Slug, site.ID),
+		bytes.NewBuffer(reqBody),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := c.Do(req)
+	if err != nil {
+		return "", err
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	err = res.Body.Close()
+	if err != nil {
+		return "", err
+	}
+
+	newRule := struct {
+		Rule WAFRule `json:"rule"`
+	}{}
+	err = json.Unmarshal(body, &newRule)
+	if err != nil {
+		return "", err
+	}
+
+	return newRule.Rule.ID, nil
+}
+
+// DeleteWAFRule deletes a custom WAF rule from a site. Deleting a rule that's
+// already gone isn't an error.
+//
+// See: https://stackpath.dev/reference/rules#deleterule
+func (c *Client) DeleteWAFRule(ctx context.Context, stack *Stack, site *Site, ruleID string) error {
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodDelete,
+		fmt.Sprintf(c.baseURL+"/waf/v1/stacks/%s/sites/%s/rules/%s", stack.Slug, site.ID, ruleID),
+		nil,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Do(req)
+	if IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SetWAFRuleAction changes the action a custom WAF rule takes, for instance to
+// enforce a rule that was only monitoring requests.
+//
+// See: https://stackpath.dev/reference/rules#updaterule
+func (c *Client) SetWAFRuleAction(ctx context.Context, stack *Stack, site *Site, ruleID, action string) error {
+	if action != WAFActionBlock && action != WAFActionAllow && action != WAFActionMonitor {
+		return fmt.Errorf("unknown WAF rule action %q", action)
+	}
+
 	reqBody := bytes.NewBuffer([]byte(`{
-  "name": "block access to blockme",
-  "description": "A simple path block to demo WAF capabilities",
-  "conditions": [
-    {
-      "url": {
-        "url": "/blockme",
-        "exactMatch": true
-      }
-    }
-  ],
-  "action": "BLOCK",
-  "enabled": true
+  "action": "` + action + `"
 }`))
-	req, err := http.NewRequest(
-		http.MethodPost,
-		fmt.Sprintf(baseURL+"/waf/v1/stacks/%s/sites/%s/rules", stack.Slug, site.ID),
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPatch,
+		fmt.Sprintf(c.baseURL+"/waf/v1/stacks/%s/sites/%s/rules/%s", stack.Slug, site.ID, ruleID),
 		reqBody,
 	)
 	if err != nil {
@@ -44,25 +494,75 @@ func (c *Client) CreateDemoWAFRules(stack *Stack, site *Site) error {
 		return err
 	}
 
-	// Make the allow rule
-	reqBody = bytes.NewBuffer([]byte(`{
-  "name": "allow access to anything",
-  "description": "Allow access to a path, regardless of other rules",
-  "conditions": [
-    {
-      "url": {
-        "url": "/anything",
-        "exactMatch": true
-      }
-    }
-  ],
-  "action": "ALLOW",
-  "enabled": true
-}`))
-	req, err = http.NewRequest(
+	return nil
+}
+
+// GetWAFMode determines whether a site's WAF is enforcing its rules or only
+// monitoring requests, returning WAFModeBlocking or WAFModeMonitoring.
+//
+// See: https://stackpath.dev/reference/sites-1#getsite
+func (c *Client) GetWAFMode(ctx context.Context, stack *Stack, site *Site) (string, error) {
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodGet,
+		fmt.Sprintf(c.baseURL+"/waf/v1/stacks/%s/sites/%s", stack.Slug, site.ID),
+		nil,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := c.Do(req)
+	if err != nil {
+		return "", err
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	err = res.Body.Close()
+	if err != nil {
+		return "", err
+	}
+
+	siteRes := struct {
+		Site struct {
+			Monitoring bool `json:"monitoring"`
+		} `json:"site"`
+	}{}
+	err = json.Unmarshal(body, &siteRes)
+	if err != nil {
+		return "", err
+	}
+
+	if siteRes.Site.Monitoring {
+		return WAFModeMonitoring, nil
+	}
+
+	return WAFModeBlocking, nil
+}
+
+// SetWAFMode switches a site's WAF between enforcing its rules with
+// WAFModeBlocking and only logging requests with WAFModeMonitoring.
+//
+// See: https://stackpath.dev/reference/sites-1#enablemonitoring
+func (c *Client) SetWAFMode(ctx context.Context, stack *Stack, site *Site, mode string) error {
+	var action string
+	switch mode {
+	case WAFModeBlocking:
+		action = "disable_monitoring"
+	case WAFModeMonitoring:
+		action = "enable_monitoring"
+	default:
+		return fmt.Errorf("unknown WAF mode %q", mode)
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx,
 		http.MethodPost,
-		fmt.Sprintf(baseURL+"/waf/v1/stacks/%s/sites/%s/rules", stack.Slug, site.ID),
-		reqBody,
+		fmt.Sprintf(c.baseURL+"/waf/v1/stacks/%s/sites/%s/%s", stack.Slug, site.ID, action),
+		nil,
 	)
 	if err != nil {
 		return err
@@ -76,18 +576,303 @@ func (c *Client) CreateDemoWAFRules(stack *Stack, site *Site) error {
 	return nil
 }
 
-// GetWAFRequests retrieves a site's WAF requests from `since` until now.
+// VerifyWAFRule checks that a WAF rule is live by requesting a path on the
+// project's URL and checking that the response matches the rule's expected
+// action: a 403 Forbidden for WAFActionBlock and a non-error status for
+// WAFActionAllow. Rules take a little while to propagate to every POP, so the
+// request is retried for up to a minute before giving up. It returns the last
+// observed status code and the action it implies.
+func (c *Client) VerifyWAFRule(ctx context.Context, projectURL, path, expectedAction string) (int, string, error) {
+	if expectedAction != WAFActionBlock && expectedAction != WAFActionAllow {
+		return 0, "", fmt.Errorf("unable to verify WAF rule action %q", expectedAction)
+	}
+
+	// Call the project directly rather than through Do() so the StackPath
+	// bearer token isn't sent to the project.
+	httpClient := http.Client{Timeout: 10 * time.Second}
+	var statusCode int
+	var observedAction string
+	var lastErr error
+
+	for attempt := 0; attempt < 12; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(5 * time.Second):
+			case <-ctx.Done():
+				return statusCode, observedAction, ctx.Err()
+			}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(projectURL, "/")+path, nil)
+		if err != nil {
+			return 0, "", err
+		}
+
+		res, err := httpClient.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		_ = res.Body.Close()
+
+		statusCode = res.StatusCode
+		observedAction = WAFActionAllow
+		if statusCode == http.StatusForbidden {
+			observedAction = WAFActionBlock
+		}
+
+		if observedAction == expectedAction && statusCode < 500 {
+			return statusCode, observedAction, nil
+		}
+	}
+
+	if statusCode == 0 {
+		return 0, "", lastErr
+	}
+
+	return statusCode, observedAction, fmt.Errorf(
+		"expected %s on %s but got %d (%s)",
+		expectedAction,
+		path,
+		statusCode,
+		observedAction,
+	)
+}
+
+// maxWAFRequests is the most WAF requests GetWAFRequests() returns from one
+// call, guarding against unbounded memory use during a flood of requests.
+const maxWAFRequests = 10000
+
+// minWAFRequestWindow is the narrowest time window GetWAFRequestsFiltered()
+// splits a busy window into. The requests endpoint takes times to the second.
+const minWAFRequestWindow = time.Second
+
+// WAFRequestFilter narrows down the WAF requests GetWAFRequestsFiltered()
+// returns. Action is a WAFAction* constant and Country is an ISO 3166 country
+// code. Empty fields don't filter.
+type WAFRequestFilter struct {
+	Action  string
+	Country string
+}
+
+// query builds the filter's requests endpoint query parameters.
+func (f WAFRequestFilter) query() (string, error) {
+	query := ""
+	if f.Action != "" {
+		if f.Action != WAFActionBlock && f.Action != WAFActionAllow && f.Action != WAFActionMonitor {
+			return "", fmt.Errorf("unknown WAF request action %q", f.Action)
+		}
+
+		query += "&action=" + f.Action
+	}
+
+	if f.Country != "" {
+		if len(f.Country) != 2 {
+			return "", fmt.Errorf("invalid country code %q", f.Country)
+		}
+
+		query += "&country=" + url.QueryEscape(strings.ToUpper(f.Country))
+	}
+
+	return query, nil
+}
+
+// GetWAFRequests retrieves a site's WAF requests from `since` until `until`,
+// following every page of results. A zero `until` means now. Requests are
+// returned oldest first. If the window holds more than maxWAFRequests requests,
+// only an earlier part of it is returned; see GetWAFRequestsFiltered().
 //
 // See: https://stackpath.dev/reference/requests#getrequests
-func (c *Client) GetWAFRequests(stack *Stack, site *Site, since time.Time) ([]WAFRequest, error) {
-	req, err := http.NewRequest(
+func (c *Client) GetWAFRequests(ctx context.Context, stack *Stack, site *Site, since, until time.Time) ([]WAFRequest, error) {
+	requests, _, err := c.GetWAFRequestsFiltered(ctx, stack, site, since, until, WAFRequestFilter{})
+	return requests, err
+}
+
+// GetWAFRequestsFiltered retrieves a site's WAF requests like GetWAFRequests(),
+// filtered by action and country on StackPath's side. It also returns the end
+// of the window the requests cover, which is `until` unless the window held
+// more than maxWAFRequests requests. Pages aren't guaranteed to be in time
+// order, so a busy window is halved until every request in it fits, and
+// callers polling for new requests should poll again from the returned time
+// to pick up the rest. Only a window narrower than a second is cut short, to
+// its oldest maxWAFRequests requests.
+//
+// See: https://stackpath.dev/reference/requests#getrequests
+func (c *Client) GetWAFRequestsFiltered(ctx context.Context, stack *Stack, site *Site, since, until time.Time, filter WAFRequestFilter) ([]WAFRequest, time.Time, error) {
+	if until.IsZero() {
+		until = c.ServerNow()
+	}
+
+	filterQuery, err := filter.query()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	for {
+		requests, complete, err := c.getWAFRequests(ctx, stack, site, since, until, filterQuery)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+
+		if complete || until.Sub(since) <= minWAFRequestWindow {
+			sort.SliceStable(requests, func(i, j int) bool {
+				return requests[i].RequestTime.Before(requests[j].RequestTime)
+			})
+			if len(requests) > maxWAFRequests {
+				requests = requests[:maxWAFRequests]
+			}
+
+			return requests, until, nil
+		}
+
+		until = since.Add(until.Sub(since) / 2)
+	}
+}
+
+// getWAFRequests retrieves a site's WAF requests from `since` until `until`
+// for GetWAFRequestsFiltered(). complete is false if the window held more than
+// maxWAFRequests requests and pagination stopped early.
+func (c *Client) getWAFRequests(ctx context.Context, stack *Stack, site *Site, since, until time.Time, filterQuery string) (requests []WAFRequest, complete bool, err error) {
+	requestsURL := fmt.Sprintf(
+		c.baseURL+"/waf/v1/stacks/%s/sites/%s/requests?start_date=%s&end_date=%s%s",
+		stack.Slug,
+		site.ID,
+		url.QueryEscape(since.UTC().Format(time.RFC3339)),
+		url.QueryEscape(until.UTC().Format(time.RFC3339)),
+		filterQuery,
+	)
+
+	complete = true
+	err = c.paginate(ctx, requestsURL, defaultMaxPages, func(body []byte) error {
+		page := struct {
+			Results []WAFRequest `json:"results"`
+		}{}
+		err := json.Unmarshal(body, &page)
+		if err != nil {
+			return err
+		}
+
+		requests = append(requests, page.Results...)
+		if len(requests) > maxWAFRequests {
+			complete = false
+			return errStopPaginating
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return requests, complete, nil
+}
+
+// GetWAFRuleStats counts how many of a site's WAF requests from `since` until
+// now matched each WAF rule, keyed by rule name. Requests that didn't match a
+// rule aren't counted. It's the ByRule count of GetWAFStats().
+func (c *Client) GetWAFRuleStats(ctx context.Context, stack *Stack, site *Site, since time.Time) (map[string]int, error) {
+	stats, err := c.GetWAFStats(ctx, stack, site, since, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	return stats.ByRule, nil
+}
+
+// GetRequestGeoDistribution counts a site's WAF requests from `since` until now
+// by the country they came from, keyed by country code. It's the ByCountry
+// count of GetWAFStats().
+func (c *Client) GetRequestGeoDistribution(ctx context.Context, stack *Stack, site *Site, since time.Time) (map[string]int, error) {
+	stats, err := c.GetWAFStats(ctx, stack, site, since, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	return stats.ByCountry, nil
+}
+
+// WAFStats models aggregate counts of a site's WAF requests. ByCountry and
+// BlockedByCountry are keyed by country code and ByRule by the name of the rule
+// the request matched. Requests that didn't match a rule aren't counted in
+// ByRule.
+type WAFStats struct {
+	Total            int
+	Blocked          int
+	Allowed          int
+	Monitored        int
+	ByCountry        map[string]int
+	BlockedByCountry map[string]int
+	ByRule           map[string]int
+}
+
+// GetWAFStats counts a site's WAF requests from `since` until `until` by
+// action, country, and rule. A zero `until` means now. StackPath doesn't offer
+// a summary endpoint, so the counts are computed from GetWAFRequests() and
+// are capped at maxWAFRequests requests in total.
+func (c *Client) GetWAFStats(ctx context.Context, stack *Stack, site *Site, since, until time.Time) (*WAFStats, error) {
+	requests, err := c.GetWAFRequests(ctx, stack, site, since, until)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &WAFStats{
+		Total:            len(requests),
+		ByCountry:        make(map[string]int),
+		BlockedByCountry: make(map[string]int),
+		ByRule:           make(map[string]int),
+	}
+	for _, request := range requests {
+		country := request.Country
+		if country == "" {
+			country = "unknown"
+		}
+		stats.ByCountry[country]++
+
+		switch request.Action {
+		case WAFActionBlock:
+			stats.Blocked++
+			stats.BlockedByCountry[country]++
+		case WAFActionAllow:
+			stats.Allowed++
+		case WAFActionMonitor:
+			stats.Monitored++
+		}
+
+		if request.RuleName != "" {
+			stats.ByRule[request.RuleName]++
+		}
+	}
+
+	return stats, nil
+}
+
+// GetEffectiveWAFPolicy lists every enabled rule protecting a site in the
+// order the WAF evaluates them: the site's custom rules first, followed by the
+// policies in each enabled managed policy group.
+//
+// See: https://stackpath.dev/reference/policy-groups#getpolicygroups
+func (c *Client) GetEffectiveWAFPolicy(ctx context.Context, stack *Stack, site *Site) ([]EffectiveWAFRule, error) {
+	var policy []EffectiveWAFRule
+
+	rules, err := c.ListWAFRules(ctx, stack, site)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rule := range rules {
+		if rule.Enabled {
+			policy = append(policy, EffectiveWAFRule{
+				Type:   "custom",
+				Name:   rule.Name,
+				Action: rule.Action,
+			})
+		}
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx,
 		http.MethodGet,
-		fmt.Sprintf(
-			baseURL+"/waf/v1/stacks/%s/sites/%s/requests?start_date=%s",
-			stack.Slug,
-			site.ID,
-			since.Format(time.RFC3339),
-		),
+		fmt.Sprintf(c.baseURL+"/waf/v1/stacks/%s/sites/%s/policy_groups", stack.Slug, site.ID),
 		nil,
 	)
 	if err != nil {
@@ -109,12 +894,62 @@ func (c *Client) GetWAFRequests(stack *Stack, site *Site, since time.Time) ([]WA
 	}
 
 	results := struct {
-		Results []WAFRequest `json:"results"`
+		PolicyGroups []struct {
+			Name     string `json:"name"`
+			Enabled  bool   `json:"enabled"`
+			Policies []struct {
+				Name    string `json:"name"`
+				Action  string `json:"action"`
+				Enabled bool   `json:"enabled"`
+			} `json:"policies"`
+		} `json:"policyGroups"`
 	}{}
 	err = json.Unmarshal(body, &results)
 	if err != nil {
 		return nil, err
 	}
 
-	return results.Results, nil
+	for _, group := range results.PolicyGroups {
+		if !group.Enabled {
+			continue
+		}
+
+		for _, managedPolicy := range group.Policies {
+			if managedPolicy.Enabled {
+				policy = append(policy, EffectiveWAFRule{
+					Type:   "managed",
+					Group:  group.Name,
+					Name:   managedPolicy.Name,
+					Action: managedPolicy.Action,
+				})
+			}
+		}
+	}
+
+	return policy, nil
+}
+
+// ListWAFRules lists a site's custom WAF rules, following every page of
+// results.
+//
+// See: https://stackpath.dev/reference/rules#getrules
+func (c *Client) ListWAFRules(ctx context.Context, stack *Stack, site *Site) ([]WAFRule, error) {
+	var rules []WAFRule
+	err := c.paginate(ctx, fmt.Sprintf(c.baseURL+"/waf/v1/stacks/%s/sites/%s/rules", stack.Slug, site.ID), defaultMaxPages, func(body []byte) error {
+		page := struct {
+			Rules []WAFRule `json:"rules"`
+		}{}
+		err := json.Unmarshal(body, &page)
+		if err != nil {
+			return err
+		}
+
+		rules = append(rules, page.Rules...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return rules, nil
 }
@@ -0,0 +1,342 @@
+package stackpath_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"stackpath-demonstration-app/pkg/stackpath"
+	"stackpath-demonstration-app/pkg/stackpath/stackpathtest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The WAF API path of the default fixtures' site.
+const wafSitePath = "/waf/v1/stacks/" + stackpathtest.StackSlug + "/sites/" + stackpathtest.SiteID
+
+func TestWAFRequests(t *testing.T) {
+	since := time.Date(2021, 3, 2, 15, 0, 0, 0, time.UTC)
+	until := since.Add(time.Hour)
+
+	runRequestTests(t, []requestTest{
+		{
+			name: "CreateDemoWAFRules",
+			setup: func(server *stackpathtest.Server) {
+				server.HandleJSON(http.MethodGet, wafSitePath+"/rules", http.StatusOK, `{"pageInfo": {"hasNextPage": false}, "rules": []}`)
+			},
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.CreateDemoWAFRules(ctx, testStack, testSite)
+				return err
+			},
+			want: wantRequest{
+				method: http.MethodPost,
+				path:   wafSitePath + "/rules",
+				body:   `{"name": "allow access to anything", "action": "ALLOW", "enabled": true, "conditions": [{"url": {"url": "/anything", "exactMatch": true}}]}`,
+			},
+		},
+		{
+			name: "DeleteDemoWAFRules",
+			setup: func(server *stackpathtest.Server) {
+				server.HandleJSON(http.MethodGet, wafSitePath+"/rules", http.StatusOK, `{
+  "pageInfo": {"hasNextPage": false},
+  "rules": [{"id": "`+stackpathtest.WAFRuleID+`", "name": "block access to blockme", "action": "BLOCK"}]
+}`)
+			},
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.DeleteDemoWAFRules(ctx, testStack, testSite)
+				return err
+			},
+			want: wantRequest{method: http.MethodDelete, path: wafSitePath + "/rules/" + stackpathtest.WAFRuleID},
+		},
+		{
+			name: "CreateGeoBlockRule",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.CreateGeoBlockRule(ctx, testStack, testSite, []string{"ru", "kp"})
+				return err
+			},
+			want: wantRequest{
+				method: http.MethodPost,
+				path:   wafSitePath + "/rules",
+				body:   `{"name": "block RU, KP", "action": "BLOCK", "enabled": true, "conditions": [{"country": {"countryCodes": ["RU", "KP"]}}]}`,
+			},
+		},
+		{
+			name: "CreateWAFRule",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.CreateWAFRule(ctx, testStack, testSite, stackpath.WAFRule{
+					Name:        "capture /login",
+					Description: "Captures login attempts",
+					Action:      stackpath.WAFActionMonitor,
+					Enabled:     true,
+					Conditions: []stackpath.WAFCondition{
+						stackpath.URLExactCondition("/login"),
+						stackpath.HTTPMethodCondition(http.MethodPost),
+					},
+					CaptureBody: true,
+				})
+				return err
+			},
+			want: wantRequest{
+				method: http.MethodPost,
+				path:   wafSitePath + "/rules",
+				body: `{
+  "name": "capture /login",
+  "description": "Captures login attempts",
+  "action": "MONITOR",
+  "enabled": true,
+  "conditions": [{"url": {"url": "/login", "exactMatch": true}}, {"httpMethod": {"httpMethod": "POST"}}],
+  "captureBody": true
+}`,
+			},
+		},
+		{
+			name: "CreateWAFRule with a rate limit",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.CreateWAFRule(ctx, testStack, testSite, stackpath.WAFRule{
+					Name:       "rate limit /login",
+					Action:     stackpath.WAFActionBlock,
+					Enabled:    true,
+					Conditions: []stackpath.WAFCondition{stackpath.URLExactCondition("/login")},
+					RateLimit: &stackpath.WAFRateLimit{
+						Requests: 10,
+						Period:   time.Minute,
+						Key:      stackpath.WAFRateLimitKeyClientIP,
+					},
+				})
+				return err
+			},
+			want: wantRequest{
+				method: http.MethodPost,
+				path:   wafSitePath + "/rules",
+				body: `{
+  "name": "rate limit /login",
+  "action": "BLOCK",
+  "rateLimit": {"requests": 10, "periodSeconds": 60, "key": "IP"}
+}`,
+			},
+		},
+		{
+			name: "DeleteWAFRule",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				return client.DeleteWAFRule(ctx, testStack, testSite, stackpathtest.WAFRuleID)
+			},
+			want: wantRequest{method: http.MethodDelete, path: wafSitePath + "/rules/" + stackpathtest.WAFRuleID},
+		},
+		{
+			name: "SetWAFRuleAction",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				return client.SetWAFRuleAction(ctx, testStack, testSite, stackpathtest.WAFRuleID, stackpath.WAFActionMonitor)
+			},
+			want: wantRequest{
+				method: http.MethodPatch,
+				path:   wafSitePath + "/rules/" + stackpathtest.WAFRuleID,
+				body:   `{"action": "MONITOR"}`,
+			},
+		},
+		{
+			name: "GetWAFMode",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.GetWAFMode(ctx, testStack, testSite)
+				return err
+			},
+			want: wantRequest{method: http.MethodGet, path: wafSitePath},
+		},
+		{
+			name: "SetWAFMode monitoring",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				return client.SetWAFMode(ctx, testStack, testSite, stackpath.WAFModeMonitoring)
+			},
+			want: wantRequest{method: http.MethodPost, path: wafSitePath + "/enable_monitoring"},
+		},
+		{
+			name: "SetWAFMode blocking",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				return client.SetWAFMode(ctx, testStack, testSite, stackpath.WAFModeBlocking)
+			},
+			want: wantRequest{method: http.MethodPost, path: wafSitePath + "/disable_monitoring"},
+		},
+		{
+			name: "GetWAFRequests",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.GetWAFRequests(ctx, testStack, testSite, since, until)
+				return err
+			},
+			want: wantRequest{
+				method: http.MethodGet,
+				path:   wafSitePath + "/requests",
+				query:  url.Values{"start_date": {"2021-03-02T15:00:00Z"}, "end_date": {"2021-03-02T16:00:00Z"}},
+			},
+		},
+		{
+			name: "GetWAFRequestsFiltered",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, _, err := client.GetWAFRequestsFiltered(ctx, testStack, testSite, since, until, stackpath.WAFRequestFilter{
+					Action:  stackpath.WAFActionBlock,
+					Country: "us",
+				})
+				return err
+			},
+			want: wantRequest{
+				method: http.MethodGet,
+				path:   wafSitePath + "/requests",
+				query:  url.Values{"action": {"BLOCK"}, "country": {"US"}},
+			},
+		},
+		{
+			name: "GetWAFRuleStats",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.GetWAFRuleStats(ctx, testStack, testSite, since)
+				return err
+			},
+			want: wantRequest{
+				method: http.MethodGet,
+				path:   wafSitePath + "/requests",
+				query:  url.Values{"start_date": {"2021-03-02T15:00:00Z"}},
+			},
+		},
+		{
+			name: "GetRequestGeoDistribution",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.GetRequestGeoDistribution(ctx, testStack, testSite, since)
+				return err
+			},
+			want: wantRequest{
+				method: http.MethodGet,
+				path:   wafSitePath + "/requests",
+				query:  url.Values{"start_date": {"2021-03-02T15:00:00Z"}},
+			},
+		},
+		{
+			name: "GetWAFStats",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.GetWAFStats(ctx, testStack, testSite, since, until)
+				return err
+			},
+			want: wantRequest{
+				method: http.MethodGet,
+				path:   wafSitePath + "/requests",
+				query:  url.Values{"start_date": {"2021-03-02T15:00:00Z"}, "end_date": {"2021-03-02T16:00:00Z"}},
+			},
+		},
+		{
+			name: "GetEffectiveWAFPolicy",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.GetEffectiveWAFPolicy(ctx, testStack, testSite)
+				return err
+			},
+			want: wantRequest{method: http.MethodGet, path: wafSitePath + "/policy_groups"},
+		},
+		{
+			name: "ListWAFRules",
+			call: func(ctx context.Context, client *stackpath.Client) error {
+				_, err := client.ListWAFRules(ctx, testStack, testSite)
+				return err
+			},
+			want: wantRequest{method: http.MethodGet, path: wafSitePath + "/rules"},
+		},
+	})
+}
+
+func TestCreateWAFRuleLeavesCaptureBodyOff(t *testing.T) {
+	server, client := newTestClient(t)
+
+	_, err := client.CreateWAFRule(context.Background(), testStack, testSite, stackpath.WAFRule{
+		Name:       "block /admin",
+		Action:     stackpath.WAFActionBlock,
+		Enabled:    true,
+		Conditions: []stackpath.WAFCondition{stackpath.URLPrefixCondition("/admin")},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	req := assertRequest(t, server, wantRequest{method: http.MethodPost, path: wafSitePath + "/rules"})
+	if containsJSON(decodeJSON(t, req.Body), decodeJSON(t, []byte(`{"captureBody": true}`))) {
+		t.Errorf("expected no captureBody, got %s", req.Body)
+	}
+}
+
+func TestVerifyWAFRule(t *testing.T) {
+	// The project is served by the mock server too.
+	server, client := newTestClient(t)
+	server.HandleJSON(http.MethodGet, "/blockme", http.StatusForbidden, `{}`)
+	server.HandleJSON(http.MethodGet, "/anything", http.StatusOK, `{}`)
+
+	status, action, err := client.VerifyWAFRule(context.Background(), server.URL, "/blockme", stackpath.WAFActionBlock)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if status != http.StatusForbidden || action != stackpath.WAFActionBlock {
+		t.Errorf("expected 403 BLOCK, got %d %s", status, action)
+	}
+
+	status, action, err = client.VerifyWAFRule(context.Background(), server.URL, "/anything", stackpath.WAFActionAllow)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if status != http.StatusOK || action != stackpath.WAFActionAllow {
+		t.Errorf("expected 200 ALLOW, got %d %s", status, action)
+	}
+
+	// The project mustn't get the StackPath bearer token.
+	req := assertRequest(t, server, wantRequest{method: http.MethodGet, path: "/blockme"})
+	if req.Header.Get("Authorization") != "" {
+		t.Errorf("expected no Authorization header, got %q", req.Header.Get("Authorization"))
+	}
+}
+
+func TestGetWAFRequestsFilteredSplitsBusyWindows(t *testing.T) {
+	server, client := newTestClient(t)
+
+	// Every window holds one request too many, newest first.
+	since := time.Date(2021, 3, 2, 15, 0, 0, 0, time.UTC)
+	until := since.Add(time.Hour)
+	results := make([]string, 10001)
+	for i := range results {
+		results[i] = fmt.Sprintf(`{"id": "%d", "action": "ALLOW", "requestTime": "%s"}`, i, until.Add(-time.Duration(i)*time.Millisecond).Format(time.RFC3339Nano))
+	}
+	server.HandleJSON(http.MethodGet, wafSitePath+"/requests", http.StatusOK, `{
+  "pageInfo": {"hasNextPage": false},
+  "results": [`+strings.Join(results, ",")+`]
+}`)
+
+	requests, through, err := client.GetWAFRequestsFiltered(context.Background(), testStack, testSite, since, until, stackpath.WAFRequestFilter{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// The window is halved until it's a second wide, then cut short.
+	if !through.After(since) || through.Sub(since) > time.Second {
+		t.Errorf("expected the requests to cover at most a second after %s, got until %s", since, through)
+	}
+	if len(requests) != 10000 {
+		t.Fatalf("expected 10000 requests, got %d", len(requests))
+	}
+	if !requests[0].RequestTime.Before(requests[len(requests)-1].RequestTime) {
+		t.Error("expected the requests oldest first")
+	}
+
+	windows := server.RequestsTo(http.MethodGet, wafSitePath+"/requests")
+	if got := windows[1].Query.Get("end_date"); got != "2021-03-02T15:30:00Z" {
+		t.Errorf("expected the second poll to end halfway, got %s", got)
+	}
+}
+
+func TestGetWAFRequestsSendsUTCTimes(t *testing.T) {
+	server, client := newTestClient(t)
+
+	// A local time's "+" offset would be decoded as a space.
+	zone := time.FixedZone("CET", 60*60)
+	since := time.Date(2021, 3, 2, 16, 0, 0, 0, zone)
+	_, err := client.GetWAFRequests(context.Background(), testStack, testSite, since, since.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	assertRequest(t, server, wantRequest{
+		method: http.MethodGet,
+		path:   wafSitePath + "/requests",
+		query:  url.Values{"start_date": {"2021-03-02T15:00:00Z"}, "end_date": {"2021-03-02T16:00:00Z"}},
+	})
+}